@@ -0,0 +1,300 @@
+package customerimporter
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// ApproximateConfig sets the error bounds of approximate counting
+type ApproximateConfig struct {
+	TopN         int     // Number of heavy-hitter domains to report
+	Epsilon      float64 // Count-Min error: estimates exceed true counts by at most Epsilon*rows...
+	Delta        float64 // ...with probability 1-Delta
+	HLLPrecision uint8   // HyperLogLog precision p (4-18); relative error is about 1.04/sqrt(2^p)
+}
+
+// DefaultApproximateConfig returns bounds suitable for billions of rows in a few MB
+func DefaultApproximateConfig() ApproximateConfig {
+	return ApproximateConfig{TopN: 10, Epsilon: 0.0001, Delta: 0.001, HLLPrecision: 14}
+}
+
+func (c ApproximateConfig) validate() error {
+	if c.TopN < 1 {
+		return fmt.Errorf("top-N must be at least 1")
+	}
+	if c.Epsilon <= 0 || c.Epsilon >= 1 || c.Delta <= 0 || c.Delta >= 1 {
+		return fmt.Errorf("epsilon and delta must be between 0 and 1")
+	}
+	if c.HLLPrecision < 4 || c.HLLPrecision > 18 {
+		return fmt.Errorf("HyperLogLog precision must be between 4 and 18")
+	}
+	return nil
+}
+
+// ApproximateDomain is one heavy-hitter domain with estimated totals
+type ApproximateDomain struct {
+	Domain string
+	Count  uint64 // Count-Min estimate, never below the true count
+	// Distinct emails seen since the domain entered the top-N; a lower bound
+	// when the domain was displaced and re-entered during the run
+	DistinctEmails uint64
+}
+
+// ApproximateResult summarises an approximate run
+type ApproximateResult struct {
+	Config          ApproximateConfig
+	Rows            int
+	Skipped         int
+	TopDomains      []ApproximateDomain
+	DistinctDomains uint64
+	DistinctEmails  uint64
+}
+
+// CountErrorBound is the maximum overestimate of any domain count (with probability 1-Delta)
+func (r ApproximateResult) CountErrorBound() float64 {
+	return r.Config.Epsilon * float64(r.Rows)
+}
+
+// DistinctErrorRate is the HyperLogLog standard error as a fraction
+func (r ApproximateResult) DistinctErrorRate() float64 {
+	return 1.04 / math.Sqrt(float64(uint64(1)<<r.Config.HLLPrecision))
+}
+
+// Summary describes the estimates together with their error bounds
+func (r ApproximateResult) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Approximate summary: %d records, %d skipped\n", r.Rows, r.Skipped)
+	fmt.Fprintf(&b, "Domain counts overestimate by at most %.0f (epsilon %g) with probability %.4g\n",
+		r.CountErrorBound(), r.Config.Epsilon, 1-r.Config.Delta)
+	fmt.Fprintf(&b, "Distinct domains: ~%d (standard error %.2f%%)\n", r.DistinctDomains, 100*r.DistinctErrorRate())
+	fmt.Fprintf(&b, "Distinct emails: ~%d (standard error %.2f%%)\n", r.DistinctEmails, 100*r.DistinctErrorRate())
+	return b.String()
+}
+
+// Lines formats the top domains like sortDomains
+func (r ApproximateResult) Lines() []string {
+	lines := make([]string, len(r.TopDomains))
+	for i, d := range r.TopDomains {
+		lines[i] = fmt.Sprintf("%s: %d (~%d distinct emails)", d.Domain, d.Count, d.DistinctEmails)
+	}
+	return lines
+}
+
+// ProcessApproximate counts domains with bounded memory regardless of input
+// size: a Count-Min Sketch with a heavy-hitters heap for the top-N domains and
+// HyperLogLog sketches for distinct domains and emails
+func ProcessApproximate(input io.Reader, config ApproximateConfig) (ApproximateResult, error) {
+	run := NewRun(RunConfig{})
+	defer run.LogSkipSummary()
+	return run.ProcessApproximate(input, config)
+}
+
+// ProcessApproximate is the package-level ProcessApproximate under the run's
+// settings
+func (r *Run) ProcessApproximate(input io.Reader, config ApproximateConfig) (ApproximateResult, error) {
+	if err := config.validate(); err != nil {
+		return ApproximateResult{}, err
+	}
+	sketch := newCountMinSketch(config.Epsilon, config.Delta)
+	hitters := newHeavyHitters(config.TopN, config.HLLPrecision)
+	domains := newHyperLogLog(config.HLLPrecision)
+	emails := newHyperLogLog(config.HLLPrecision)
+
+	rows, skipped, err := r.streamCSVDomains(input, func(_ int, domain string, record Record) {
+		email := r.providers.normaliseEmail(record.Email)
+		hitters.Offer(domain, sketch.Add(domain), email)
+		domains.Add(domain)
+		emails.Add(email)
+	})
+	if err != nil {
+		return ApproximateResult{}, err
+	}
+	if err := r.checkStreamingCounts(rows, skipped); err != nil {
+		return ApproximateResult{}, err
+	}
+
+	return ApproximateResult{
+		Config:          config,
+		Rows:            rows,
+		Skipped:         skipped,
+		TopDomains:      hitters.Sorted(),
+		DistinctDomains: domains.Estimate(),
+		DistinctEmails:  emails.Estimate(),
+	}, nil
+}
+
+// hash64 is FNV-1a followed by a splitmix64 finaliser for well-spread bits
+func hash64(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// countMinSketch estimates item frequencies in width*depth counters
+type countMinSketch struct {
+	width uint64
+	depth int
+	table [][]uint64
+}
+
+func newCountMinSketch(epsilon, delta float64) *countMinSketch {
+	width := uint64(math.Ceil(math.E / epsilon))
+	depth := int(math.Ceil(math.Log(1 / delta)))
+	table := make([][]uint64, depth)
+	for i := range table {
+		table[i] = make([]uint64, width)
+	}
+	return &countMinSketch{width: width, depth: depth, table: table}
+}
+
+// Add counts one occurrence and returns the updated estimate
+func (s *countMinSketch) Add(key string) uint64 {
+	h := hash64(key)
+	h1, h2 := h&0xffffffff, (h>>32)|1
+	estimate := uint64(math.MaxUint64)
+	for i := 0; i < s.depth; i++ {
+		cell := &s.table[i][(h1+uint64(i)*h2)%s.width]
+		*cell++
+		if *cell < estimate {
+			estimate = *cell
+		}
+	}
+	return estimate
+}
+
+// hyperLogLog estimates the number of distinct items
+type hyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+func newHyperLogLog(precision uint8) *hyperLogLog {
+	return &hyperLogLog{precision: precision, registers: make([]uint8, 1<<precision)}
+}
+
+func (h *hyperLogLog) Add(item string) {
+	x := hash64(item)
+	index := x >> (64 - h.precision)
+	rank := uint8(bits.LeadingZeros64(x<<h.precision|1<<(h.precision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+func (h *hyperLogLog) Estimate() uint64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	switch len(h.registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	}
+	estimate := alpha * m * m / sum
+	// Linear counting is more accurate for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// heavyHitter is a tracked top-N candidate
+type heavyHitter struct {
+	domain   string
+	estimate uint64
+	emails   *hyperLogLog
+	index    int
+}
+
+// heavyHitters keeps the N domains with the largest estimates in a min-heap
+type heavyHitters struct {
+	n         int
+	precision uint8
+	items     []*heavyHitter
+	byDomain  map[string]*heavyHitter
+}
+
+func newHeavyHitters(n int, precision uint8) *heavyHitters {
+	// Per-domain email sketches use a smaller precision to bound memory
+	if precision > 10 {
+		precision = 10
+	}
+	return &heavyHitters{n: n, precision: precision, byDomain: make(map[string]*heavyHitter, n)}
+}
+
+func (h *heavyHitters) Len() int           { return len(h.items) }
+func (h *heavyHitters) Less(i, j int) bool { return h.items[i].estimate < h.items[j].estimate }
+func (h *heavyHitters) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+func (h *heavyHitters) Push(x interface{}) {
+	item := x.(*heavyHitter)
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+func (h *heavyHitters) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// Offer records the latest estimate for a domain and one of its emails
+func (h *heavyHitters) Offer(domain string, estimate uint64, email string) {
+	if item, ok := h.byDomain[domain]; ok {
+		item.estimate = estimate
+		item.emails.Add(email)
+		heap.Fix(h, item.index)
+		return
+	}
+	if len(h.items) >= h.n {
+		if estimate <= h.items[0].estimate {
+			return
+		}
+		evicted := heap.Pop(h).(*heavyHitter)
+		delete(h.byDomain, evicted.domain)
+	}
+	item := &heavyHitter{domain: domain, estimate: estimate, emails: newHyperLogLog(h.precision)}
+	item.emails.Add(email)
+	h.byDomain[domain] = item
+	heap.Push(h, item)
+}
+
+// Sorted returns the tracked domains by estimate, descending, alphabetical for ties
+func (h *heavyHitters) Sorted() []ApproximateDomain {
+	result := make([]ApproximateDomain, len(h.items))
+	for i, item := range h.items {
+		result[i] = ApproximateDomain{Domain: item.domain, Count: item.estimate, DistinctEmails: item.emails.Estimate()}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count == result[j].Count {
+			return result[i].Domain < result[j].Domain
+		}
+		return result[i].Count > result[j].Count
+	})
+	return result
+}
@@ -0,0 +1,144 @@
+package customerimporter
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+// exactCustomerCounts computes exact per-domain rows and distinct emails
+func exactCustomerCounts(t *testing.T, inputFile string) (map[string]int, map[string]map[string]bool, int) {
+	t.Helper()
+	file, err := os.Open(inputFile)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", inputFile, err)
+	}
+	defer file.Close()
+
+	counts := make(map[string]int)
+	emails := make(map[string]map[string]bool)
+	rows, _, err := NewRun(RunConfig{}).streamCSVDomains(file, func(_ int, domain string, record Record) {
+		counts[domain]++
+		if emails[domain] == nil {
+			emails[domain] = make(map[string]bool)
+		}
+		emails[domain][normaliseEmail(record.Email)] = true
+	})
+	if err != nil {
+		t.Fatalf("streamCSVDomains() returned an error: %v", err)
+	}
+	return counts, emails, rows
+}
+
+func TestProcessApproximate_Accuracy(t *testing.T) {
+	const inputFile = "../customers.csv"
+	counts, emails, rows := exactCustomerCounts(t, inputFile)
+
+	file, err := os.Open(inputFile)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", inputFile, err)
+	}
+	defer file.Close()
+
+	config := ApproximateConfig{TopN: 10, Epsilon: 0.001, Delta: 0.01, HLLPrecision: 14}
+	result, err := ProcessApproximate(file, config)
+	if err != nil {
+		t.Fatalf("ProcessApproximate() returned an error: %v", err)
+	}
+	if result.Rows != rows {
+		t.Errorf("ProcessApproximate() Rows = %d; want %d", result.Rows, rows)
+	}
+
+	// Every estimate lies within the Count-Min bound of the exact count
+	if len(result.TopDomains) != config.TopN {
+		t.Fatalf("ProcessApproximate() returned %d top domains; want %d", len(result.TopDomains), config.TopN)
+	}
+	bound := result.CountErrorBound()
+	for _, d := range result.TopDomains {
+		exact := counts[d.Domain]
+		if int(d.Count) < exact || float64(d.Count) > float64(exact)+bound {
+			t.Errorf("estimate for %s = %d; want within [%d, %.0f]", d.Domain, d.Count, exact, float64(exact)+bound)
+		}
+		if int(d.DistinctEmails) > len(emails[d.Domain])+1 {
+			t.Errorf("distinct emails for %s = %d; exact is %d", d.Domain, d.DistinctEmails, len(emails[d.Domain]))
+		}
+	}
+
+	// The most frequent domain is always reported first
+	best := ""
+	for domain, count := range counts {
+		if best == "" || count > counts[best] || (count == counts[best] && domain < best) {
+			best = domain
+		}
+	}
+	if result.TopDomains[0].Domain != best {
+		t.Errorf("top domain = %s; want %s", result.TopDomains[0].Domain, best)
+	}
+
+	// Distinct counts stay within three standard errors
+	distinctEmails := 0
+	for _, set := range emails {
+		distinctEmails += len(set)
+	}
+	tolerance := 3 * result.DistinctErrorRate()
+	checkRelative(t, "distinct domains", result.DistinctDomains, len(counts), tolerance)
+	checkRelative(t, "distinct emails", result.DistinctEmails, distinctEmails, tolerance)
+
+	if !strings.Contains(result.Summary(), "standard error") {
+		t.Errorf("Summary() = %q; want error bounds", result.Summary())
+	}
+}
+
+func checkRelative(t *testing.T, name string, estimate uint64, exact int, tolerance float64) {
+	t.Helper()
+	if math.Abs(float64(estimate)-float64(exact)) > tolerance*float64(exact) {
+		t.Errorf("%s = %d; want %d ± %.1f%%", name, estimate, exact, 100*tolerance)
+	}
+}
+
+func TestHyperLogLog_LargeCardinality(t *testing.T) {
+	hll := newHyperLogLog(12)
+	const n = 200000
+	for i := 0; i < n; i++ {
+		hll.Add(fmt.Sprintf("user%d@example.com", i))
+		hll.Add(fmt.Sprintf("user%d@example.com", i)) // Duplicates do not count
+	}
+	checkRelative(t, "hyperLogLog estimate", hll.Estimate(), n, 3*1.04/math.Sqrt(4096))
+}
+
+func TestCountMinSketch_NeverUnderestimates(t *testing.T) {
+	sketch := newCountMinSketch(0.01, 0.01)
+	exact := make(map[string]uint64)
+	for i := 0; i < 20000; i++ {
+		domain := fmt.Sprintf("domain%d.com", i%(1+i%97))
+		exact[domain]++
+		sketch.Add(domain)
+	}
+	for domain, count := range exact {
+		if estimate := sketch.Add(domain) - 1; estimate < count {
+			t.Errorf("countMinSketch estimate for %s = %d; want at least %d", domain, estimate, count)
+		}
+	}
+}
+
+func TestApproximateConfig_Validate(t *testing.T) {
+	tests := []struct {
+		config  ApproximateConfig
+		wantErr bool
+	}{
+		{DefaultApproximateConfig(), false},
+		{ApproximateConfig{TopN: 0, Epsilon: 0.01, Delta: 0.01, HLLPrecision: 14}, true},
+		{ApproximateConfig{TopN: 5, Epsilon: 0, Delta: 0.01, HLLPrecision: 14}, true},
+		{ApproximateConfig{TopN: 5, Epsilon: 0.01, Delta: 1, HLLPrecision: 14}, true},
+		{ApproximateConfig{TopN: 5, Epsilon: 0.01, Delta: 0.01, HLLPrecision: 3}, true},
+	}
+
+	for _, test := range tests {
+		err := test.config.validate()
+		if (err != nil) != test.wantErr {
+			t.Errorf("validate(%+v) error = %v; wantErr %v", test.config, err, test.wantErr)
+		}
+	}
+}
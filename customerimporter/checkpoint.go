@@ -0,0 +1,243 @@
+package customerimporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Processing modes that can checkpoint; a checkpoint only resumes the mode that wrote it
+const (
+	checkpointSingle    = "single-threaded"
+	checkpointStreaming = "concurrent-streaming"
+)
+
+// MinCheckpointInterval is the least time allowed between checkpoints; each
+// one syncs the state file to disk, so saving on every row would stall the import
+const MinCheckpointInterval = time.Second
+
+// minCheckpointInterval is the floor applied to CheckpointConfig.Interval
+var minCheckpointInterval = MinCheckpointInterval
+
+// ErrCheckpointMismatch is returned when resuming from a checkpoint written for
+// a different input file or processing mode
+var ErrCheckpointMismatch = errors.New("checkpoint does not match this run")
+
+// Checkpoint is the saved progress of an import: everything before Offset has
+// been counted into DomainCounts
+type Checkpoint struct {
+	Input        string         `json:"input"` // Absolute path of the input file
+	Size         int64          `json:"size"`
+	ModTime      time.Time      `json:"mod_time"`
+	Mode         string         `json:"mode"`
+	Header       []string       `json:"header"`
+	Offset       int64          `json:"offset"` // Byte offset of the first row not yet counted
+	Row          int            `json:"row"`    // Rows consumed, header included
+	Line         int            `json:"line"`   // Physical lines consumed, header included
+	Valid        int            `json:"valid"`
+	Skipped      int            `json:"skipped"`
+	DomainCounts map[string]int `json:"domain_counts"`
+	Saved        time.Time      `json:"saved"`
+}
+
+// CheckpointConfig controls checkpointing
+type CheckpointConfig struct {
+	File     string        // State file; empty disables checkpointing
+	Interval time.Duration // Least time between checkpoints; raised to MinCheckpointInterval if shorter
+	Resume   bool          // Continue from File when it holds a checkpoint for the same input
+}
+
+// checkpointer saves the progress of one run. A nil *checkpointer is valid
+// and does nothing, so readers need no checks when checkpointing is off.
+type checkpointer struct {
+	config  CheckpointConfig
+	base    Checkpoint // Progress restored on resume; zero for a fresh run
+	resumed bool
+	last    time.Time
+
+	// Concurrent-streaming mode: counts are merged by collectors, so a
+	// checkpoint waits for merged before taking a snapshot of counts
+	merged sync.WaitGroup
+	counts *domainCounter
+}
+
+// openCheckpoint starts checkpointing the run over file in mode. When
+// resuming from a matching checkpoint, file is positioned at the checkpoint's
+// offset. It returns nil when checkpointing is off.
+func (r *Run) openCheckpoint(file *os.File, mode string) (*checkpointer, error) {
+	config := r.config.Checkpoint
+	if config.File == "" {
+		return nil, nil
+	}
+	config.Interval = max(config.Interval, minCheckpointInterval)
+	c := &checkpointer{config: config, last: time.Now()}
+	identity, err := checkpointIdentity(file, mode)
+	if err != nil {
+		return nil, err
+	}
+	c.base = identity
+	if !config.Resume {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(config.File)
+	if os.IsNotExist(err) {
+		logger.Info("no checkpoint to resume from; starting from the beginning", "checkpoint", config.File)
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading checkpoint: %w", err)
+	}
+	var saved Checkpoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("error parsing checkpoint %s: %w", config.File, err)
+	}
+	switch {
+	case saved.Input != identity.Input || saved.Size != identity.Size || !saved.ModTime.Equal(identity.ModTime):
+		return nil, fmt.Errorf("%w: written for %s (%d bytes), input is %s (%d bytes)", ErrCheckpointMismatch, saved.Input, saved.Size, identity.Input, identity.Size)
+	case saved.Mode != mode:
+		return nil, fmt.Errorf("%w: written by %s mode, running %s mode", ErrCheckpointMismatch, saved.Mode, mode)
+	}
+	if _, err := file.Seek(saved.Offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error seeking to checkpoint: %w", err)
+	}
+	c.base, c.resumed = saved, true
+	logger.Info("resuming from checkpoint", "checkpoint", config.File, "offset", saved.Offset, "row", saved.Row, "saved", saved.Saved)
+	return c, nil
+}
+
+// checkpointIdentity describes file so a checkpoint can be matched to it
+func checkpointIdentity(file *os.File, mode string) (Checkpoint, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("error reading input file: %w", err)
+	}
+	path, err := filepath.Abs(file.Name())
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("error resolving input path: %w", err)
+	}
+	return Checkpoint{Input: path, Size: info.Size(), ModTime: info.ModTime().UTC(), Mode: mode}, nil
+}
+
+// Resumed returns the restored progress and whether the run is resuming
+func (c *checkpointer) Resumed() (Checkpoint, bool) {
+	if c == nil {
+		return Checkpoint{}, false
+	}
+	return c.base, c.resumed
+}
+
+// Reader configures a CSV reader over the rest of a resumed file, which has
+// no header row to fix the field count
+func (c *checkpointer) Reader(reader *csv.Reader) {
+	if c != nil && c.resumed {
+		reader.FieldsPerRecord = len(c.base.Header)
+	}
+}
+
+// Due reports whether the interval since the last checkpoint has passed
+func (c *checkpointer) Due() bool {
+	return c != nil && time.Since(c.last) >= c.config.Interval
+}
+
+// Save writes progress to the state file under a temporary name and renames
+// it, so an interrupted write never replaces the previous checkpoint
+func (c *checkpointer) Save(progress Checkpoint) error {
+	if c == nil {
+		return nil
+	}
+	state := c.base
+	state.Header = progress.Header
+	state.Offset, state.Row, state.Line = progress.Offset, progress.Row, progress.Line
+	state.Valid, state.Skipped = progress.Valid, progress.Skipped
+	state.DomainCounts = progress.DomainCounts
+	state.Saved = time.Now().UTC()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error encoding checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.config.File), ".checkpoint-*")
+	if err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	// Sync so the rename never publishes a file whose data is still in flight
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.config.File); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	c.last = time.Now()
+	logger.Debug("checkpoint saved", "offset", state.Offset, "row", state.Row)
+	return nil
+}
+
+// Finish removes the state file once the run has completed
+func (c *checkpointer) Finish() {
+	if c == nil {
+		return
+	}
+	if err := os.Remove(c.config.File); err != nil && !os.IsNotExist(err) {
+		logger.Warn("unable to remove checkpoint", "checkpoint", c.config.File, "error", err)
+	}
+}
+
+// TrackCounts sets the counter that concurrent-streaming checkpoints snapshot
+func (c *checkpointer) TrackCounts(counts *domainCounter) {
+	if c != nil {
+		c.counts = counts
+	}
+}
+
+// SaveStreaming waits for every dispatched chunk to be merged, then saves the
+// counts with the offset reached. rows counts data rows, resumed ones included.
+func (c *checkpointer) SaveStreaming(header []string, offset int64, row, rows int) error {
+	c.merged.Wait()
+	counts := c.counts.Snapshot()
+	valid := countValid(counts)
+	return c.Save(Checkpoint{Header: header, Offset: offset, Row: row, Valid: valid, Skipped: rows - valid, DomainCounts: counts})
+}
+
+// pendingMerges returns the group tracking chunks not yet merged, or nil when
+// checkpointing is off
+func (c *checkpointer) pendingMerges() *sync.WaitGroup {
+	if c == nil {
+		return nil
+	}
+	return &c.merged
+}
+
+// recordEndLine returns the line, relative to the reader's start, on which the
+// record just read ends, allowing for newlines inside quoted fields
+func recordEndLine(reader *csv.Reader, fields []string) int {
+	if len(fields) == 0 {
+		return 0
+	}
+	last := len(fields) - 1
+	line, _ := reader.FieldPos(last)
+	return line + strings.Count(fields[last], "\n")
+}
+
+// mergeCounts adds counts into total
+func mergeCounts(total, counts map[string]int) {
+	for domain, count := range counts {
+		total[domain] += count
+	}
+}
@@ -0,0 +1,182 @@
+package customerimporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkpointTestData returns a CSV with rows data rows spread over a few
+// domains, an invalid email every badEvery rows and a multi-line quoted field
+func checkpointTestData(rows, badEvery int) string {
+	var data strings.Builder
+	data.WriteString("first_name,last_name,email,gender,ip_address\n")
+	for i := 1; i <= rows; i++ {
+		switch {
+		case i%badEvery == 0:
+			fmt.Fprintf(&data, "Bad,Row,not-an-email-%d,Male,1.1.1.1\n", i)
+		case i == 7:
+			fmt.Fprintf(&data, "\"Multi\nLine\",Row,user%d@example.org,Female,1.1.1.1\n", i)
+		default:
+			fmt.Fprintf(&data, "User,%d,user%d@domain%d.com,Female,1.1.1.1\n", i, i, i%5)
+		}
+	}
+	return data.String()
+}
+
+// useCheckpoints returns settings checkpointing to a temporary state file,
+// lifting the interval floor for the test so every row is a checkpoint
+// opportunity
+func useCheckpoints(t *testing.T, resume bool) CheckpointConfig {
+	t.Helper()
+	minCheckpointInterval = 0
+	t.Cleanup(func() { minCheckpointInterval = MinCheckpointInterval })
+	return CheckpointConfig{File: filepath.Join(t.TempDir(), "import.checkpoint"), Resume: resume}
+}
+
+func TestCheckpoint_MinimumInterval(t *testing.T) {
+	input := writeStrictTestFile(t, checkpointTestData(10, 11))
+
+	run := NewRun(RunConfig{Checkpoint: CheckpointConfig{File: filepath.Join(t.TempDir(), "import.checkpoint")}})
+	cp, err := run.openCheckpoint(input, checkpointSingle)
+	if err != nil {
+		t.Fatalf("openCheckpoint() returned an error: %v", err)
+	}
+	if cp.config.Interval != MinCheckpointInterval {
+		t.Errorf("interval = %s; want it raised to %s", cp.config.Interval, MinCheckpointInterval)
+	}
+	if cp.Due() {
+		t.Error("Due() = true straight after opening; want false until the minimum interval has passed")
+	}
+}
+
+func readCheckpoint(t *testing.T, state string) Checkpoint {
+	t.Helper()
+	data, err := os.ReadFile(state)
+	if err != nil {
+		t.Fatalf("unable to read checkpoint: %v", err)
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		t.Fatalf("unable to parse checkpoint: %v", err)
+	}
+	return checkpoint
+}
+
+func TestCheckpoint_ProcessResume(t *testing.T) {
+	policy := &RecordCountPolicy{Action: PolicyFail}
+	input := writeStrictTestFile(t, checkpointTestData(50, 30))
+	output := filepath.Join(t.TempDir(), "output.txt")
+	expected, err := NewRun(RunConfig{CountPolicy: policy}).Process(input.Name(), output)
+	if err != nil {
+		t.Fatalf("Process() returned an error: %v", err)
+	}
+
+	// Strict mode stops at the invalid email on row 30, leaving a checkpoint
+	config := useCheckpoints(t, false)
+	_, err = NewRun(RunConfig{Strict: true, CountPolicy: policy, Checkpoint: config}).Process(input.Name(), output)
+	if err == nil {
+		t.Fatalf("Process() in strict mode did not return an error")
+	}
+	checkpoint := readCheckpoint(t, config.File)
+	if checkpoint.Mode != checkpointSingle || checkpoint.Row != 30 || checkpoint.Line != 31 || checkpoint.Valid != 29 {
+		t.Errorf("checkpoint = mode %s, row %d, line %d, valid %d; want %s, 30, 31, 29", checkpoint.Mode, checkpoint.Row, checkpoint.Line, checkpoint.Valid, checkpointSingle)
+	}
+
+	config.Resume = true
+	result, err := NewRun(RunConfig{CountPolicy: policy, Checkpoint: config}).Process(input.Name(), output)
+	if err != nil {
+		t.Fatalf("Process() resuming returned an error: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Process() resumed = %v; want %v", result, expected)
+	}
+	if _, err := os.Stat(config.File); !os.IsNotExist(err) {
+		t.Errorf("Process() left the checkpoint behind after completing: %v", err)
+	}
+}
+
+func TestCheckpoint_ConcurrentStreamingResume(t *testing.T) {
+	rows := 2*ChunkSize + 500
+	input := writeStrictTestFile(t, checkpointTestData(rows, 97))
+	expected, err := ProcessWithConcurrentStreaming(input)
+	if err != nil {
+		t.Fatalf("ProcessWithConcurrentStreaming() returned an error: %v", err)
+	}
+
+	// A record-count policy failure at the end leaves the last chunk's checkpoint
+	config := useCheckpoints(t, false)
+	run := NewRun(RunConfig{CountPolicy: &RecordCountPolicy{MinRecords: rows, Action: PolicyFail}, Checkpoint: config})
+	input.Seek(0, 0)
+	if _, err := run.ProcessWithConcurrentStreaming(input); err == nil {
+		t.Fatalf("ProcessWithConcurrentStreaming() did not return an error")
+	}
+	checkpoint := readCheckpoint(t, config.File)
+	if checkpoint.Mode != checkpointStreaming || checkpoint.Row != 2*ChunkSize+1 || checkpoint.Valid+checkpoint.Skipped != 2*ChunkSize {
+		t.Errorf("checkpoint = mode %s, row %d, %d rows; want %s, %d, %d", checkpoint.Mode, checkpoint.Row, checkpoint.Valid+checkpoint.Skipped, checkpointStreaming, 2*ChunkSize+1, 2*ChunkSize)
+	}
+
+	config.Resume = true
+	run = NewRun(RunConfig{CountPolicy: &RecordCountPolicy{Action: PolicyFail}, Checkpoint: config})
+	input.Seek(0, 0)
+	result, err := run.ProcessWithConcurrentStreaming(input)
+	if err != nil {
+		t.Fatalf("ProcessWithConcurrentStreaming() resuming returned an error: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("ProcessWithConcurrentStreaming() resumed = %v; want %v", result, expected)
+	}
+}
+
+func TestCheckpoint_Mismatch(t *testing.T) {
+	input := writeStrictTestFile(t, checkpointTestData(10, 100))
+	run := NewRun(RunConfig{Checkpoint: useCheckpoints(t, true)})
+	identity, err := checkpointIdentity(input, checkpointSingle)
+	if err != nil {
+		t.Fatalf("checkpointIdentity() returned an error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*Checkpoint)
+	}{
+		{"mode", func(c *Checkpoint) { c.Mode = checkpointStreaming }},
+		{"size", func(c *Checkpoint) { c.Size++ }},
+		{"modified", func(c *Checkpoint) { c.ModTime = c.ModTime.Add(-time.Hour) }},
+		{"input", func(c *Checkpoint) { c.Input = "/elsewhere/customers.csv" }},
+	}
+
+	for _, test := range tests {
+		saved := identity
+		test.change(&saved)
+		data, _ := json.Marshal(saved)
+		if err := os.WriteFile(run.config.Checkpoint.File, data, 0o644); err != nil {
+			t.Fatalf("unable to write checkpoint: %v", err)
+		}
+		if _, err := run.openCheckpoint(input, checkpointSingle); !errors.Is(err, ErrCheckpointMismatch) {
+			t.Errorf("openCheckpoint() with a different %s = %v; want %v", test.name, err, ErrCheckpointMismatch)
+		}
+	}
+}
+
+func TestCheckpoint_ResumeWithoutState(t *testing.T) {
+	input := writeStrictTestFile(t, checkpointTestData(10, 100))
+	run := NewRun(RunConfig{Checkpoint: useCheckpoints(t, true)})
+	cp, err := run.openCheckpoint(input, checkpointSingle)
+	if err != nil {
+		t.Fatalf("openCheckpoint() returned an error: %v", err)
+	}
+	if _, resumed := cp.Resumed(); resumed {
+		t.Errorf("openCheckpoint() without a state file resumed")
+	}
+
+	if cp, err := NewRun(RunConfig{}).openCheckpoint(input, checkpointSingle); cp != nil || err != nil {
+		t.Errorf("openCheckpoint() with checkpointing off = %v, %v; want nil, nil", cp, err)
+	}
+}
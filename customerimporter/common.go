@@ -2,7 +2,6 @@ package customerimporter
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"regexp"
 	"sort"
@@ -26,18 +25,18 @@ type Record struct {
 }
 
 // Regex pattern for validating email domains
-var domainRegex = regexp.MustCompile(`^[a-zA-Z0-9-]+\.[a-zA-Z]{2,}$`)
+var domainRegex = regexp.MustCompile(`^(?:[a-zA-Z0-9-]+\.)+[a-zA-Z]{2,}$`)
 
 // Enhanced extractDomain with regex validation
 func extractDomain(email string) string {
 	at := strings.Index(email, "@")
 	if at == -1 {
-		log.Printf("Invalid email address (missing '@'): %s", email)
+		logger.Debug("invalid email address: missing '@'", "email", email)
 		return ""
 	}
 	domain := email[at+1:]
 	if !domainRegex.MatchString(domain) {
-		log.Printf("Invalid email domain: %s", domain)
+		logger.Debug("invalid email domain", "domain", domain)
 		return ""
 	}
 	return domain
@@ -57,29 +56,38 @@ func createRecord(fields []string) (Record, error) {
 }
 
 func validateRecordCounts(records []Record, minRecords, maxRecords int) error {
-	if len(records) == NoRecords {
-		return fmt.Errorf("no records found in file")
+	return checkRecordCount(len(records), minRecords, maxRecords)
+}
+
+func checkRecordCount(count, minRecords, maxRecords int) error {
+	if count == NoRecords {
+		return ErrNoRecords
 	}
-	if len(records) > maxRecords {
-		return fmt.Errorf("too many records in file: %d", len(records))
+	if count > maxRecords {
+		return fmt.Errorf("%w: %d", ErrTooManyRecords, count)
 	}
-	if len(records) < minRecords {
-		return fmt.Errorf("too few records in file: %d", len(records))
+	if count < minRecords {
+		return fmt.Errorf("%w: %d", ErrTooFewRecords, count)
 	}
 	return nil
 }
 
 // Email Domain Processing
 func countEmailDomains(records []Record) map[string]int {
+	return NewRun(RunConfig{}).countEmailDomains(records)
+}
+
+// countEmailDomains is countEmailDomains under the run's provider rules
+func (r *Run) countEmailDomains(records []Record) map[string]int {
 	domainCounts := make(map[string]int, len(records)/2)
 
 	for _, record := range records {
 		domain := extractDomain(record.Email)
 		if domain == "" {
-			log.Printf("Skipping record with invalid email: %s", record.Email)
+			r.logSkip(reasonInvalidDomain, "email", record.Email)
 			continue
 		}
-		domainCounts[domain]++
+		domainCounts[r.providers.canonicalDomain(domain)]++
 	}
 
 	return domainCounts
@@ -112,14 +120,14 @@ func writeOutput(sortedDomains []string, outputFileName string) error {
 	// Create or overwrite the output file
 	file, err := os.Create(outputFileName)
 	if err != nil {
-		return fmt.Errorf("error creating output file: %v", err)
+		return fmt.Errorf("error creating output file: %w", err)
 	}
 	defer file.Close()
 
 	// Write sorted domains to the file
 	for _, domain := range sortedDomains {
 		if _, err := file.WriteString(fmt.Sprintf("%s\n", domain)); err != nil {
-			return fmt.Errorf("error writing to output file: %v", err)
+			return fmt.Errorf("error writing to output file: %w", err)
 		}
 	}
 
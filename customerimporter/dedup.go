@@ -0,0 +1,370 @@
+package customerimporter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default minimum pair confidence for two records to be linked as one customer
+const DefaultDedupThreshold = 0.85
+
+// Blocks larger than this are split further by name prefix to keep pairwise
+// comparison tractable for very large domains
+const maxBlockSize = 2000
+
+// Weights of the similarity signals combined into a pair confidence
+const (
+	firstNameWeight = 0.35
+	lastNameWeight  = 0.35
+	emailWeight     = 0.3
+)
+
+// Name similarities at or below this Jaro-Winkler score count as disagreement;
+// short distinct names such as "john" and "jane" still score around 0.7
+const nameSimilarityFloor = 0.6
+
+// ClusterMember is one record of a probable-duplicate cluster
+type ClusterMember struct {
+	Row    int // 1-based CSV record number, header included; a field spanning lines counts once
+	Record Record
+}
+
+// CustomerCluster groups records that probably describe the same person
+type CustomerCluster struct {
+	Members    []ClusterMember
+	Confidence float64 // Lowest confidence among the links that formed the cluster
+}
+
+// Common nicknames mapped to a canonical given name
+var nicknames = map[string]string{
+	"jon": "john", "johnny": "john", "jack": "john",
+	"bill": "william", "billy": "william", "will": "william", "willy": "william", "liam": "william",
+	"bob": "robert", "bobby": "robert", "rob": "robert", "robbie": "robert", "bert": "robert",
+	"jim": "james", "jimmy": "james", "jamie": "james",
+	"mike": "michael", "mick": "michael", "mikey": "michael",
+	"dave": "david", "davy": "david",
+	"dan": "daniel", "danny": "daniel",
+	"chris": "christopher", "kit": "christopher",
+	"matt": "matthew", "tom": "thomas", "tommy": "thomas",
+	"rick": "richard", "dick": "richard", "rich": "richard",
+	"steve": "stephen", "steven": "stephen",
+	"tony": "anthony", "joe": "joseph", "joey": "joseph",
+	"sam": "samuel", "alex": "alexander", "andy": "andrew", "drew": "andrew",
+	"ben": "benjamin", "greg": "gregory", "nick": "nicholas", "ed": "edward", "ted": "edward",
+	"fred": "frederick", "harry": "henry", "hank": "henry", "larry": "lawrence",
+	"liz": "elizabeth", "beth": "elizabeth", "betty": "elizabeth", "lizzie": "elizabeth", "eliza": "elizabeth",
+	"kate": "katherine", "katie": "katherine", "kathy": "katherine", "catherine": "katherine",
+	"peggy": "margaret", "maggie": "margaret", "meg": "margaret",
+	"sue": "susan", "susie": "susan", "jenny": "jennifer", "jen": "jennifer",
+	"patty": "patricia", "trish": "patricia", "debbie": "deborah", "deb": "deborah",
+	"becky": "rebecca", "vicky": "victoria", "abby": "abigail", "mandy": "amanda",
+}
+
+// dedupCandidate is a record prepared for comparison
+type dedupCandidate struct {
+	member   ClusterMember
+	first    string // Lowercased, canonical given name
+	rawFirst string // Lowercased given name as written
+	last     string
+	local    string // Email local part without separators, tags or digits
+	blockKey string
+}
+
+// newDedupCandidate prepares record with its email normalised under p
+func (p providerIndex) newDedupCandidate(row int, record Record) dedupCandidate {
+	email := p.normaliseEmail(record.Email)
+	local, domain := email, ""
+	if at := strings.LastIndex(email, "@"); at != -1 {
+		local, domain = email[:at], email[at+1:]
+	}
+	if plus := strings.Index(local, "+"); plus != -1 {
+		local = local[:plus]
+	}
+	rawFirst := nameKey(record.FirstName)
+	first := rawFirst
+	if canonical, ok := nicknames[first]; ok {
+		first = canonical
+	}
+	return dedupCandidate{
+		member:   ClusterMember{Row: row, Record: record},
+		first:    first,
+		rawFirst: rawFirst,
+		last:     nameKey(record.LastName),
+		local:    lettersOnly(local),
+		blockKey: domain,
+	}
+}
+
+// nameKey lowercases a name and drops everything but letters
+func nameKey(name string) string {
+	return lettersOnly(strings.ToLower(strings.TrimSpace(name)))
+}
+
+func lettersOnly(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 'a' && r <= 'z' || r > 127 {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// FindDuplicateCustomers blocks records by email domain, scores every pair
+// within a block on name and email similarity and joins pairs scoring at
+// least threshold into clusters. Only clusters with two or more members are returned.
+func FindDuplicateCustomers(members []ClusterMember, threshold float64) []CustomerCluster {
+	return NewRun(RunConfig{}).FindDuplicateCustomers(members, threshold)
+}
+
+// FindDuplicateCustomers is the package-level FindDuplicateCustomers with
+// emails normalised under the run's provider rules
+func (r *Run) FindDuplicateCustomers(members []ClusterMember, threshold float64) []CustomerCluster {
+	blocks := make(map[string][]dedupCandidate)
+	for _, member := range members {
+		candidate := r.providers.newDedupCandidate(member.Row, member.Record)
+		blocks[candidate.blockKey] = append(blocks[candidate.blockKey], candidate)
+	}
+
+	var clusters []CustomerCluster
+	for _, block := range blocks {
+		for _, part := range splitBlock(block, 1) {
+			clusters = append(clusters, clusterBlock(part, threshold)...)
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Members[0].Row < clusters[j].Members[0].Row
+	})
+	return clusters
+}
+
+// splitBlock divides a block larger than maxBlockSize by the first n bytes of
+// the last and first names, lengthening the prefix until every part fits.
+// Candidates the names cannot tell apart are cut into consecutive parts.
+func splitBlock(block []dedupCandidate, n int) [][]dedupCandidate {
+	if len(block) <= maxBlockSize {
+		return [][]dedupCandidate{block}
+	}
+	parts := make(map[string][]dedupCandidate)
+	exhausted := true
+	for _, candidate := range block {
+		key := candidate.last + " " + candidate.first
+		if len(key) > n {
+			key, exhausted = key[:n], false
+		}
+		parts[key] = append(parts[key], candidate)
+	}
+
+	var split [][]dedupCandidate
+	if exhausted {
+		for start := 0; start < len(block); start += maxBlockSize {
+			split = append(split, block[start:min(start+maxBlockSize, len(block))])
+		}
+		return split
+	}
+	for _, part := range parts {
+		split = append(split, splitBlock(part, n+1)...)
+	}
+	return split
+}
+
+// clusterBlock links matching pairs in one block with union-find
+func clusterBlock(block []dedupCandidate, threshold float64) []CustomerCluster {
+	parent := make([]int, len(block))
+	confidence := make([]float64, len(block))
+	for i := range parent {
+		parent[i] = i
+		confidence[i] = 1
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := 0; i < len(block); i++ {
+		for j := i + 1; j < len(block); j++ {
+			score := matchScore(block[i], block[j])
+			if score < threshold {
+				continue
+			}
+			ri, rj := find(i), find(j)
+			if ri == rj {
+				// Already linked, so this pair says nothing about the weakest link
+				continue
+			}
+			parent[rj] = ri
+			confidence[ri] = min(score, confidence[ri], confidence[rj])
+		}
+	}
+
+	groups := make(map[int][]ClusterMember)
+	for i := range block {
+		root := find(i)
+		groups[root] = append(groups[root], block[i].member)
+	}
+	var clusters []CustomerCluster
+	for root, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(a, b int) bool { return group[a].Row < group[b].Row })
+		clusters = append(clusters, CustomerCluster{Members: group, Confidence: confidence[root]})
+	}
+	return clusters
+}
+
+// matchScore is the weighted similarity of two records, from 0 to 1
+func matchScore(a, b dedupCandidate) float64 {
+	first := nameSimilarity(a.first, b.first)
+	if len(a.rawFirst) == 1 || len(b.rawFirst) == 1 {
+		// An initial agrees with any name starting with the same letter
+		if a.rawFirst != "" && b.rawFirst != "" && a.rawFirst[0] == b.rawFirst[0] {
+			first = 0.9
+		}
+	}
+	last := nameSimilarity(a.last, b.last)
+	return firstNameWeight*first + lastNameWeight*last + emailWeight*emailScore(a, b)
+}
+
+// nameSimilarity rescales Jaro-Winkler so clearly different names score 0
+func nameSimilarity(a, b string) float64 {
+	score := (jaroWinkler(a, b) - nameSimilarityFloor) / (1 - nameSimilarityFloor)
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// emailScore compares local parts, recognising that "jsmith" and "john.smith"
+// are both plausible addresses for John Smith
+func emailScore(a, b dedupCandidate) float64 {
+	if a.local == b.local && a.local != "" {
+		return 1
+	}
+	// Both addresses derive from the same person's name
+	for _, c := range []dedupCandidate{a, b} {
+		for _, first := range []string{c.first, c.rawFirst} {
+			if localMatchesName(a.local, first, c.last) && localMatchesName(b.local, first, c.last) {
+				return 0.9
+			}
+		}
+	}
+	return jaroWinkler(a.local, b.local)
+}
+
+// localMatchesName reports whether an email local part follows a common
+// pattern built from a given and family name
+func localMatchesName(local, first, last string) bool {
+	if first == "" || last == "" {
+		return false
+	}
+	switch local {
+	case first + last, last + first, first[:1] + last, first + last[:1], last + first[:1], first[:1] + last[:1]:
+		return true
+	}
+	return false
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of two strings
+func jaroWinkler(a, b string) float64 {
+	if a == b {
+		if a == "" {
+			return 0
+		}
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	window := max(len(ra), len(rb))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		lo, hi := max(0, i-window), min(len(rb)-1, i+window)
+		for j := lo; j <= hi; j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// readClusterMembers reads every valid row with its line number
+func (r *Run) readClusterMembers(input io.Reader) ([]ClusterMember, error) {
+	var members []ClusterMember
+	_, _, err := r.streamCSVDomains(input, func(rowNumber int, _ string, record Record) {
+		members = append(members, ClusterMember{Row: rowNumber, Record: record})
+	})
+	return members, err
+}
+
+// writeClustersReport writes one CSV line per cluster member
+func writeClustersReport(clusters []CustomerCluster, outputFileName string) error {
+	file, err := os.Create(outputFileName)
+	if err != nil {
+		return fmt.Errorf("error creating dedup report: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"cluster", "confidence", "row", "first_name", "last_name", "email"})
+	for i, cluster := range clusters {
+		for _, member := range cluster.Members {
+			writer.Write([]string{
+				strconv.Itoa(i + 1),
+				strconv.FormatFloat(cluster.Confidence, 'f', 3, 64),
+				strconv.Itoa(member.Row),
+				member.Record.FirstName,
+				member.Record.LastName,
+				member.Record.Email,
+			})
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing dedup report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package customerimporter
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJaroWinkler(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected float64
+	}{
+		{"martha", "marhta", 0.961},
+		{"dwayne", "duane", 0.840},
+		{"dixon", "dicksonx", 0.813},
+		{"smith", "smith", 1},
+		{"abc", "xyz", 0},
+		{"", "", 0},
+	}
+
+	for _, test := range tests {
+		result := jaroWinkler(test.a, test.b)
+		if math.Abs(result-test.expected) > 0.001 {
+			t.Errorf("jaroWinkler(%q, %q) = %.3f; want %.3f", test.a, test.b, result, test.expected)
+		}
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	candidate := func(first, last, email string) dedupCandidate {
+		return defaultProviders.newDedupCandidate(0, Record{FirstName: first, LastName: last, Email: email})
+	}
+
+	tests := []struct {
+		name      string
+		a, b      dedupCandidate
+		duplicate bool
+	}{
+		{"nickname and initial-surname email", candidate("Jon", "Smith", "jsmith@acme.com"), candidate("John", "Smith", "john.smith@acme.com"), true},
+		{"surname typo", candidate("John", "Smith", "jsmith@acme.com"), candidate("John", "Smyth", "jsmyth@acme.com"), true},
+		{"first initial", candidate("J", "Smith", "j.smith@acme.com"), candidate("John", "Smith", "john.smith@acme.com"), true},
+		{"plus tag", candidate("Bill", "Jones", "bill.jones+news@acme.com"), candidate("William", "Jones", "billjones@acme.com"), true},
+		{"different first names", candidate("John", "Smith", "john.smith@acme.com"), candidate("Jane", "Smith", "jane.smith@acme.com"), false},
+		{"different surnames", candidate("John", "Smith", "john.smith@acme.com"), candidate("John", "Smart", "john.smart@acme.com"), false},
+		{"unrelated", candidate("Alice", "Brown", "abrown@acme.com"), candidate("Peter", "Green", "pgreen@acme.com"), false},
+	}
+
+	for _, test := range tests {
+		score := matchScore(test.a, test.b)
+		if (score >= DefaultDedupThreshold) != test.duplicate {
+			t.Errorf("%s: matchScore() = %.3f; want duplicate = %v", test.name, score, test.duplicate)
+		}
+	}
+}
+
+func TestFindDuplicateCustomers(t *testing.T) {
+	members := []ClusterMember{
+		{Row: 2, Record: Record{FirstName: "Jon", LastName: "Smith", Email: "jsmith@acme.com"}},
+		{Row: 3, Record: Record{FirstName: "Jane", LastName: "Smith", Email: "jane.smith@acme.com"}},
+		{Row: 4, Record: Record{FirstName: "John", LastName: "Smith", Email: "john.smith@acme.com"}},
+		{Row: 5, Record: Record{FirstName: "John", LastName: "Smith", Email: "john.smith@other.com"}}, // Different block
+		{Row: 6, Record: Record{FirstName: "Johnny", LastName: "Smith", Email: "JSmith@Acme.com"}},
+		{Row: 7, Record: Record{FirstName: "Kate", LastName: "Lee", Email: "klee@other.com"}},
+		{Row: 8, Record: Record{FirstName: "Katherine", LastName: "Lee", Email: "katherine.lee@other.com"}},
+	}
+
+	clusters := FindDuplicateCustomers(members, DefaultDedupThreshold)
+	var rows [][]int
+	for _, cluster := range clusters {
+		var clusterRows []int
+		for _, member := range cluster.Members {
+			clusterRows = append(clusterRows, member.Row)
+		}
+		rows = append(rows, clusterRows)
+		if cluster.Confidence < DefaultDedupThreshold || cluster.Confidence > 1 {
+			t.Errorf("cluster %v confidence = %.3f; want between threshold and 1", clusterRows, cluster.Confidence)
+		}
+	}
+
+	expected := [][]int{{2, 4, 6}, {7, 8}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("FindDuplicateCustomers() clusters = %v; want %v", rows, expected)
+	}
+
+	// A run's provider rules decide which domains block together
+	aliased := []ClusterMember{
+		{Row: 2, Record: Record{FirstName: "John", LastName: "Smith", Email: "john.smith@acme.com"}},
+		{Row: 3, Record: Record{FirstName: "John", LastName: "Smith", Email: "john.smith@acme-mail.com"}},
+	}
+	if clusters := FindDuplicateCustomers(aliased, DefaultDedupThreshold); len(clusters) != 0 {
+		t.Errorf("FindDuplicateCustomers() across unrelated domains = %v; want no clusters", clusters)
+	}
+	run := NewRun(RunConfig{Providers: ProviderRules{"acme.com": {Aliases: []string{"acme-mail.com"}}}})
+	if clusters := run.FindDuplicateCustomers(aliased, DefaultDedupThreshold); len(clusters) != 1 {
+		t.Errorf("FindDuplicateCustomers() across alias domains = %v; want one cluster", clusters)
+	}
+}
+
+func TestSplitBlock(t *testing.T) {
+	var block []dedupCandidate
+	for i := 0; i < 3*maxBlockSize; i++ {
+		block = append(block, dedupCandidate{member: ClusterMember{Row: i}, last: "smith", first: "john"})
+	}
+	for i := 0; i < maxBlockSize/2; i++ {
+		block = append(block, dedupCandidate{member: ClusterMember{Row: 3*maxBlockSize + i}, last: "smyth", first: "john"})
+	}
+
+	parts := splitBlock(block, 1)
+	total := 0
+	for _, part := range parts {
+		total += len(part)
+		if len(part) > maxBlockSize {
+			t.Errorf("splitBlock() left a part of %d candidates; want at most %d", len(part), maxBlockSize)
+		}
+		// The names separate smith from smyth; only identical names are cut into parts
+		for _, candidate := range part {
+			if candidate.last != part[0].last {
+				t.Errorf("splitBlock() mixed %q and %q in one part", part[0].last, candidate.last)
+				break
+			}
+		}
+	}
+	if total != len(block) || len(parts) != 4 {
+		t.Errorf("splitBlock() = %d parts of %d candidates; want 4 parts of %d", len(parts), total, len(block))
+	}
+}
+
+func TestReadClusterMembers_QuietRun(t *testing.T) {
+	resetMetrics(t)
+	logs := captureLogs(t, "warn")
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n" +
+		"Bad,Row,not-an-email,Male,3.3.3.3\n"
+
+	// A re-read of imported rows leaves the import's logs and counts alone
+	run := NewRun(RunConfig{})
+	run.quiet = true
+	members, err := run.readClusterMembers(strings.NewReader(data))
+	if err != nil || len(members) != 1 {
+		t.Fatalf("readClusterMembers() = %d members, %v; want 1", len(members), err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("readClusterMembers() logged %q; want nothing", logs.String())
+	}
+	if metrics.rowsRead.Load() != 0 || len(metrics.rejected) != 0 {
+		t.Errorf("readClusterMembers() counted %d rows read and %v rejected; want none", metrics.rowsRead.Load(), metrics.rejected)
+	}
+	if report := run.Rejects(); report.Rejected != 0 {
+		t.Errorf("Rejects() = %+v; want none", report)
+	}
+}
+
+func TestWriteClustersReport(t *testing.T) {
+	members, err := NewRun(RunConfig{}).readClusterMembers(strings.NewReader(duplicateTestData))
+	if err != nil {
+		t.Fatalf("readClusterMembers() returned an error: %v", err)
+	}
+	clusters := FindDuplicateCustomers(members, DefaultDedupThreshold)
+
+	outputFile := filepath.Join(t.TempDir(), "clusters.csv")
+	if err := writeClustersReport(clusters, outputFile); err != nil {
+		t.Fatalf("writeClustersReport() returned an error: %v", err)
+	}
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+
+	expected := "cluster,confidence,row,first_name,last_name,email\n" +
+		"1,1.000,2,John,Doe,john.doe@example.com\n" +
+		"1,1.000,4,John,Doe,John.Doe@Example.com\n" +
+		"2,1.000,3,Jane,Smith,jane@example.com\n" +
+		"2,1.000,8,Jane,Smith,jane@example.com\n"
+	if string(data) != expected {
+		t.Errorf("writeClustersReport() = %q; want %q", string(data), expected)
+	}
+}
@@ -0,0 +1,264 @@
+package customerimporter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exit status of the diff command when differences exceed the threshold;
+// errors exit with 1 as for every other command
+const diffExceededStatus = 2
+
+// Lines the console output prints before the counts
+const (
+	consoleResultsHeader     = "Processing completed. Results:"
+	approximateResultsHeader = "Top domains (approximate):"
+)
+
+// Starts of the summary lines the approximate mode prints to the console
+// before its top domains; see ApproximateResult.Summary
+var approximateSummaryPrefixes = []string{
+	"Approximate summary:",
+	"Domain counts overestimate",
+	"Distinct domains:",
+	"Distinct emails:",
+}
+
+// Prefix of the per-domain samples in OpenMetrics files
+const openMetricsDomainPrefix = `customerimporter_domain_customers{domain="`
+
+// DiffThreshold decides which domain differences are significant. A domain
+// exceeds it when its count changes by more than MaxChange and by more than
+// MaxPercent of the old count; added and removed domains count as 100%. The
+// zero threshold treats every difference as significant.
+type DiffThreshold struct {
+	MaxChange  int
+	MaxPercent float64
+}
+
+// Exceeded reports whether delta is larger than the threshold allows
+func (t DiffThreshold) Exceeded(delta DomainDelta) bool {
+	change := absDelta(delta.Delta)
+	if change == 0 || change <= t.MaxChange {
+		return false
+	}
+	percent := 100.0
+	if delta.Previous != 0 {
+		percent = float64(change) / float64(delta.Previous) * 100
+	}
+	return percent > t.MaxPercent
+}
+
+// DomainDiff compares two sets of domain counts
+type DomainDiff struct {
+	Old, New  map[string]int
+	Changes   []DomainDelta // Added, removed and changed domains, largest change first
+	Added     []string      // Domains only in New, alphabetically
+	Removed   []string      // Domains only in Old, alphabetically
+	Unchanged int
+	Exceeded  int // Changes beyond the threshold
+}
+
+// DiffDomainCounts compares the old and new domain counts under threshold
+func DiffDomainCounts(oldCounts, newCounts map[string]int, threshold DiffThreshold) DomainDiff {
+	comparison := CompareSnapshots(Snapshot{DomainCounts: oldCounts}, Snapshot{DomainCounts: newCounts})
+	diff := DomainDiff{Old: oldCounts, New: newCounts, Changes: comparison.Movers, Added: comparison.Appeared, Removed: comparison.Disappeared}
+	diff.Unchanged = len(newCounts) - len(diff.Changes) + len(diff.Removed)
+	for _, delta := range diff.Changes {
+		if threshold.Exceeded(delta) {
+			diff.Exceeded++
+		}
+	}
+	return diff
+}
+
+// WriteDiff writes diff as a plain-text report naming the compared files
+func WriteDiff(w io.Writer, diff DomainDiff, oldName, newName string, threshold DiffThreshold) error {
+	fmt.Fprintf(w, "--- %s (%d domains, %d rows)\n", oldName, len(diff.Old), countValid(diff.Old))
+	fmt.Fprintf(w, "+++ %s (%d domains, %d rows)\n\n", newName, len(diff.New), countValid(diff.New))
+	if len(diff.Changes) == 0 {
+		_, err := fmt.Fprintln(w, "No differences")
+		return err
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(table, "DOMAIN\tOLD\tNEW\tCHANGE\tPERCENT\t\n")
+	for _, delta := range diff.Changes {
+		mark := ""
+		if threshold.Exceeded(delta) {
+			mark = "!"
+		}
+		fmt.Fprintf(table, "%s\t%d\t%d\t%+d\t%s\t%s\n", delta.Domain, delta.Previous, delta.Current, delta.Delta, growth(delta.Previous, delta.Current), mark)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nAdded domains (%d): %s\n", len(diff.Added), domainList(diff.Added))
+	fmt.Fprintf(w, "Removed domains (%d): %s\n", len(diff.Removed), domainList(diff.Removed))
+	_, err := fmt.Fprintf(w, "%d domains differ, %d unchanged; %d beyond the threshold (marked !)\n", len(diff.Changes), diff.Unchanged, diff.Exceeded)
+	return err
+}
+
+// ReadDomainCountsFile reads the domain counts in a result file
+func ReadDomainCountsFile(fileName string) (map[string]int, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening result file: %w", err)
+	}
+	defer file.Close()
+	counts, err := ReadDomainCounts(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", fileName, err)
+	}
+	return counts, nil
+}
+
+// ReadDomainCounts reads domain counts written in any output format: the
+// "domain: count" text of the processing modes and the console (approximate
+// counts and their summary included), the domain,count CSV and job JSON of
+// the import API, OpenMetrics files, and snapshot or incremental state JSON.
+func ReadDomainCounts(input io.Reader) (map[string]int, error) {
+	reader := bufio.NewReader(input)
+	for {
+		b, err := reader.Peek(1)
+		if err == io.EOF {
+			return map[string]int{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			reader.ReadByte()
+			continue
+		case '{', '[':
+			return readJSONDomainCounts(reader)
+		}
+		return readTextDomainCounts(reader)
+	}
+}
+
+// readJSONDomainCounts reads a job (domains list), a snapshot or state
+// (domain_counts object), a bare list of domain counts or a bare object
+func readJSONDomainCounts(input io.Reader) (map[string]int, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("[")) {
+		var list []DomainCount
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("invalid JSON domain counts: %w", err)
+		}
+		return domainCountsFromList(list)
+	}
+
+	var document struct {
+		Domains      []DomainCount  `json:"domains"`
+		DomainCounts map[string]int `json:"domain_counts"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid JSON domain counts: %w", err)
+	}
+	switch {
+	case document.DomainCounts != nil:
+		return document.DomainCounts, nil
+	case document.Domains != nil:
+		return domainCountsFromList(document.Domains)
+	}
+	var counts map[string]int
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return nil, fmt.Errorf("JSON holds no domain counts: %w", err)
+	}
+	return counts, nil
+}
+
+func domainCountsFromList(list []DomainCount) (map[string]int, error) {
+	counts := make(map[string]int, len(list))
+	for _, dc := range list {
+		if _, ok := counts[dc.Domain]; ok {
+			return nil, fmt.Errorf("domain %s listed twice", dc.Domain)
+		}
+		counts[dc.Domain] = dc.Count
+	}
+	return counts, nil
+}
+
+// readTextDomainCounts reads line-based formats, deciding per line
+func readTextDomainCounts(input io.Reader) (map[string]int, error) {
+	counts := make(map[string]int)
+	scanner := bufio.NewScanner(input)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || isResultsPreamble(line) || (lineNumber == 1 && line == "domain,count") {
+			continue
+		}
+		domain, count, err := parseCountLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if _, ok := counts[domain]; ok {
+			return nil, fmt.Errorf("line %d: domain %s listed twice", lineNumber, domain)
+		}
+		counts[domain] = count
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// isResultsPreamble reports whether line is one the console output prints
+// before the counts
+func isResultsPreamble(line string) bool {
+	if line == consoleResultsHeader || line == approximateResultsHeader {
+		return true
+	}
+	for _, prefix := range approximateSummaryPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCountLine parses one "domain: count" line, optionally followed by an
+// approximate distinct-email estimate, one CSV "domain,count" line or one
+// OpenMetrics domain sample
+func parseCountLine(line string) (string, int, error) {
+	var domain, value string
+	switch {
+	case strings.HasPrefix(line, openMetricsDomainPrefix):
+		end := strings.LastIndex(line, `"}`)
+		if end < len(openMetricsDomainPrefix) {
+			return "", 0, fmt.Errorf("malformed OpenMetrics sample %q", line)
+		}
+		label, err := strconv.Unquote(`"` + line[len(openMetricsDomainPrefix):end] + `"`)
+		if err != nil {
+			return "", 0, fmt.Errorf("malformed OpenMetrics label in %q", line)
+		}
+		domain, value = label, strings.TrimSpace(line[end+2:])
+	case strings.Contains(line, ": "):
+		domain, value, _ = strings.Cut(line, ": ")
+		value, _, _ = strings.Cut(value, " ") // Drops "(~N distinct emails)"
+	case strings.Contains(line, ","):
+		domain, value, _ = strings.Cut(line, ",")
+	default:
+		return "", 0, fmt.Errorf("unrecognised result line %q", line)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || count < 0 {
+		return "", 0, fmt.Errorf("invalid count in %q", line)
+	}
+	return strings.TrimSpace(domain), count, nil
+}
@@ -0,0 +1,156 @@
+package customerimporter
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadDomainCounts(t *testing.T) {
+	expected := map[string]int{"example.com": 3, "another.com": 1}
+
+	var openMetrics bytes.Buffer
+	WriteOpenMetrics(&openMetrics, expected)
+
+	tests := []struct {
+		format string
+		data   string
+	}{
+		{"text", "example.com: 3\nanother.com: 1\n"},
+		{"console", "Processing completed. Results:\nanother.com: 1\nexample.com: 3\n"},
+		{"approximate", "example.com: 3 (~3 distinct emails)\nanother.com: 1 (~1 distinct emails)\n"},
+		{"csv", "domain,count\nexample.com,3\nanother.com,1\n"},
+		{"openmetrics", openMetrics.String()},
+		{"job", `{"id":"abc","state":"succeeded","domains":[{"domain":"example.com","count":3},{"domain":"another.com","count":1}]}`},
+		{"snapshot", `{"id":"20261001T090000.000000Z","domain_counts":{"example.com":3,"another.com":1}}`},
+		{"list", "\n  [{\"domain\":\"example.com\",\"count\":3},{\"domain\":\"another.com\",\"count\":1}]"},
+		{"object", `{"example.com":3,"another.com":1}`},
+	}
+
+	for _, test := range tests {
+		result, err := ReadDomainCounts(strings.NewReader(test.data))
+		if err != nil || !reflect.DeepEqual(result, expected) {
+			t.Errorf("ReadDomainCounts() of %s = %v, %v; want %v", test.format, result, err, expected)
+		}
+	}
+
+	for _, data := range []string{"example.com: 3\nexample.com: 4\n", "example.com: lots\n", "just some text\n", `{"example.com":"three"}`, "example.com: -1\n"} {
+		if _, err := ReadDomainCounts(strings.NewReader(data)); err == nil {
+			t.Errorf("ReadDomainCounts(%q) did not return an error", data)
+		}
+	}
+}
+
+func TestReadDomainCounts_ApproximateConsole(t *testing.T) {
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n" +
+		"Jane,Doe,jane@example.com,Female,2.2.2.2\n" +
+		"Ann,Lee,ann@another.com,Female,3.3.3.3\n"
+	result, err := ProcessApproximate(strings.NewReader(data), DefaultApproximateConfig())
+	if err != nil {
+		t.Fatalf("ProcessApproximate() returned an error: %v", err)
+	}
+
+	// As printed by the CLI when the output is the console
+	console := result.Summary() + approximateResultsHeader + "\n" + strings.Join(result.Lines(), "\n") + "\n"
+	counts, err := ReadDomainCounts(strings.NewReader(console))
+	expected := map[string]int{"example.com": 2, "another.com": 1}
+	if err != nil || !reflect.DeepEqual(counts, expected) {
+		t.Errorf("ReadDomainCounts() of approximate console output = %v, %v; want %v", counts, err, expected)
+	}
+}
+
+func TestReadDomainCounts_OpenMetricsEscapes(t *testing.T) {
+	expected := map[string]int{`odd"domain\.com`: 2}
+	var openMetrics bytes.Buffer
+	WriteOpenMetrics(&openMetrics, expected)
+	result, err := ReadDomainCounts(&openMetrics)
+	if err != nil || !reflect.DeepEqual(result, expected) {
+		t.Errorf("ReadDomainCounts() = %v, %v; want %v", result, err, expected)
+	}
+}
+
+func TestDiffThreshold_Exceeded(t *testing.T) {
+	tests := []struct {
+		threshold DiffThreshold
+		delta     DomainDelta
+		expected  bool
+	}{
+		{DiffThreshold{}, DomainDelta{Previous: 100, Current: 101, Delta: 1}, true},
+		{DiffThreshold{}, DomainDelta{Previous: 100, Current: 100}, false},
+		{DiffThreshold{MaxChange: 5}, DomainDelta{Previous: 100, Current: 95, Delta: -5}, false},
+		{DiffThreshold{MaxChange: 5}, DomainDelta{Previous: 100, Current: 94, Delta: -6}, true},
+		{DiffThreshold{MaxPercent: 10}, DomainDelta{Previous: 100, Current: 110, Delta: 10}, false},
+		{DiffThreshold{MaxPercent: 10}, DomainDelta{Previous: 100, Current: 111, Delta: 11}, true},
+		{DiffThreshold{MaxPercent: 50}, DomainDelta{Previous: 0, Current: 1, Delta: 1}, true},
+		{DiffThreshold{MaxChange: 2, MaxPercent: 50}, DomainDelta{Previous: 0, Current: 2, Delta: 2}, false},
+	}
+
+	for _, test := range tests {
+		if result := test.threshold.Exceeded(test.delta); result != test.expected {
+			t.Errorf("%+v.Exceeded(%+v) = %v; want %v", test.threshold, test.delta, result, test.expected)
+		}
+	}
+}
+
+func TestDiffDomainCounts(t *testing.T) {
+	oldCounts := map[string]int{"example.com": 100, "another.com": 50, "gone.net": 3, "same.org": 7}
+	newCounts := map[string]int{"example.com": 90, "another.com": 51, "new.io": 20, "same.org": 7}
+	diff := DiffDomainCounts(oldCounts, newCounts, DiffThreshold{MaxPercent: 5})
+
+	expectedChanges := []DomainDelta{
+		{Domain: "new.io", Previous: 0, Current: 20, Delta: 20},
+		{Domain: "example.com", Previous: 100, Current: 90, Delta: -10},
+		{Domain: "gone.net", Previous: 3, Current: 0, Delta: -3},
+		{Domain: "another.com", Previous: 50, Current: 51, Delta: 1},
+	}
+	if !reflect.DeepEqual(diff.Changes, expectedChanges) {
+		t.Errorf("DiffDomainCounts() Changes = %v; want %v", diff.Changes, expectedChanges)
+	}
+	if !reflect.DeepEqual(diff.Added, []string{"new.io"}) || !reflect.DeepEqual(diff.Removed, []string{"gone.net"}) {
+		t.Errorf("DiffDomainCounts() = added %v, removed %v; want [new.io], [gone.net]", diff.Added, diff.Removed)
+	}
+	if diff.Unchanged != 1 || diff.Exceeded != 3 {
+		t.Errorf("DiffDomainCounts() = %d unchanged, %d exceeded; want 1, 3", diff.Unchanged, diff.Exceeded)
+	}
+
+	var out bytes.Buffer
+	if err := WriteDiff(&out, diff, "old.txt", "new.txt", DiffThreshold{MaxPercent: 5}); err != nil {
+		t.Fatalf("WriteDiff() returned an error: %v", err)
+	}
+	for _, expected := range []string{
+		"--- old.txt (4 domains, 160 rows)",
+		"+++ new.txt (4 domains, 168 rows)",
+		"example.com  100  90   -10     -10.0%   !",
+		"another.com  50   51   +1      +2.0%",
+		"Added domains (1): new.io",
+		"Removed domains (1): gone.net",
+		"4 domains differ, 1 unchanged; 3 beyond the threshold",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("WriteDiff() report is missing %q:\n%s", expected, out.String())
+		}
+	}
+
+	out.Reset()
+	WriteDiff(&out, DiffDomainCounts(oldCounts, oldCounts, DiffThreshold{}), "a", "b", DiffThreshold{})
+	if !strings.Contains(out.String(), "No differences") {
+		t.Errorf("WriteDiff() of equal counts = %q; want No differences", out.String())
+	}
+}
+
+func TestReadDomainCountsFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "output.txt")
+	if err := writeOutput(sortDomains(map[string]int{"example.com": 2}), file); err != nil {
+		t.Fatalf("writeOutput() returned an error: %v", err)
+	}
+	result, err := ReadDomainCountsFile(file)
+	if err != nil || !reflect.DeepEqual(result, map[string]int{"example.com": 2}) {
+		t.Errorf("ReadDomainCountsFile() = %v, %v; want example.com: 2", result, err)
+	}
+	if _, err := ReadDomainCountsFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Errorf("ReadDomainCountsFile() did not return an error for a missing file")
+	}
+}
@@ -0,0 +1,108 @@
+package customerimporter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DuplicateEmail is a normalised email that appears on more than one row
+type DuplicateEmail struct {
+	Email string
+	Rows  []int // 1-based CSV record numbers, header included; a field spanning lines counts once
+}
+
+// DistinctResult holds row counts and unique-customer counts per domain, both
+// keyed by lowercased domain so that a customer's rows count under one domain
+type DistinctResult struct {
+	RowCounts    map[string]int // Every valid row counts
+	UniqueCounts map[string]int // Each normalised email counts once
+	Duplicates   []DuplicateEmail
+}
+
+// normaliseEmail returns the form used to decide whether two rows are the same
+// customer: lowercased, with the mail provider's canonicalisation rules applied
+func (p providerIndex) normaliseEmail(email string) string {
+	return p.canonicaliseEmail(strings.ToLower(strings.TrimSpace(email)))
+}
+
+// normaliseEmail is providerIndex.normaliseEmail under the default provider rules
+func normaliseEmail(email string) string {
+	return defaultProviders.normaliseEmail(email)
+}
+
+// ProcessDistinct counts rows and distinct customers per domain and reports
+// every email that occurs on more than one row
+func ProcessDistinct(input io.Reader) (DistinctResult, error) {
+	run := NewRun(RunConfig{})
+	defer run.LogSkipSummary()
+	return run.ProcessDistinct(input)
+}
+
+// ProcessDistinct is the package-level ProcessDistinct under the run's settings
+func (r *Run) ProcessDistinct(input io.Reader) (DistinctResult, error) {
+	result := DistinctResult{
+		RowCounts:    make(map[string]int),
+		UniqueCounts: make(map[string]int),
+	}
+	seen := make(map[string][]int)
+
+	processed, skipped, err := r.streamCSVDomains(input, func(rowNumber int, domain string, record Record) {
+		domain = strings.ToLower(domain)
+		result.RowCounts[domain]++
+		key := r.providers.normaliseEmail(record.Email)
+		if _, ok := seen[key]; !ok {
+			result.UniqueCounts[domain]++
+		}
+		seen[key] = append(seen[key], rowNumber)
+	})
+	if err != nil {
+		return DistinctResult{}, err
+	}
+	if err := r.checkStreamingCounts(processed, skipped); err != nil {
+		return DistinctResult{}, err
+	}
+
+	for email, rows := range seen {
+		if len(rows) > 1 {
+			result.Duplicates = append(result.Duplicates, DuplicateEmail{Email: email, Rows: rows})
+		}
+	}
+	// Most repeated first, alphabetically for ties
+	sort.Slice(result.Duplicates, func(i, j int) bool {
+		a, b := result.Duplicates[i], result.Duplicates[j]
+		if len(a.Rows) == len(b.Rows) {
+			return a.Email < b.Email
+		}
+		return len(a.Rows) > len(b.Rows)
+	})
+	return result, nil
+}
+
+// writeDuplicatesReport writes duplicates as CSV: email, occurrences, rows
+func writeDuplicatesReport(duplicates []DuplicateEmail, outputFileName string) error {
+	file, err := os.Create(outputFileName)
+	if err != nil {
+		return fmt.Errorf("error creating duplicates report: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"email", "occurrences", "rows"})
+	for _, dup := range duplicates {
+		rows := make([]string, len(dup.Rows))
+		for i, row := range dup.Rows {
+			rows[i] = strconv.Itoa(row)
+		}
+		writer.Write([]string{dup.Email, strconv.Itoa(len(dup.Rows)), strings.Join(rows, ";")})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing duplicates report: %w", err)
+	}
+	return nil
+}
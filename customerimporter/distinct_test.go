@@ -0,0 +1,97 @@
+package customerimporter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const duplicateTestData = `first_name,last_name,email,gender,ip_address
+John,Doe,john.doe@example.com,Male,1.1.1.1
+Jane,Smith,jane@example.com,Female,2.2.2.2
+John,Doe,John.Doe@Example.com,Male,1.1.1.1
+Bob,Other,bob@another.com,Male,3.3.3.3
+Bad,Row,not-an-email,Male,4.4.4.4
+John,Doe,john.doe@example.com ,Male,1.1.1.1
+Jane,Smith,jane@example.com,Female,2.2.2.2
+`
+
+func TestNormaliseEmail(t *testing.T) {
+	tests := []struct {
+		email    string
+		expected string
+	}{
+		{"user@example.com", "user@example.com"},
+		{"User@Example.COM", "user@example.com"},
+		{"  user@example.com ", "user@example.com"},
+	}
+
+	for _, test := range tests {
+		result := normaliseEmail(test.email)
+		if result != test.expected {
+			t.Errorf("normaliseEmail(%q) = %q; want %q", test.email, result, test.expected)
+		}
+	}
+}
+
+func TestProcessDistinct(t *testing.T) {
+	result, err := ProcessDistinct(strings.NewReader(duplicateTestData))
+	if err != nil {
+		t.Fatalf("ProcessDistinct() returned an error: %v", err)
+	}
+
+	// Row 7 has trailing whitespace so fails email validation, like parseCSVRecords
+	expectedRows := map[string]int{"example.com": 4, "another.com": 1}
+	if !reflect.DeepEqual(result.RowCounts, expectedRows) {
+		t.Errorf("ProcessDistinct() RowCounts = %v; want %v", result.RowCounts, expectedRows)
+	}
+	expectedUnique := map[string]int{"example.com": 2, "another.com": 1}
+	if !reflect.DeepEqual(result.UniqueCounts, expectedUnique) {
+		t.Errorf("ProcessDistinct() UniqueCounts = %v; want %v", result.UniqueCounts, expectedUnique)
+	}
+
+	expectedDuplicates := []DuplicateEmail{
+		{Email: "jane@example.com", Rows: []int{3, 8}},
+		{Email: "john.doe@example.com", Rows: []int{2, 4}},
+	}
+	if !reflect.DeepEqual(result.Duplicates, expectedDuplicates) {
+		t.Errorf("ProcessDistinct() Duplicates = %v; want %v", result.Duplicates, expectedDuplicates)
+	}
+}
+
+func TestProcessDistinct_DomainCase(t *testing.T) {
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,John@Example.COM,Male,1.1.1.1\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n" +
+		"Jane,Doe,jane@example.com,Female,2.2.2.2\n"
+	result, err := ProcessDistinct(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("ProcessDistinct() returned an error: %v", err)
+	}
+	if expected := map[string]int{"example.com": 3}; !reflect.DeepEqual(result.RowCounts, expected) {
+		t.Errorf("ProcessDistinct() RowCounts = %v; want %v", result.RowCounts, expected)
+	}
+	if expected := map[string]int{"example.com": 2}; !reflect.DeepEqual(result.UniqueCounts, expected) {
+		t.Errorf("ProcessDistinct() UniqueCounts = %v; want %v", result.UniqueCounts, expected)
+	}
+}
+
+func TestWriteDuplicatesReport(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "duplicates.csv")
+	duplicates := []DuplicateEmail{{Email: "john@example.com", Rows: []int{2, 9, 14}}}
+
+	if err := writeDuplicatesReport(duplicates, outputFile); err != nil {
+		t.Fatalf("writeDuplicatesReport() returned an error: %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	expected := "email,occurrences,rows\njohn@example.com,3,2;9;14\n"
+	if string(data) != expected {
+		t.Errorf("writeDuplicatesReport() = %q; want %q", string(data), expected)
+	}
+}
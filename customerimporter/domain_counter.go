@@ -0,0 +1,65 @@
+package customerimporter
+
+import "sync"
+
+// Number of independently locked shards; a power of two so the hash can be masked
+const counterShards = 64
+
+// domainCounter is a concurrent domain -> count map. Domains are spread over
+// shards by hash so concurrent writers rarely contend on the same lock.
+type domainCounter struct {
+	shards [counterShards]counterShard
+}
+
+type counterShard struct {
+	mu     sync.Mutex
+	counts map[string]int
+	_      [48]byte // Pad to a cache line to avoid false sharing between shards
+}
+
+func newDomainCounter() *domainCounter {
+	c := &domainCounter{}
+	for i := range c.shards {
+		c.shards[i].counts = make(map[string]int)
+	}
+	return c
+}
+
+// shardFor hashes the domain with FNV-1a
+func (c *domainCounter) shardFor(domain string) *counterShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(domain); i++ {
+		hash ^= uint32(domain[i])
+		hash *= 16777619
+	}
+	return &c.shards[hash&(counterShards-1)]
+}
+
+// Add increments the count for a single domain
+func (c *domainCounter) Add(domain string, n int) {
+	shard := c.shardFor(domain)
+	shard.mu.Lock()
+	shard.counts[domain] += n
+	shard.mu.Unlock()
+}
+
+// Merge adds a batch of local counts, as produced by processChunk
+func (c *domainCounter) Merge(localCounts map[string]int) {
+	for domain, count := range localCounts {
+		c.Add(domain, count)
+	}
+}
+
+// Snapshot copies the current counts into a regular map
+func (c *domainCounter) Snapshot() map[string]int {
+	finalCounts := make(map[string]int)
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.mu.Lock()
+		for domain, count := range shard.counts {
+			finalCounts[domain] = count
+		}
+		shard.mu.Unlock()
+	}
+	return finalCounts
+}
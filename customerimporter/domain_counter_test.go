@@ -0,0 +1,136 @@
+package customerimporter
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestDomainCounter(t *testing.T) {
+	counter := newDomainCounter()
+	counter.Add("example.com", 2)
+	counter.Merge(map[string]int{"example.com": 1, "another.com": 4})
+
+	expected := map[string]int{
+		"example.com": 3,
+		"another.com": 4,
+	}
+	if result := counter.Snapshot(); !reflect.DeepEqual(result, expected) {
+		t.Errorf("domainCounter.Snapshot() = %v; want %v", result, expected)
+	}
+}
+
+// Run with -race: many writers hitting overlapping domains must not lose updates
+func TestDomainCounter_ConcurrentWriters(t *testing.T) {
+	const writers = 64
+	const iterations = 500
+	domains := benchmarkDomains(100)
+
+	counter := newDomainCounter()
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				counter.Merge(map[string]int{domains[(w+i)%len(domains)]: 1})
+				counter.Add(domains[i%len(domains)], 1)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, count := range counter.Snapshot() {
+		total += count
+	}
+	if want := writers * iterations * 2; total != want {
+		t.Errorf("domainCounter total = %d; want %d", total, want)
+	}
+}
+
+func TestCollectResults_ConcurrentCollectors(t *testing.T) {
+	ch := make(chan map[string]int)
+	counter := newDomainCounter()
+
+	var collectors sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		collectors.Add(1)
+		go func() {
+			defer collectors.Done()
+			collectResults(ch, counter, nil)
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		ch <- map[string]int{"example.com": 1, "another.com": 2}
+	}
+	close(ch)
+	collectors.Wait()
+
+	expected := map[string]int{
+		"example.com": 1000,
+		"another.com": 2000,
+	}
+	if result := counter.Snapshot(); !reflect.DeepEqual(result, expected) {
+		t.Errorf("collectResults() = %v; want %v", result, expected)
+	}
+}
+
+func benchmarkDomains(n int) []string {
+	domains := make([]string, n)
+	for i := range domains {
+		domains[i] = fmt.Sprintf("domain%d.com", i)
+	}
+	return domains
+}
+
+func benchmarkChunks(domains []string) []map[string]int {
+	chunks := make([]map[string]int, 64)
+	for i := range chunks {
+		chunks[i] = make(map[string]int)
+		for j := 0; j < 200; j++ {
+			chunks[i][domains[(i*31+j*7)%len(domains)]]++
+		}
+	}
+	return chunks
+}
+
+// syncMapMerge is the previous aggregation strategy, kept as a benchmark baseline
+func syncMapMerge(domainCounts *sync.Map, mu *sync.Mutex, localCounts map[string]int) {
+	for domain, count := range localCounts {
+		mu.Lock()
+		actual, loaded := domainCounts.LoadOrStore(domain, count)
+		if loaded {
+			domainCounts.Store(domain, actual.(int)+count)
+		}
+		mu.Unlock()
+	}
+}
+
+func BenchmarkSyncMapMerge(b *testing.B) {
+	chunks := benchmarkChunks(benchmarkDomains(5000))
+	var domainCounts sync.Map
+	var mu sync.Mutex
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			syncMapMerge(&domainCounts, &mu, chunks[i%len(chunks)])
+			i++
+		}
+	})
+}
+
+func BenchmarkDomainCounterMerge(b *testing.B) {
+	chunks := benchmarkChunks(benchmarkDomains(5000))
+	counter := newDomainCounter()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			counter.Merge(chunks[i%len(chunks)])
+			i++
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package customerimporter
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Sentinel errors returned, wrapped, by the processing functions; test for
+// them with errors.Is
+var (
+	ErrEmptyFile      = errors.New("file is empty or contains only headers")
+	ErrNoEmailColumn  = errors.New("no email column found in header")
+	ErrNoRecords      = errors.New("no records found in file")
+	ErrTooFewRecords  = errors.New("too few records in file")
+	ErrTooManyRecords = errors.New("too many records in file")
+	ErrTooManyRejects = errors.New("too many invalid records")
+)
+
+// RowError describes the first malformed row found in strict mode. Use
+// errors.As to retrieve it from a wrapped error.
+type RowError struct {
+	File   string // Input file name; empty when reading from a non-file source
+	Line   int    // 1-based line in the file, or sheet row number for XLSX
+	Column string // Header name of the offending column; empty when the whole row is bad
+	Value  string // Offending value
+	Reason string
+	Err    error // Underlying cause, such as a *csv.ParseError, if any
+}
+
+func (e *RowError) Error() string {
+	location := strconv.Itoa(e.Line)
+	if e.File != "" {
+		location = e.File + ":" + location
+	}
+	if e.Column == "" {
+		return fmt.Sprintf("%s: %s", location, e.Reason)
+	}
+	return fmt.Sprintf("%s: column %s: %s: %q", location, e.Column, e.Reason, e.Value)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// strictRowError returns a *RowError for a bad row in strict mode and nil
+// otherwise. column indexes header; -1 marks a problem with the whole row.
+func (r *Run) strictRowError(file string, line int, header []string, column int, value, reason string) error {
+	if !r.config.Strict {
+		return nil
+	}
+	err := &RowError{File: file, Line: line, Value: value, Reason: reason}
+	if column >= 0 {
+		err.Column = "column " + strconv.Itoa(column+1)
+		if column < len(header) {
+			err.Column = header[column]
+		}
+	}
+	return err
+}
+
+// strictReadError converts a CSV read error into a *RowError in strict mode
+func (r *Run) strictReadError(file string, line int, err error) error {
+	if !r.config.Strict {
+		return nil
+	}
+	rowErr := &RowError{File: file, Line: line, Reason: err.Error(), Err: err}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		rowErr.Line = parseErr.Line
+		rowErr.Reason = parseErr.Err.Error()
+	}
+	return rowErr
+}
+
+// strictRuleError reports a validation rule failure, naming the rule's column
+func (r *Run) strictRuleError(file string, line int, rule string, record Record) error {
+	column, value := ruleValue(rule, record)
+	return r.strictRowError(file, line, []string{column}, 0, value, "failed rule "+rule)
+}
+
+// fileName returns the name of inputs that have one, such as *os.File
+func fileName(input interface{}) string {
+	if named, ok := input.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return ""
+}
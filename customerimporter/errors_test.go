@@ -0,0 +1,205 @@
+package customerimporter
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRowError_Error(t *testing.T) {
+	tests := []struct {
+		err      RowError
+		expected string
+	}{
+		{RowError{File: "in.csv", Line: 4, Column: "email", Value: "bad", Reason: "invalid email"}, `in.csv:4: column email: invalid email: "bad"`},
+		{RowError{File: "in.csv", Line: 7, Reason: "expected 5 fields, got 2"}, "in.csv:7: expected 5 fields, got 2"},
+		{RowError{Line: 2, Column: "email", Value: "", Reason: "invalid email"}, `2: column email: invalid email: ""`},
+	}
+
+	for _, test := range tests {
+		if result := test.err.Error(); result != test.expected {
+			t.Errorf("Error() = %q; want %q", result, test.expected)
+		}
+	}
+}
+
+func writeStrictTestFile(t *testing.T, data string) *os.File {
+	t.Helper()
+	file, err := os.Create(filepath.Join(t.TempDir(), "strict.csv"))
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	file.WriteString(data)
+	file.Seek(0, 0)
+	t.Cleanup(func() { file.Close() })
+	return file
+}
+
+func TestStrictMode_ParseCSVRecords(t *testing.T) {
+	strict := NewRun(RunConfig{Strict: true})
+
+	tests := []struct {
+		name     string
+		data     string
+		expected RowError
+	}{
+		{
+			"invalid email",
+			"first_name,last_name,Email Address,gender,ip_address\nJohn,Doe,john@example.com,Male,1.1.1.1\nJane,Doe,jane-at-example,Female,2.2.2.2\n",
+			RowError{Line: 3, Column: "Email Address", Value: "jane-at-example", Reason: "invalid email"},
+		},
+		{
+			"row with a different field count",
+			"first_name,last_name,email,gender,ip_address\nJohn,Doe\n",
+			RowError{Line: 2, Reason: "wrong number of fields"},
+		},
+		{
+			"short rows",
+			"first_name,last_name,email\nJohn,Doe,john@example.com\n",
+			RowError{Line: 2, Reason: "expected 5 fields, got 3"},
+		},
+		{
+			"line after multi-line field",
+			"first_name,last_name,email,gender,ip_address\n\"John\nJr\",Doe,john@example.com,Male,1.1.1.1\nJane,Doe,bad,Female,2.2.2.2\n",
+			RowError{Line: 4, Column: "email", Value: "bad", Reason: "invalid email"},
+		},
+		{
+			"unterminated quote",
+			"first_name,last_name,email,gender,ip_address\nJohn,\"Doe,john@example.com,Male,1.1.1.1\n",
+			RowError{Line: 2, Reason: "extraneous or missing \" in quoted-field"},
+		},
+	}
+
+	for _, test := range tests {
+		file := writeStrictTestFile(t, test.data)
+		test.expected.File = file.Name()
+
+		_, _, err := strict.parseCSVRecordsFrom(file, nil, nil)
+		var rowErr *RowError
+		if !errors.As(err, &rowErr) {
+			t.Errorf("%s: parseCSVRecords() error = %v; want a *RowError", test.name, err)
+			continue
+		}
+		result := *rowErr
+		result.Err = nil // Compared separately below
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s: parseCSVRecords() error = %+v; want %+v", test.name, result, test.expected)
+		}
+	}
+}
+
+func TestRowError_Unwrap(t *testing.T) {
+	data := "first_name,last_name,email,gender,ip_address\nJohn,\"Doe,john@example.com,Male,1.1.1.1\n"
+	_, err := NewRun(RunConfig{Strict: true}).Process(writeStrictTestFile(t, data).Name(), "console")
+	var parseErr *csv.ParseError
+	if !errors.As(err, &parseErr) || !errors.Is(err, csv.ErrQuote) {
+		t.Errorf("Process() error = %v; want a wrapped *csv.ParseError with csv.ErrQuote", err)
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	header := "first_name,last_name,email,gender,ip_address\n"
+	rows := header + "John,Doe,john@example.com,Male,1.1.1.1\nJane,Doe,bad,Female,2.2.2.2\n"
+
+	_, err := Process(writeStrictTestFile(t, "").Name(), "console")
+	if !errors.Is(err, ErrEmptyFile) {
+		t.Errorf("Process() error = %v; want ErrEmptyFile", err)
+	}
+
+	_, err = Process(writeStrictTestFile(t, header).Name(), "console")
+	if !errors.Is(err, ErrNoRecords) {
+		t.Errorf("Process() error = %v; want ErrNoRecords", err)
+	}
+
+	_, err = ProcessDistinct(strings.NewReader(""))
+	if !errors.Is(err, ErrEmptyFile) {
+		t.Errorf("ProcessDistinct() error = %v; want ErrEmptyFile", err)
+	}
+
+	_, err = Process(writeStrictTestFile(t, rows).Name(), "console")
+	if !errors.Is(err, ErrTooFewRecords) {
+		t.Errorf("Process() error = %v; want ErrTooFewRecords", err)
+	}
+
+	run := NewRun(RunConfig{CountPolicy: &RecordCountPolicy{MaxRecords: 0, MaxRejectRatio: 0.1, Action: PolicyFail}})
+	_, err = run.Process(writeStrictTestFile(t, rows).Name(), "console")
+	if !errors.Is(err, ErrTooManyRejects) {
+		t.Errorf("Process() error = %v; want ErrTooManyRejects", err)
+	}
+
+	err = validateRecordCounts(make([]Record, 3), 1, 2)
+	if !errors.Is(err, ErrTooManyRecords) || err.Error() != "too many records in file: 3" {
+		t.Errorf("validateRecordCounts() = %v; want ErrTooManyRecords", err)
+	}
+	if err := validateRecordCounts(nil, 1, 2); err != ErrNoRecords {
+		t.Errorf("validateRecordCounts() = %v; want ErrNoRecords", err)
+	}
+
+	if _, err := mapHeader([]string{"name", "phone"}); !errors.Is(err, ErrNoEmailColumn) {
+		t.Errorf("mapHeader() error = %v; want ErrNoEmailColumn", err)
+	}
+}
+
+func TestStrictMode_StreamingAndSources(t *testing.T) {
+	strict := NewRun(RunConfig{Strict: true})
+
+	data := "first_name,last_name,email,gender,ip_address\nJohn,Doe,john@example.com,Male,1.1.1.1\nJane,Doe,jane-at-example,Female,2.2.2.2\n"
+	file := writeStrictTestFile(t, data)
+	expected := &RowError{File: file.Name(), Line: 3, Column: "email", Value: "jane-at-example", Reason: "invalid email"}
+
+	_, err := strict.ProcessDistinct(file)
+	var rowErr *RowError
+	if !errors.As(err, &rowErr) || !reflect.DeepEqual(rowErr, expected) {
+		t.Errorf("ProcessDistinct() error = %v; want %v", err, expected)
+	}
+
+	src := &sliceSource{records: []Record{{Email: "john@example.com"}, {Email: "nobody"}}}
+	_, err = strict.ProcessSource(src)
+	expected = &RowError{Line: 2, Column: "email", Value: "nobody", Reason: "invalid email"}
+	if !errors.As(err, &rowErr) || !reflect.DeepEqual(rowErr, expected) {
+		t.Errorf("ProcessSource() error = %v; want %v", err, expected)
+	}
+
+	// Sources report their own line numbers, skipped and comment lines included
+	tests := []struct {
+		name  string
+		input string
+		line  int
+		value string
+	}{
+		{"invalid email", "HEADER\n* comment\nJohn      Doe       not-an-email", 3, "not-an-email"},
+		{"missing email", "HEADER\n\nBob       NoEmail", 3, ""},
+	}
+	for _, test := range tests {
+		fixed, err := NewFixedWidthSource(strings.NewReader(test.input), testLayout)
+		if err != nil {
+			t.Fatalf("NewFixedWidthSource() returned an error: %v", err)
+		}
+		_, err = strict.ProcessSource(fixed)
+		if !errors.As(err, &rowErr) || rowErr.Line != test.line || rowErr.Value != test.value {
+			t.Errorf("%s: ProcessSource() error = %v; want a *RowError on line %d", test.name, err, test.line)
+		}
+	}
+}
+
+func TestStrictMode_RuleFailure(t *testing.T) {
+	data := "first_name,last_name,email,gender,ip_address\nJohn,Doe,john@example.com,Robot,1.1.1.1\n"
+	_, err := NewRun(RunConfig{Strict: true, Validator: testValidator(t)}).ProcessDistinct(strings.NewReader(data))
+	expected := &RowError{Line: 2, Column: "gender", Value: "Robot", Reason: "failed rule gender.enum"}
+	var rowErr *RowError
+	if !errors.As(err, &rowErr) || !reflect.DeepEqual(rowErr, expected) {
+		t.Errorf("ProcessDistinct() error = %v; want %v", err, expected)
+	}
+}
+
+func TestStrictMode_Off(t *testing.T) {
+	data := "first_name,last_name,email,gender,ip_address\nJohn,Doe,john@example.com,Male,1.1.1.1\nJane,Doe,bad,Female,2.2.2.2\n"
+	records, skipped, err := parseCSVRecords(writeStrictTestFile(t, data))
+	if err != nil || len(records) != 1 || skipped != 1 {
+		t.Errorf("parseCSVRecords() = %d records, %d skipped, %v; want 1, 1, nil", len(records), skipped, err)
+	}
+}
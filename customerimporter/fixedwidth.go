@@ -0,0 +1,158 @@
+package customerimporter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// FixedWidthColumn describes one field of a fixed-width record layout.
+// Start is the 1-based character position of the field's first character.
+type FixedWidthColumn struct {
+	Name  string `json:"name"`
+	Start int    `json:"start"`
+	Width int    `json:"width"`
+	Trim  string `json:"trim,omitempty"` // "both" (default), "left", "right" or "none"
+}
+
+// maxFixedWidthLine is the longest line a FixedWidthSource reads, which also
+// bounds where a column may end
+const maxFixedWidthLine = 1024 * 1024
+
+// FixedWidthLayout is the layout definition for a fixed-width text file
+type FixedWidthLayout struct {
+	Columns       []FixedWidthColumn `json:"columns"`
+	SkipLines     int                `json:"skip_lines,omitempty"`     // Leading lines to ignore (e.g. a banner or header)
+	CommentPrefix string             `json:"comment_prefix,omitempty"` // Lines starting with this prefix are ignored
+}
+
+// LoadFixedWidthLayout reads a JSON layout definition file
+func LoadFixedWidthLayout(fileName string) (FixedWidthLayout, error) {
+	var layout FixedWidthLayout
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return layout, fmt.Errorf("error reading layout file: %w", err)
+	}
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return layout, fmt.Errorf("error parsing layout file: %w", err)
+	}
+	return layout, layout.validate()
+}
+
+func (l FixedWidthLayout) validate() error {
+	if len(l.Columns) == 0 {
+		return fmt.Errorf("layout defines no columns")
+	}
+	for _, col := range l.Columns {
+		if col.Start < 1 || col.Width < 1 {
+			return fmt.Errorf("column %q: start and width must be positive", col.Name)
+		}
+		// Checked one at a time so start+width cannot overflow
+		if col.Start > maxFixedWidthLine || col.Width > maxFixedWidthLine || col.Start-1+col.Width > maxFixedWidthLine {
+			return fmt.Errorf("column %q: ends past the %d-character line limit", col.Name, maxFixedWidthLine)
+		}
+		switch col.Trim {
+		case "", "both", "left", "right", "none":
+		default:
+			return fmt.Errorf("column %q: unknown trim rule %q", col.Name, col.Trim)
+		}
+	}
+	return nil
+}
+
+// FixedWidthSource reads customer records from fixed-width text lines
+type FixedWidthSource struct {
+	layout     FixedWidthLayout
+	cols       columnMap
+	input      *sourceInput
+	scanner    *bufio.Scanner
+	lineNumber int
+}
+
+// NewFixedWidthSource returns a Source that slices each line of r according
+// to layout. Column names are matched to Record fields like CSV headers.
+func NewFixedWidthSource(r io.Reader, layout FixedWidthLayout) (*FixedWidthSource, error) {
+	if err := layout.validate(); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(layout.Columns))
+	for i, col := range layout.Columns {
+		names[i] = col.Name
+	}
+	cols, err := mapHeader(names)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &sourceInput{r: r, size: inputSize(r)}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxFixedWidthLine)
+	return &FixedWidthSource{layout: layout, cols: cols, input: input, scanner: scanner}, nil
+}
+
+// Next returns the next record from the input, or a *RowError for a line
+// without an email value
+func (s *FixedWidthSource) Next() (Record, error) {
+	for s.scanner.Scan() {
+		s.lineNumber++
+		line := strings.TrimRight(s.scanner.Text(), "\r")
+		if s.lineNumber <= s.layout.SkipLines || strings.TrimSpace(line) == "" {
+			continue
+		}
+		if s.layout.CommentPrefix != "" && strings.HasPrefix(line, s.layout.CommentPrefix) {
+			continue
+		}
+		record, err := recordFromRow(s.cols, s.layout.split(line))
+		if err != nil {
+			return Record{}, &RowError{Line: s.lineNumber, Reason: err.Error(), Err: err}
+		}
+		return record, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return Record{}, fmt.Errorf("error reading line %d: %w", s.lineNumber+1, err)
+	}
+	return Record{}, io.EOF
+}
+
+// Line returns the 1-based line number of the last line read
+func (s *FixedWidthSource) Line() int {
+	return s.lineNumber
+}
+
+func (s *FixedWidthSource) progressInput() *sourceInput {
+	return s.input
+}
+
+// split cuts a line into column values; columns past the end of a short line are empty
+func (l FixedWidthLayout) split(line string) []string {
+	chars := []rune(line)
+	row := make([]string, len(l.Columns))
+	for i, col := range l.Columns {
+		start := col.Start - 1
+		if start >= len(chars) {
+			continue
+		}
+		end := start + col.Width
+		if end > len(chars) {
+			end = len(chars)
+		}
+		row[i] = trimField(string(chars[start:end]), col.Trim)
+	}
+	return row
+}
+
+func trimField(value string, rule string) string {
+	switch rule {
+	case "none":
+		return value
+	case "left":
+		return strings.TrimLeft(value, " \t")
+	case "right":
+		return strings.TrimRight(value, " \t")
+	default:
+		return strings.TrimSpace(value)
+	}
+}
@@ -0,0 +1,138 @@
+package customerimporter
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testLayout = FixedWidthLayout{
+	Columns: []FixedWidthColumn{
+		{Name: "FIRST-NAME", Start: 1, Width: 10},
+		{Name: "LAST-NAME", Start: 11, Width: 10},
+		{Name: "EMAIL", Start: 21, Width: 30},
+		{Name: "GENDER", Start: 51, Width: 6, Trim: "right"},
+	},
+	SkipLines:     1,
+	CommentPrefix: "*",
+}
+
+func TestLoadFixedWidthLayout(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "layout.json")
+	os.WriteFile(valid, []byte(`{"columns":[{"name":"email","start":1,"width":30}],"skip_lines":2}`), 0644)
+	invalid := filepath.Join(dir, "invalid.json")
+	os.WriteFile(invalid, []byte(`{"columns":[{"name":"email","start":0,"width":30}]}`), 0644)
+
+	layout, err := LoadFixedWidthLayout(valid)
+	if err != nil {
+		t.Errorf("LoadFixedWidthLayout(valid) returned an error: %v", err)
+	}
+	if len(layout.Columns) != 1 || layout.SkipLines != 2 {
+		t.Errorf("LoadFixedWidthLayout(valid) = %+v; want 1 column and 2 skipped lines", layout)
+	}
+
+	if _, err := LoadFixedWidthLayout(invalid); err == nil {
+		t.Errorf("LoadFixedWidthLayout(invalid) did not return an error")
+	}
+}
+
+func TestFixedWidthLayoutValidate_Bounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		column  FixedWidthColumn
+		wantErr bool
+	}{
+		{"ends on the line limit", FixedWidthColumn{Name: "email", Start: maxFixedWidthLine, Width: 1}, false},
+		{"start too large", FixedWidthColumn{Name: "email", Start: maxFixedWidthLine + 1, Width: 1}, true},
+		{"width too large", FixedWidthColumn{Name: "email", Start: 1, Width: maxFixedWidthLine + 1}, true},
+		{"ends past the line limit", FixedWidthColumn{Name: "email", Start: maxFixedWidthLine, Width: 2}, true},
+		{"start and width overflow", FixedWidthColumn{Name: "email", Start: math.MaxInt, Width: math.MaxInt}, true},
+	}
+
+	for _, test := range tests {
+		err := FixedWidthLayout{Columns: []FixedWidthColumn{test.column}}.validate()
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: validate() returned %v; want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestFixedWidthLayoutSplit(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{"John      Doe       john.doe@example.com          male  ", []string{"John", "Doe", "john.doe@example.com", "male"}},
+		{"Jane      Smith     jane@example.com", []string{"Jane", "Smith", "jane@example.com", ""}}, // Short line
+		{"José      Núñez     jose@example.es               male", []string{"José", "Núñez", "jose@example.es", "male"}},
+	}
+
+	for _, test := range tests {
+		result := testLayout.split(test.line)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("split(%q) = %q; want %q", test.line, result, test.expected)
+		}
+	}
+}
+
+func TestTrimField(t *testing.T) {
+	tests := []struct {
+		value    string
+		rule     string
+		expected string
+	}{
+		{"  a  ", "", "a"},
+		{"  a  ", "both", "a"},
+		{"  a  ", "left", "a  "},
+		{"  a  ", "right", "  a"},
+		{"  a  ", "none", "  a  "},
+	}
+
+	for _, test := range tests {
+		result := trimField(test.value, test.rule)
+		if result != test.expected {
+			t.Errorf("trimField(%q, %q) = %q; want %q", test.value, test.rule, result, test.expected)
+		}
+	}
+}
+
+func TestProcessSource_FixedWidth(t *testing.T) {
+	input := strings.Join([]string{
+		"CUSTOMER EXTRACT",
+		"John      Doe       john.doe@example.com          male",
+		"* comment line",
+		"Jane      Smith     jane.smith@example.com        female",
+		"",
+		"Bob       NoEmail",
+		"Ann       Other     ann@another.com               female",
+	}, "\r\n")
+
+	src, err := NewFixedWidthSource(strings.NewReader(input), testLayout)
+	if err != nil {
+		t.Fatalf("NewFixedWidthSource() returned an error: %v", err)
+	}
+
+	result, err := ProcessSource(src)
+	if err != nil {
+		t.Errorf("ProcessSource() returned an error: %v", err)
+	}
+
+	expected := map[string]int{
+		"example.com": 2,
+		"another.com": 1,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("ProcessSource() = %v; want %v", result, expected)
+	}
+}
+
+func TestNewFixedWidthSource_NoEmailColumn(t *testing.T) {
+	layout := FixedWidthLayout{Columns: []FixedWidthColumn{{Name: "name", Start: 1, Width: 10}}}
+	if _, err := NewFixedWidthSource(strings.NewReader(""), layout); err == nil {
+		t.Errorf("NewFixedWidthSource() did not return an error for a layout without an email column")
+	}
+}
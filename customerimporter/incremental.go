@@ -0,0 +1,267 @@
+package customerimporter
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Kinds of customer change between incremental runs
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// CustomerState is what an incremental run remembers about one customer
+type CustomerState struct {
+	Domain      string `json:"domain"`
+	Fingerprint string `json:"fingerprint"` // Hash of every row with this email, in any order
+}
+
+// ImportState is the state store kept between incremental runs: a fingerprint
+// per normalised email, and the domain counts of the run that saved it
+type ImportState struct {
+	Saved        time.Time                `json:"saved"`
+	Rows         int                      `json:"rows"`
+	DomainCounts map[string]int           `json:"domain_counts"`
+	Customers    map[string]CustomerState `json:"customers"`
+}
+
+// CustomerChange is one customer added, removed or changed since the last run
+type CustomerChange struct {
+	Email  string `json:"email"` // Normalised
+	Change string `json:"change"`
+	Domain string `json:"domain"` // Current domain; the previous one for removed customers
+}
+
+// DomainDelta is the change in one domain's row count since the last run
+type DomainDelta struct {
+	Domain   string `json:"domain"`
+	Previous int    `json:"previous"`
+	Current  int    `json:"current"`
+	Delta    int    `json:"delta"`
+}
+
+// ChangeReport describes what changed between the previous run and this one
+type ChangeReport struct {
+	PreviousRun  *time.Time       `json:"previous_run,omitempty"` // Unset on the first run
+	Added        int              `json:"added"`
+	Removed      int              `json:"removed"`
+	Changed      int              `json:"changed"`
+	Unchanged    int              `json:"unchanged"`
+	Changes      []CustomerChange `json:"changes"`       // By email
+	DomainDeltas []DomainDelta    `json:"domain_deltas"` // Largest change first; unchanged domains are left out
+}
+
+// IncrementalResult holds the domain counts of an incremental run, the state
+// to save for the next run and the changes since the previous one
+type IncrementalResult struct {
+	DomainCounts map[string]int
+	State        ImportState
+	Changes      ChangeReport
+}
+
+// LoadImportState reads the state saved by the previous run. A missing file is
+// an empty state, so the first run reports every customer as added.
+func LoadImportState(path string) (ImportState, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ImportState{}, nil
+	}
+	if err != nil {
+		return ImportState{}, fmt.Errorf("error opening state file: %w", err)
+	}
+	defer file.Close()
+
+	var state ImportState
+	if err := json.NewDecoder(bufio.NewReader(file)).Decode(&state); err != nil {
+		return ImportState{}, fmt.Errorf("error parsing state file %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// SaveImportState writes state under a temporary name and renames it over
+// path, so a failed run never leaves a half-written state behind
+func SaveImportState(path string, state ImportState) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".state-*")
+	if err != nil {
+		return fmt.Errorf("error saving state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	buffered := bufio.NewWriter(tmp)
+	if err := json.NewEncoder(buffered).Encode(state); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error saving state: %w", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error saving state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error saving state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error saving state: %w", err)
+	}
+	return nil
+}
+
+// ProcessIncremental counts rows per domain like the other modes and compares
+// every customer's rows with previous, the state saved by the last run.
+// Customers are matched by normalised email; a customer whose rows differ in
+// any field is reported as changed, while reordering rows changes nothing.
+func ProcessIncremental(input io.Reader, previous ImportState) (IncrementalResult, error) {
+	run := NewRun(RunConfig{})
+	defer run.LogSkipSummary()
+	return run.ProcessIncremental(input, previous)
+}
+
+// ProcessIncremental is the package-level ProcessIncremental under the run's
+// settings
+func (r *Run) ProcessIncremental(input io.Reader, previous ImportState) (IncrementalResult, error) {
+	result := IncrementalResult{
+		DomainCounts: make(map[string]int),
+		State:        ImportState{Customers: make(map[string]CustomerState, len(previous.Customers))},
+	}
+	rowFingerprints := make(map[string][]string, len(previous.Customers))
+	processed, skipped, err := r.streamCSVDomains(input, func(rowNumber int, domain string, record Record) {
+		result.DomainCounts[domain]++
+		key := r.providers.normaliseEmail(record.Email)
+		if _, seen := result.State.Customers[key]; !seen {
+			result.State.Customers[key] = CustomerState{Domain: domain}
+		}
+		rowFingerprints[key] = append(rowFingerprints[key], fingerprintRecord(record))
+	})
+	if err != nil {
+		return IncrementalResult{}, err
+	}
+	// A truncated file would otherwise report most customers as removed
+	if err := r.checkReaderCounts(processed, skipped); err != nil {
+		return IncrementalResult{}, err
+	}
+
+	for key, rows := range rowFingerprints {
+		customer := result.State.Customers[key]
+		customer.Fingerprint = combineFingerprints(rows)
+		result.State.Customers[key] = customer
+	}
+	result.State.Saved = time.Now().UTC()
+	result.State.Rows = processed
+	result.State.DomainCounts = result.DomainCounts
+	result.Changes = compareStates(previous, result.State)
+	return result, nil
+}
+
+// fingerprintRecord hashes the fields of one row
+func fingerprintRecord(record Record) string {
+	hash := sha256.New()
+	for _, field := range []string{record.FirstName, record.LastName, record.Email, record.Gender, record.IPAddress} {
+		// Length-prefixed so no two field lists hash the same
+		fmt.Fprintf(hash, "%d:%s", len(field), field)
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// combineFingerprints combines the row fingerprints of one customer. They are
+// sorted first, so the result does not depend on row order, while a
+// duplicated or changed row still changes it.
+func combineFingerprints(rows []string) string {
+	if len(rows) == 1 {
+		return rows[0]
+	}
+	sorted := slices.Clone(rows)
+	sort.Strings(sorted)
+	hash := sha256.New()
+	for _, row := range sorted {
+		io.WriteString(hash, row) // Fixed length, so no separator is needed
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// compareStates reports the customers and domain counts that differ between
+// previous and current
+func compareStates(previous, current ImportState) ChangeReport {
+	var report ChangeReport
+	if !previous.Saved.IsZero() {
+		saved := previous.Saved
+		report.PreviousRun = &saved
+	}
+
+	for email, customer := range current.Customers {
+		before, existed := previous.Customers[email]
+		switch {
+		case !existed:
+			report.Added++
+			report.Changes = append(report.Changes, CustomerChange{Email: email, Change: ChangeAdded, Domain: customer.Domain})
+		case before.Fingerprint != customer.Fingerprint:
+			report.Changed++
+			report.Changes = append(report.Changes, CustomerChange{Email: email, Change: ChangeChanged, Domain: customer.Domain})
+		default:
+			report.Unchanged++
+		}
+	}
+	for email, customer := range previous.Customers {
+		if _, exists := current.Customers[email]; !exists {
+			report.Removed++
+			report.Changes = append(report.Changes, CustomerChange{Email: email, Change: ChangeRemoved, Domain: customer.Domain})
+		}
+	}
+	sort.Slice(report.Changes, func(i, j int) bool {
+		return report.Changes[i].Email < report.Changes[j].Email
+	})
+
+	report.DomainDeltas = domainDeltas(previous.DomainCounts, current.DomainCounts)
+	return report
+}
+
+// domainDeltas lists the domains whose counts differ, largest change first
+// and alphabetically for ties
+func domainDeltas(previous, current map[string]int) []DomainDelta {
+	var deltas []DomainDelta
+	for domain, count := range current {
+		if before := previous[domain]; before != count {
+			deltas = append(deltas, DomainDelta{Domain: domain, Previous: before, Current: count, Delta: count - before})
+		}
+	}
+	for domain, count := range previous {
+		if _, ok := current[domain]; !ok {
+			deltas = append(deltas, DomainDelta{Domain: domain, Previous: count, Delta: -count})
+		}
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		a, b := absDelta(deltas[i].Delta), absDelta(deltas[j].Delta)
+		if a == b {
+			return deltas[i].Domain < deltas[j].Domain
+		}
+		return a > b
+	})
+	return deltas
+}
+
+func absDelta(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// writeChangeReport writes report as indented JSON
+func writeChangeReport(report ChangeReport, outputFileName string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding change report: %w", err)
+	}
+	if err := os.WriteFile(outputFileName, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("error writing change report: %w", err)
+	}
+	return nil
+}
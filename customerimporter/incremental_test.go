@@ -0,0 +1,157 @@
+package customerimporter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const incrementalDayOne = `first_name,last_name,email,gender,ip_address
+John,Doe,john@example.com,Male,1.1.1.1
+Jane,Smith,jane@example.com,Female,2.2.2.2
+Bob,Other,bob@another.com,Male,3.3.3.3
+Bad,Row,not-an-email,Male,4.4.4.4
+`
+
+// Jane moved address, Bob left, Ann joined and John is unchanged apart from case
+const incrementalDayTwo = `first_name,last_name,email,gender,ip_address
+John,Doe,John@example.com,Male,1.1.1.1
+Jane,Smith,jane@example.com,Female,9.9.9.9
+Ann,New,ann@third.org,Female,5.5.5.5
+Carl,New,carl@example.com,Male,6.6.6.6
+`
+
+func TestProcessIncremental(t *testing.T) {
+	run := NewRun(RunConfig{CountPolicy: &RecordCountPolicy{Action: PolicyFail}})
+
+	first, err := run.ProcessIncremental(strings.NewReader(incrementalDayOne), ImportState{})
+	if err != nil {
+		t.Fatalf("ProcessIncremental() returned an error: %v", err)
+	}
+	if first.Changes.PreviousRun != nil || first.Changes.Added != 3 || first.Changes.Removed != 0 || first.Changes.Changed != 0 {
+		t.Errorf("ProcessIncremental() first run = %+v; want 3 customers added", first.Changes)
+	}
+
+	second, err := run.ProcessIncremental(strings.NewReader(incrementalDayTwo), first.State)
+	if err != nil {
+		t.Fatalf("ProcessIncremental() returned an error: %v", err)
+	}
+	expectedCounts := map[string]int{"example.com": 3, "third.org": 1}
+	if !reflect.DeepEqual(second.DomainCounts, expectedCounts) {
+		t.Errorf("ProcessIncremental() DomainCounts = %v; want %v", second.DomainCounts, expectedCounts)
+	}
+
+	changes := second.Changes
+	if changes.PreviousRun == nil || !changes.PreviousRun.Equal(first.State.Saved) {
+		t.Errorf("ProcessIncremental() PreviousRun = %v; want %v", changes.PreviousRun, first.State.Saved)
+	}
+	expectedChanges := []CustomerChange{
+		{Email: "ann@third.org", Change: ChangeAdded, Domain: "third.org"},
+		{Email: "bob@another.com", Change: ChangeRemoved, Domain: "another.com"},
+		{Email: "carl@example.com", Change: ChangeAdded, Domain: "example.com"},
+		{Email: "jane@example.com", Change: ChangeChanged, Domain: "example.com"},
+		{Email: "john@example.com", Change: ChangeChanged, Domain: "example.com"},
+	}
+	if !reflect.DeepEqual(changes.Changes, expectedChanges) {
+		t.Errorf("ProcessIncremental() Changes = %v; want %v", changes.Changes, expectedChanges)
+	}
+	if changes.Added != 2 || changes.Removed != 1 || changes.Changed != 2 || changes.Unchanged != 0 {
+		t.Errorf("ProcessIncremental() = %d added, %d removed, %d changed, %d unchanged; want 2, 1, 2, 0", changes.Added, changes.Removed, changes.Changed, changes.Unchanged)
+	}
+	expectedDeltas := []DomainDelta{
+		{Domain: "another.com", Previous: 1, Current: 0, Delta: -1},
+		{Domain: "example.com", Previous: 2, Current: 3, Delta: 1},
+		{Domain: "third.org", Previous: 0, Current: 1, Delta: 1},
+	}
+	if !reflect.DeepEqual(changes.DomainDeltas, expectedDeltas) {
+		t.Errorf("ProcessIncremental() DomainDeltas = %v; want %v", changes.DomainDeltas, expectedDeltas)
+	}
+
+	// The same file again changes nothing
+	third, err := run.ProcessIncremental(strings.NewReader(incrementalDayTwo), second.State)
+	if err != nil {
+		t.Fatalf("ProcessIncremental() returned an error: %v", err)
+	}
+	if len(third.Changes.Changes) != 0 || len(third.Changes.DomainDeltas) != 0 || third.Changes.Unchanged != 4 {
+		t.Errorf("ProcessIncremental() rerun = %+v; want 4 unchanged customers", third.Changes)
+	}
+}
+
+func TestProcessIncremental_NoRecords(t *testing.T) {
+	data := "first_name,last_name,email,gender,ip_address\nBad,Row,not-an-email,Male,4.4.4.4\n"
+	if _, err := ProcessIncremental(strings.NewReader(data), ImportState{}); err != ErrNoRecords {
+		t.Errorf("ProcessIncremental() = %v; want %v", err, ErrNoRecords)
+	}
+}
+
+func TestFingerprintRecord(t *testing.T) {
+	record := Record{FirstName: "John", LastName: "Doe", Email: "john@example.com", Gender: "Male", IPAddress: "1.1.1.1"}
+	shifted := Record{FirstName: "John", LastName: "Doejohn@example.com", Gender: "Male", IPAddress: "1.1.1.1"}
+
+	if fingerprintRecord(record) != fingerprintRecord(record) {
+		t.Errorf("fingerprintRecord() is not deterministic")
+	}
+	if fingerprintRecord(record) == fingerprintRecord(shifted) {
+		t.Errorf("fingerprintRecord() is the same for fields split differently")
+	}
+
+	first, second := fingerprintRecord(record), fingerprintRecord(shifted)
+	if combineFingerprints([]string{first, second}) != combineFingerprints([]string{second, first}) {
+		t.Errorf("combineFingerprints() depends on row order")
+	}
+	if combineFingerprints([]string{first, first}) == combineFingerprints([]string{first}) {
+		t.Errorf("combineFingerprints() does not change for a duplicate row")
+	}
+}
+
+func TestProcessIncremental_ReorderedRows(t *testing.T) {
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n" +
+		"Jane,Smith,jane@example.com,Female,2.2.2.2\n" +
+		"Johnny,Doe,john@example.com,Male,1.1.1.1\n"
+	reordered := "first_name,last_name,email,gender,ip_address\n" +
+		"Johnny,Doe,john@example.com,Male,1.1.1.1\n" +
+		"Jane,Smith,jane@example.com,Female,2.2.2.2\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n"
+	first, err := ProcessIncremental(strings.NewReader(data), ImportState{})
+	if err != nil {
+		t.Fatalf("ProcessIncremental() returned an error: %v", err)
+	}
+	second, err := ProcessIncremental(strings.NewReader(reordered), first.State)
+	if err != nil {
+		t.Fatalf("ProcessIncremental() returned an error: %v", err)
+	}
+	if second.Changes.Changed != 0 || second.Changes.Unchanged != 2 {
+		t.Errorf("ProcessIncremental() of reordered rows = %+v; want 2 unchanged customers", second.Changes)
+	}
+}
+
+func TestImportStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state, err := LoadImportState(path)
+	if err != nil || len(state.Customers) != 0 {
+		t.Fatalf("LoadImportState() without a file = %+v, %v; want an empty state", state, err)
+	}
+
+	result, err := ProcessIncremental(strings.NewReader(incrementalDayOne), ImportState{})
+	if err != nil {
+		t.Fatalf("ProcessIncremental() returned an error: %v", err)
+	}
+	if err := SaveImportState(path, result.State); err != nil {
+		t.Fatalf("SaveImportState() returned an error: %v", err)
+	}
+	loaded, err := LoadImportState(path)
+	if err != nil {
+		t.Fatalf("LoadImportState() returned an error: %v", err)
+	}
+	if !loaded.Saved.Equal(result.State.Saved) || !reflect.DeepEqual(loaded.Customers, result.State.Customers) || !reflect.DeepEqual(loaded.DomainCounts, result.State.DomainCounts) {
+		t.Errorf("LoadImportState() = %+v; want %+v", loaded, result.State)
+	}
+
+	os.WriteFile(path, []byte("{not json"), 0o644)
+	if _, err := LoadImportState(path); err == nil {
+		t.Errorf("LoadImportState() did not return an error for a corrupt file")
+	}
+}
@@ -0,0 +1,414 @@
+package customerimporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job states; queued and running jobs are resumed after a restart
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Errors returned by JobQueue lookups and cancellation
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job has already finished")
+)
+
+// Job is one queued import and, once it has run, its result
+type Job struct {
+	ID       string        `json:"id"`
+	State    string        `json:"state"`
+	Created  time.Time     `json:"created"`
+	Started  *time.Time    `json:"started,omitempty"`
+	Finished *time.Time    `json:"finished,omitempty"`
+	Rows     int           `json:"rows"`    // Valid rows counted
+	Skipped  int           `json:"skipped"` // Rows skipped as invalid
+	Error    string        `json:"error,omitempty"`
+	Domains  []DomainCount `json:"domains,omitempty"` // By count, descending, then by domain
+}
+
+// Done reports whether the job has reached a final state
+func (j Job) Done() bool {
+	return j.State == JobSucceeded || j.State == JobFailed || j.State == JobCancelled
+}
+
+// summary returns the webhook payload for a finished job
+func (j Job) summary() RunSummary {
+	summary := RunSummary{
+		Event:      EventImportSucceeded,
+		JobID:      j.ID,
+		Rows:       j.Rows,
+		Rejected:   j.Skipped,
+		Domains:    len(j.Domains),
+		TopDomains: topDomains(j.Domains),
+		Error:      j.Error,
+	}
+	if j.State == JobFailed {
+		summary.Event = EventImportFailed
+	}
+	if j.Started != nil {
+		summary.Started = *j.Started
+	}
+	if j.Finished != nil {
+		summary.Finished = *j.Finished
+	}
+	return summary
+}
+
+// FileJobStore persists each job as <id>.json in a directory, with its
+// uploaded input alongside as <id>.csv until the job finishes
+type FileJobStore struct {
+	dir string
+}
+
+// NewFileJobStore opens the store in dir, creating the directory if needed
+func NewFileJobStore(dir string) (*FileJobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating job directory: %w", err)
+	}
+	return &FileJobStore{dir: dir}, nil
+}
+
+func (s *FileJobStore) jobPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *FileJobStore) inputPath(id string) string {
+	return filepath.Join(s.dir, id+".csv")
+}
+
+// Save writes the job under a temporary name and renames it, so a crash never
+// leaves a partial job file
+func (s *FileJobStore) Save(job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("error encoding job %s: %w", job.ID, err)
+	}
+	tmp, err := os.CreateTemp(s.dir, ".job-*")
+	if err != nil {
+		return fmt.Errorf("error saving job %s: %w", job.ID, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error saving job %s: %w", job.ID, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error saving job %s: %w", job.ID, err)
+	}
+	if err := os.Rename(tmp.Name(), s.jobPath(job.ID)); err != nil {
+		return fmt.Errorf("error saving job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// Load returns every stored job, oldest first
+func (s *FileJobStore) Load() ([]Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading job directory: %w", err)
+	}
+	var jobs []Job
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("error reading job file: %w", err)
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("error parsing job file %s: %w", name, err)
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+	return jobs, nil
+}
+
+// Delete removes a job and its input
+func (s *FileJobStore) Delete(id string) error {
+	os.Remove(s.inputPath(id))
+	if err := os.Remove(s.jobPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting job %s: %w", id, err)
+	}
+	return nil
+}
+
+// JobQueueConfig tunes a JobQueue
+type JobQueueConfig struct {
+	Workers     int       // Jobs run at once
+	MaxFinished int       // Finished jobs kept; the oldest are deleted first
+	Import      RunConfig // Settings of each job's run
+}
+
+// DefaultJobQueueConfig returns the settings used by the serve command
+func DefaultJobQueueConfig() JobQueueConfig {
+	return JobQueueConfig{Workers: 2, MaxFinished: 1000}
+}
+
+// JobQueue runs submitted imports on a pool of workers with
+// ProcessWithConcurrentStreaming, each job in a Run of its own, persisting
+// every state change
+type JobQueue struct {
+	store  *FileJobStore
+	config JobQueueConfig
+
+	mu        sync.Mutex
+	ready     *sync.Cond // Signalled when pending grows or the queue closes
+	jobs      map[string]*Job
+	pending   []string                      // Queued job IDs, oldest first
+	running   map[string]context.CancelFunc // Cancels a running job
+	cancelled map[string]bool               // Running jobs cancelled through Cancel
+	closed    bool
+	ctx       context.Context // Cancelled by Close to interrupt running jobs
+	stop      context.CancelFunc
+	workers   sync.WaitGroup
+}
+
+// NewJobQueue loads the jobs in store and starts the workers. Jobs that were
+// queued or running when the previous process stopped are queued again.
+func NewJobQueue(store *FileJobStore, config JobQueueConfig) (*JobQueue, error) {
+	if config.Workers <= 0 {
+		return nil, fmt.Errorf("invalid job workers: %d", config.Workers)
+	}
+	jobs, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	q := &JobQueue{
+		store:     store,
+		config:    config,
+		jobs:      make(map[string]*Job),
+		running:   make(map[string]context.CancelFunc),
+		cancelled: make(map[string]bool),
+	}
+	q.ready = sync.NewCond(&q.mu)
+	q.ctx, q.stop = context.WithCancel(context.Background())
+	for i := range jobs {
+		job := &jobs[i]
+		if !job.Done() {
+			job.State, job.Started = JobQueued, nil
+			q.pending = append(q.pending, job.ID)
+		}
+		q.jobs[job.ID] = job
+	}
+	if len(q.pending) > 0 {
+		logger.Info("resuming unfinished jobs", "jobs", len(q.pending))
+	}
+	for i := 0; i < config.Workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	return q, nil
+}
+
+// Submit stores input and queues a job to import it
+func (q *JobQueue) Submit(input io.Reader) (Job, error) {
+	job := Job{ID: newImportID(), State: JobQueued, Created: time.Now().UTC()}
+	file, err := os.Create(q.store.inputPath(job.ID))
+	if err != nil {
+		return Job{}, fmt.Errorf("error storing job input: %w", err)
+	}
+	_, err = io.Copy(file, input)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = q.store.Save(job)
+	}
+	if err != nil {
+		q.store.Delete(job.ID)
+		return Job{}, fmt.Errorf("error storing job input: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs[job.ID] = &job
+	q.pending = append(q.pending, job.ID)
+	q.ready.Signal()
+	logger.Info("job queued", "id", job.ID)
+	return job, nil
+}
+
+// Get returns a copy of the job with the given ID
+func (q *JobQueue) Get(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return *job, nil
+}
+
+// Cancel stops a queued or running job. A queued job is cancelled at once; a
+// running job stops at its next read and is then marked cancelled.
+func (q *JobQueue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	switch {
+	case !ok:
+		return Job{}, ErrJobNotFound
+	case job.Done():
+		return *job, ErrJobFinished
+	case job.State == JobQueued:
+		for i, pendingID := range q.pending {
+			if pendingID == id {
+				q.pending = append(q.pending[:i], q.pending[i+1:]...)
+				break
+			}
+		}
+		q.finishLocked(job, JobCancelled, nil)
+	case job.State == JobRunning:
+		q.cancelled[id] = true
+		q.running[id]()
+	}
+	return *job, nil
+}
+
+// Close stops the workers, interrupting running jobs. Interrupted jobs stay
+// running in the store and are queued again by the next NewJobQueue.
+func (q *JobQueue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.ready.Broadcast()
+	q.mu.Unlock()
+	q.stop()
+	q.workers.Wait()
+}
+
+func (q *JobQueue) work() {
+	defer q.workers.Done()
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 && !q.closed {
+			q.ready.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		job := q.jobs[q.pending[0]]
+		q.pending = q.pending[1:]
+		ctx, cancel := context.WithCancel(q.ctx)
+		q.running[job.ID] = cancel
+		started := time.Now().UTC()
+		job.State, job.Started = JobRunning, &started
+		q.saveLocked(job)
+		q.mu.Unlock()
+
+		counts, rows, err := q.run(ctx, job.ID)
+		cancel()
+
+		q.mu.Lock()
+		cancelled := q.cancelled[job.ID]
+		delete(q.running, job.ID)
+		delete(q.cancelled, job.ID)
+		switch {
+		case cancelled:
+			q.finishLocked(job, JobCancelled, nil)
+		case q.ctx.Err() != nil:
+			// Interrupted by Close; left running so a restart resumes it
+			logger.Info("job interrupted by shutdown", "id", job.ID)
+		case err != nil:
+			job.Error = err.Error()
+			q.finishLocked(job, JobFailed, nil)
+		default:
+			job.Skipped = rows - countValid(counts)
+			q.finishLocked(job, JobSucceeded, counts)
+		}
+		finished := *job
+		q.mu.Unlock()
+		if finished.Done() {
+			reportFinished(finished, counts)
+		}
+	}
+}
+
+// run imports a job's stored input, returning the counts and data rows read
+func (q *JobQueue) run(ctx context.Context, id string) (map[string]int, int, error) {
+	file, err := os.Open(q.store.inputPath(id))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error opening job input: %w", err)
+	}
+	defer file.Close()
+	run := NewRun(q.config.Import)
+	defer run.LogSkipSummary()
+	counts, err := run.ProcessWithConcurrentStreamingContext(ctx, file)
+	rows := int(run.rows.Load())
+	if err != nil {
+		return nil, rows, err
+	}
+	if len(counts) == 0 {
+		return nil, rows, ErrNoRecords
+	}
+	return counts, rows, nil
+}
+
+// finishLocked moves job to a final state, drops its input and prunes the
+// oldest finished jobs beyond MaxFinished
+func (q *JobQueue) finishLocked(job *Job, state string, counts map[string]int) {
+	finished := time.Now().UTC()
+	job.State, job.Finished = state, &finished
+	if counts != nil {
+		job.Rows, job.Domains = countValid(counts), rankDomainCounts(counts)
+	}
+	q.saveLocked(job)
+	os.Remove(q.store.inputPath(job.ID))
+	logger.Info("job finished", "id", job.ID, "state", job.State, "rows", job.Rows)
+
+	var done []*Job
+	for _, j := range q.jobs {
+		if j.Done() {
+			done = append(done, j)
+		}
+	}
+	if q.config.MaxFinished <= 0 || len(done) <= q.config.MaxFinished {
+		return
+	}
+	sort.Slice(done, func(i, j int) bool { return done[i].Finished.Before(*done[j].Finished) })
+	for _, j := range done[:len(done)-q.config.MaxFinished] {
+		delete(q.jobs, j.ID)
+		if err := q.store.Delete(j.ID); err != nil {
+			logger.Warn("unable to delete job", "id", j.ID, "error", err)
+		}
+	}
+}
+
+// reportFinished records the snapshot of a succeeded job and notifies the
+// webhook of a succeeded or failed one. Workers call it without holding q.mu,
+// as both may write to disk.
+func reportFinished(job Job, counts map[string]int) {
+	if job.State == JobSucceeded {
+		recordSnapshot(Snapshot{JobID: job.ID, Mode: "serve", DomainCounts: counts})
+	}
+	if w := webhook; w != nil && job.State != JobCancelled {
+		w.Notify(job.summary())
+	}
+}
+
+// saveLocked persists job, logging failures; the in-memory state stays current
+func (q *JobQueue) saveLocked(job *Job) {
+	if err := q.store.Save(*job); err != nil {
+		logger.Warn("unable to save job", "id", job.ID, "error", err)
+	}
+}
@@ -0,0 +1,194 @@
+package customerimporter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const jobTestCSV = "first_name,last_name,email,gender,ip_address\n" +
+	"John,Doe,john@example.com,Male,1.1.1.1\n" +
+	"Jane,Doe,jane@example.com,Female,2.2.2.2\n" +
+	"Bob,Roe,bob@test.org,Male,3.3.3.3\n" +
+	"Bad,Row,not-an-email,Male,4.4.4.4\n"
+
+func newTestJobQueue(t *testing.T, dir string, config JobQueueConfig) *JobQueue {
+	t.Helper()
+	store, err := NewFileJobStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileJobStore() returned an error: %v", err)
+	}
+	q, err := NewJobQueue(store, config)
+	if err != nil {
+		t.Fatalf("NewJobQueue() returned an error: %v", err)
+	}
+	t.Cleanup(q.Close)
+	return q
+}
+
+// waitForJob polls until the job reaches a final state
+func waitForJob(t *testing.T, q *JobQueue, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatalf("Get(%s) returned an error: %v", id, err)
+		}
+		if job.Done() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestJobQueue_Run(t *testing.T) {
+	dir := t.TempDir()
+	q := newTestJobQueue(t, dir, DefaultJobQueueConfig())
+
+	tests := []struct {
+		input    string
+		expected string
+		rows     int
+	}{
+		{jobTestCSV, JobSucceeded, 3},
+		{"first_name,last_name,email,gender,ip_address\nBad,Row,not-an-email,Male,4.4.4.4\n", JobFailed, 0},
+	}
+	var ids []string
+	for _, test := range tests {
+		job, err := q.Submit(strings.NewReader(test.input))
+		if err != nil {
+			t.Fatalf("Submit() returned an error: %v", err)
+		}
+		if job.State != JobQueued {
+			t.Errorf("Submit() state = %s; want %s", job.State, JobQueued)
+		}
+		ids = append(ids, job.ID)
+	}
+	for i, test := range tests {
+		job := waitForJob(t, q, ids[i])
+		if job.State != test.expected || job.Rows != test.rows || job.Started == nil || job.Finished == nil {
+			t.Errorf("job %d = %+v; want %s with %d rows", i, job, test.expected, test.rows)
+		}
+		if _, err := os.Stat(q.store.inputPath(job.ID)); !os.IsNotExist(err) {
+			t.Errorf("job %d input was not removed when it finished", i)
+		}
+	}
+	if job, _ := q.Get(ids[0]); len(job.Domains) != 2 || job.Domains[0] != (DomainCount{"example.com", 2}) {
+		t.Errorf("job domains = %v; want example.com first with 2", job.Domains)
+	}
+	if job, _ := q.Get(ids[1]); job.Error != ErrNoRecords.Error() {
+		t.Errorf("job error = %q; want %q", job.Error, ErrNoRecords)
+	}
+	if _, err := q.Get("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Get(missing) = %v; want %v", err, ErrJobNotFound)
+	}
+
+	// Finished jobs are persisted and reloaded as they were
+	q.Close()
+	reloaded := newTestJobQueue(t, dir, DefaultJobQueueConfig())
+	for _, id := range ids {
+		before, _ := q.Get(id)
+		after, err := reloaded.Get(id)
+		if err != nil || after.State != before.State || after.Rows != before.Rows || len(after.Domains) != len(before.Domains) {
+			t.Errorf("reloaded job = %+v, %v; want %+v", after, err, before)
+		}
+	}
+}
+
+func TestJobQueue_ImportSettings(t *testing.T) {
+	config := DefaultJobQueueConfig()
+	config.Import = RunConfig{
+		Providers: ProviderRules{"example.com": {Aliases: []string{"test.org"}}},
+		Validator: testValidator(t),
+	}
+	q := newTestJobQueue(t, t.TempDir(), config)
+
+	// The provider rules fold bob's domain into example.com and the
+	// validation rules reject jane's row, on top of the invalid email
+	input := strings.Replace(jobTestCSV, "jane@example.com,Female", "jane@example.com,Robot", 1)
+	job, err := q.Submit(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Submit() returned an error: %v", err)
+	}
+	job = waitForJob(t, q, job.ID)
+	if job.State != JobSucceeded || job.Rows != 2 || job.Skipped != 2 || len(job.Domains) != 1 || job.Domains[0] != (DomainCount{"example.com", 2}) {
+		t.Errorf("job = %+v; want %s with 2 rows for example.com and 2 skipped", job, JobSucceeded)
+	}
+}
+
+func TestJobQueue_CancelAndResume(t *testing.T) {
+	dir := t.TempDir()
+	q := newTestJobQueue(t, dir, DefaultJobQueueConfig())
+	// With the workers stopped, submitted jobs stay queued
+	q.Close()
+	cancelled, err := q.Submit(strings.NewReader(jobTestCSV))
+	if err != nil {
+		t.Fatalf("Submit() returned an error: %v", err)
+	}
+	kept, _ := q.Submit(strings.NewReader(jobTestCSV))
+
+	job, err := q.Cancel(cancelled.ID)
+	if err != nil || job.State != JobCancelled {
+		t.Errorf("Cancel() = %s, %v; want %s", job.State, err, JobCancelled)
+	}
+	if _, err := q.Cancel(cancelled.ID); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("Cancel() of a cancelled job = %v; want %v", err, ErrJobFinished)
+	}
+	if _, err := q.Cancel("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Cancel(missing) = %v; want %v", err, ErrJobNotFound)
+	}
+
+	// A running job is interrupted through its context
+	ctx, cancel := context.WithCancel(context.Background())
+	q.mu.Lock()
+	q.jobs[kept.ID].State = JobRunning
+	q.running[kept.ID] = cancel
+	q.mu.Unlock()
+	if job, err := q.Cancel(kept.ID); err != nil || ctx.Err() == nil || !q.cancelled[kept.ID] {
+		t.Errorf("Cancel() of a running job = %+v, %v; want its context cancelled", job, err)
+	}
+
+	// Unfinished jobs run after a restart; cancelled ones stay cancelled
+	resumed := newTestJobQueue(t, dir, DefaultJobQueueConfig())
+	if job := waitForJob(t, resumed, kept.ID); job.State != JobSucceeded {
+		t.Errorf("resumed job state = %s; want %s", job.State, JobSucceeded)
+	}
+	if job, _ := resumed.Get(cancelled.ID); job.State != JobCancelled {
+		t.Errorf("cancelled job state after restart = %s; want %s", job.State, JobCancelled)
+	}
+}
+
+func TestJobQueue_MaxFinished(t *testing.T) {
+	q := newTestJobQueue(t, t.TempDir(), JobQueueConfig{Workers: 1, MaxFinished: 2})
+	var ids []string
+	for i := 0; i < 3; i++ {
+		job, err := q.Submit(strings.NewReader(jobTestCSV))
+		if err != nil {
+			t.Fatalf("Submit() returned an error: %v", err)
+		}
+		waitForJob(t, q, job.ID)
+		ids = append(ids, job.ID)
+	}
+	if _, err := q.Get(ids[0]); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Get() of the oldest job = %v; want %v", err, ErrJobNotFound)
+	}
+	if _, err := os.Stat(q.store.jobPath(ids[0])); !os.IsNotExist(err) {
+		t.Errorf("oldest job file was not deleted")
+	}
+	if _, err := q.Get(ids[2]); err != nil {
+		t.Errorf("Get() of the newest job returned an error: %v", err)
+	}
+}
+
+func TestNewJobQueue_InvalidWorkers(t *testing.T) {
+	store, _ := NewFileJobStore(t.TempDir())
+	if _, err := NewJobQueue(store, JobQueueConfig{}); err == nil {
+		t.Errorf("NewJobQueue() did not return an error for 0 workers")
+	}
+}
@@ -0,0 +1,125 @@
+package customerimporter
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Rows skipped for the same reason are logged individually up to this many
+// times; the rest are only counted and reported by LogSkipSummary
+const maxLogsPerReason = 10
+
+// Reasons attached to skipped rows
+const (
+	reasonReadError     = "read_error"
+	reasonFieldCount    = "field_count"
+	reasonInvalidEmail  = "invalid_email"
+	reasonInvalidDomain = "invalid_domain"
+	reasonRecordError   = "record_error"
+	reasonRule          = "rule"
+)
+
+// Logger used by every processing mode
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// SetLogger replaces the package logger
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// NewLogger builds a logger writing to w at level ("debug", "info", "warn" or
+// "error") in format ("text" or "json")
+func NewLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q: must be text or json", format)
+}
+
+// skipTally counts skipped rows per reason so repeated messages can be suppressed
+type skipTally struct {
+	mu     sync.Mutex
+	counts map[string]int // Since the last summary
+	totals map[string]int // Since the run began
+}
+
+// add counts one skip and returns the running total for its reason
+func (t *skipTally) add(reason string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.counts[reason]++
+	t.totals[reason]++
+	return t.counts[reason]
+}
+
+// snapshot returns a copy of the counts since the run began
+func (t *skipTally) snapshot() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := make(map[string]int, len(t.totals))
+	for reason, count := range t.totals {
+		counts[reason] = count
+	}
+	return counts
+}
+
+// reset returns the counts so far and starts a new tally
+func (t *skipTally) reset() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := t.counts
+	t.counts = make(map[string]int)
+	return counts
+}
+
+// logSkip logs a skipped row with its reason and structured attributes such as
+// line and domain. After maxLogsPerReason rows for one reason, further rows are
+// only counted.
+func (r *Run) logSkip(reason string, args ...any) {
+	if r.quiet {
+		return
+	}
+	metrics.rowRejected(reason)
+	n := r.skips.add(reason)
+	if n > maxLogsPerReason {
+		return
+	}
+	logger.Warn("skipping row", append([]any{"reason", reason}, args...)...)
+	if n == maxLogsPerReason {
+		logger.Warn("further rows skipped for this reason are counted but not logged", "reason", reason)
+	}
+}
+
+// LogSkipSummary logs how many rows the run skipped for each reason since
+// the last summary and resets the tally
+func (r *Run) LogSkipSummary() {
+	counts := r.skips.reset()
+	if len(counts) == 0 {
+		return
+	}
+	reasons := make([]string, 0, len(counts))
+	total := 0
+	for reason, count := range counts {
+		reasons = append(reasons, reason)
+		total += count
+	}
+	sort.Strings(reasons)
+	attrs := []any{"total", total}
+	for _, reason := range reasons {
+		attrs = append(attrs, reason, counts[reason])
+	}
+	logger.Info("skipped rows by reason", attrs...)
+}
@@ -0,0 +1,116 @@
+package customerimporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		level   string
+		format  string
+		wantErr bool
+	}{
+		{"info", "text", false},
+		{"DEBUG", "json", false},
+		{"warn", "JSON", false},
+		{"loud", "text", true},
+		{"info", "xml", true},
+	}
+
+	for _, test := range tests {
+		_, err := NewLogger(&bytes.Buffer{}, test.level, test.format)
+		if (err != nil) != test.wantErr {
+			t.Errorf("NewLogger(%q, %q) error = %v; want error %v", test.level, test.format, err, test.wantErr)
+		}
+	}
+}
+
+// captureLogs installs a JSON logger for the test and returns its output
+func captureLogs(t *testing.T, level string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	l, err := NewLogger(&buf, level, "json")
+	if err != nil {
+		t.Fatalf("NewLogger() returned an error: %v", err)
+	}
+	previous := logger
+	SetLogger(l)
+	t.Cleanup(func() { SetLogger(previous) })
+	return &buf
+}
+
+// decodeLogs parses JSON log lines
+func decodeLogs(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Invalid JSON log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestLogSkip_RateLimitedWithTally(t *testing.T) {
+	buf := captureLogs(t, "info")
+	run := NewRun(RunConfig{})
+
+	for i := 0; i < 25; i++ {
+		run.logSkip(reasonInvalidEmail, "line", i+2, "email", "bad")
+	}
+	run.logSkip(reasonFieldCount, "line", 30, "fields", 2)
+	run.LogSkipSummary()
+
+	entries := decodeLogs(t, buf)
+	skipped := map[string]int{}
+	var summary map[string]interface{}
+	for _, entry := range entries {
+		switch entry["msg"] {
+		case "skipping row":
+			skipped[entry["reason"].(string)]++
+		case "skipped rows by reason":
+			summary = entry
+		}
+	}
+	if skipped[reasonInvalidEmail] != maxLogsPerReason || skipped[reasonFieldCount] != 1 {
+		t.Errorf("logSkip() logged %v; want %d invalid_email and 1 field_count", skipped, maxLogsPerReason)
+	}
+	if summary == nil || summary["total"] != 26.0 || summary[reasonInvalidEmail] != 25.0 || summary[reasonFieldCount] != 1.0 {
+		t.Errorf("LogSkipSummary() logged %v; want a total of 26 with 25 invalid_email and 1 field_count", summary)
+	}
+
+	// The tally starts afresh after a summary
+	buf.Reset()
+	run.LogSkipSummary()
+	if buf.Len() != 0 {
+		t.Errorf("LogSkipSummary() logged %q after a reset; want nothing", buf.String())
+	}
+}
+
+func TestLogSkip_StructuredFields(t *testing.T) {
+	buf := captureLogs(t, "warn")
+
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n" +
+		"Jane,Doe,not-an-email,Female,2.2.2.2\n"
+	if _, err := ProcessDistinct(strings.NewReader(data)); err != nil {
+		t.Fatalf("ProcessDistinct() returned an error: %v", err)
+	}
+
+	entries := decodeLogs(t, buf)
+	if len(entries) != 1 {
+		t.Fatalf("ProcessDistinct() logged %d entries at warn level; want 1: %s", len(entries), buf)
+	}
+	entry := entries[0]
+	if entry["level"] != "WARN" || entry["reason"] != reasonInvalidEmail || entry["line"] != 3.0 || entry["email"] != "not-an-email" {
+		t.Errorf("ProcessDistinct() logged %v; want an invalid_email warning for line 3", entry)
+	}
+}
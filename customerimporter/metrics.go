@@ -0,0 +1,198 @@
+package customerimporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Upper bounds in seconds of the chunk parse latency histogram buckets
+var chunkLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// histogram is a cumulative Prometheus-style histogram
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64 // Per bucket, not cumulative; the last entry is +Inf
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+func (h *histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// importMetrics holds the counters exposed on /metrics
+type importMetrics struct {
+	rowsRead       atomic.Int64
+	chunksInFlight atomic.Int64
+	busyNanos      atomic.Int64
+	chunkLatency   *histogram
+
+	mu       sync.Mutex
+	rejected map[string]int64 // By skip reason
+}
+
+func newImportMetrics() *importMetrics {
+	return &importMetrics{chunkLatency: newHistogram(chunkLatencyBuckets), rejected: make(map[string]int64)}
+}
+
+// Process-wide metrics shared by every processing mode
+var metrics = newImportMetrics()
+
+func (m *importMetrics) rowRead() {
+	m.rowsRead.Add(1)
+}
+
+func (m *importMetrics) rowRejected(reason string) {
+	m.mu.Lock()
+	m.rejected[reason]++
+	m.mu.Unlock()
+}
+
+// chunkStarted marks a chunk as in flight and returns a function that records
+// its latency and worker time when it completes. Each chunk has a worker of its
+// own, so the chunks in flight are also the busy workers.
+func (m *importMetrics) chunkStarted() func() {
+	m.chunksInFlight.Add(1)
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		m.chunkLatency.Observe(elapsed.Seconds())
+		m.busyNanos.Add(int64(elapsed))
+		m.chunksInFlight.Add(-1)
+	}
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format
+func (m *importMetrics) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	writeMetricHeader(bw, "customerimporter_rows_read_total", "counter", "Data rows read from the input.")
+	fmt.Fprintf(bw, "customerimporter_rows_read_total %d\n", m.rowsRead.Load())
+
+	writeMetricHeader(bw, "customerimporter_rows_rejected_total", "counter", "Rows skipped, by reason.")
+	m.mu.Lock()
+	reasons := make([]string, 0, len(m.rejected))
+	for reason := range m.rejected {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(bw, "customerimporter_rows_rejected_total{reason=\"%s\"} %d\n", escapeLabel(reason), m.rejected[reason])
+	}
+	m.mu.Unlock()
+
+	writeMetricHeader(bw, "customerimporter_chunks_in_flight", "gauge", "Chunks being validated and counted by concurrent-streaming workers, one worker per chunk.")
+	fmt.Fprintf(bw, "customerimporter_chunks_in_flight %d\n", m.chunksInFlight.Load())
+
+	writeMetricHeader(bw, "customerimporter_worker_busy_seconds_total", "counter", "Total time concurrent-streaming workers spent processing chunks; its rate is the average number of busy workers.")
+	fmt.Fprintf(bw, "customerimporter_worker_busy_seconds_total %s\n", formatFloat(time.Duration(m.busyNanos.Load()).Seconds()))
+
+	h := m.chunkLatency
+	writeMetricHeader(bw, "customerimporter_chunk_parse_seconds", "histogram", "Time to validate and count one chunk of rows; concurrent-streaming mode only.")
+	h.mu.Lock()
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(bw, "customerimporter_chunk_parse_seconds_bucket{le=\"%s\"} %d\n", formatFloat(bound), cumulative)
+	}
+	fmt.Fprintf(bw, "customerimporter_chunk_parse_seconds_bucket{le=\"+Inf\"} %d\n", h.count)
+	fmt.Fprintf(bw, "customerimporter_chunk_parse_seconds_sum %s\n", formatFloat(h.sum))
+	fmt.Fprintf(bw, "customerimporter_chunk_parse_seconds_count %d\n", h.count)
+	h.mu.Unlock()
+	return bw.Flush()
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeLabel escapes a label value for the text exposition formats
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// MetricsHandler serves the importer metrics in Prometheus text format
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.WritePrometheus(w)
+	})
+}
+
+// ServeMetrics starts an HTTP server exposing /metrics on addr. The returned
+// server's Addr holds the bound address; Close it to stop serving.
+func ServeMetrics(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error starting metrics server: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler())
+	server := &http.Server{Addr: listener.Addr().String(), Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go server.Serve(listener)
+	logger.Info("serving metrics", "address", server.Addr)
+	return server, nil
+}
+
+// WriteOpenMetrics writes domain counts in OpenMetrics text format, sorted by domain
+func WriteOpenMetrics(w io.Writer, domainCounts map[string]int) error {
+	domains := make([]string, 0, len(domainCounts))
+	for domain := range domainCounts {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	bw := bufio.NewWriter(w)
+	writeMetricHeader(bw, "customerimporter_domain_customers", "gauge", "Customers per email domain in the last import.")
+	for _, domain := range domains {
+		fmt.Fprintf(bw, "customerimporter_domain_customers{domain=\"%s\"} %d\n", escapeLabel(domain), domainCounts[domain])
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+// writeOpenMetricsFile writes the domain counts for a textfile collector. The
+// file is written under a temporary name, which the collector's *.prom glob
+// does not match, and renamed so scrapes never see a partial file.
+func writeOpenMetricsFile(domainCounts map[string]int, outputFileName string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(outputFileName), ".customerimporter-*.prom.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := WriteOpenMetrics(tmp, domainCounts); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing metrics file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), outputFileName); err != nil {
+		return fmt.Errorf("error writing metrics file: %w", err)
+	}
+	return nil
+}
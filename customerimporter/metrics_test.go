@@ -0,0 +1,123 @@
+package customerimporter
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// resetMetrics gives the test a fresh registry
+func resetMetrics(t *testing.T) {
+	t.Helper()
+	previous := metrics
+	metrics = newImportMetrics()
+	t.Cleanup(func() { metrics = previous })
+}
+
+func TestMetrics_CollectedByStreaming(t *testing.T) {
+	resetMetrics(t)
+
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n" +
+		"Jane,Doe,jane@example.com,Female,2.2.2.2\n" +
+		"Bad,Row,not-an-email,Male,3.3.3.3\n"
+	file := writeStrictTestFile(t, data)
+	if _, err := ProcessWithConcurrentStreaming(file); err != nil {
+		t.Fatalf("ProcessWithConcurrentStreaming() returned an error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := metrics.WritePrometheus(&buf); err != nil {
+		t.Fatalf("WritePrometheus() returned an error: %v", err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"# TYPE customerimporter_rows_read_total counter\ncustomerimporter_rows_read_total 3\n",
+		`customerimporter_rows_rejected_total{reason="invalid_domain"} 1` + "\n",
+		"customerimporter_chunks_in_flight 0\n",
+		"# TYPE customerimporter_chunk_parse_seconds histogram\n",
+		`customerimporter_chunk_parse_seconds_bucket{le="+Inf"} 1` + "\n",
+		"customerimporter_chunk_parse_seconds_count 1\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("WritePrometheus() output is missing %q:\n%s", expected, out)
+		}
+	}
+}
+
+func TestHistogram_Observe(t *testing.T) {
+	h := newHistogram([]float64{0.1, 1})
+	for _, v := range []float64{0.05, 0.1, 0.5, 2} {
+		h.Observe(v)
+	}
+	expected := []uint64{2, 1, 1}
+	for i, count := range expected {
+		if h.counts[i] != count {
+			t.Errorf("Observe() bucket %d = %d; want %d", i, h.counts[i], count)
+		}
+	}
+	if h.count != 4 || h.sum != 2.65 {
+		t.Errorf("Observe() count, sum = %d, %v; want 4, 2.65", h.count, h.sum)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	resetMetrics(t)
+	metrics.rowRead()
+
+	server, err := ServeMetrics("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ServeMetrics() returned an error: %v", err)
+	}
+	defer server.Close()
+
+	resp, err := http.Get("http://" + server.Addr + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics returned an error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("GET /metrics Content-Type = %q; want Prometheus text format", resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), "customerimporter_rows_read_total 1\n") {
+		t.Errorf("GET /metrics body = %q; want one row read", body)
+	}
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	counts := map[string]int{"example.com": 2, `we"ird.com`: 1}
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(&buf, counts); err != nil {
+		t.Fatalf("WriteOpenMetrics() returned an error: %v", err)
+	}
+	expected := "# HELP customerimporter_domain_customers Customers per email domain in the last import.\n" +
+		"# TYPE customerimporter_domain_customers gauge\n" +
+		"customerimporter_domain_customers{domain=\"example.com\"} 2\n" +
+		"customerimporter_domain_customers{domain=\"we\\\"ird.com\"} 1\n" +
+		"# EOF\n"
+	if buf.String() != expected {
+		t.Errorf("WriteOpenMetrics() = %q; want %q", buf.String(), expected)
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "domains.prom")
+	if err := writeOpenMetricsFile(counts, outputFile); err != nil {
+		t.Fatalf("writeOpenMetricsFile() returned an error: %v", err)
+	}
+	file, err := os.Open(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to open metrics file: %v", err)
+	}
+	defer file.Close()
+	written, _ := io.ReadAll(file)
+	if string(written) != expected {
+		t.Errorf("writeOpenMetricsFile() wrote %q; want %q", written, expected)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(outputFile)); len(entries) != 1 {
+		t.Errorf("writeOpenMetricsFile() left %d files behind; want only the metrics file", len(entries))
+	}
+}
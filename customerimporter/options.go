@@ -0,0 +1,359 @@
+package customerimporter
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options holds the command-line settings that tune how a run is processed
+type Options struct {
+	MaxMemory   int64 // Memory budget in bytes for external aggregation; 0 keeps all counts in memory
+	Approximate bool  // Estimate counts with sketches instead of counting exactly
+	Sketch      ApproximateConfig
+	Distinct    bool   // Count unique normalised emails per domain instead of rows
+	Duplicates  string // Path of the duplicate-email report; empty disables it
+	DedupReport string // Path of the fuzzy probable-duplicate cluster report; empty disables it
+	DedupLimit  float64
+	Providers   string // Path of a JSON provider rule table merged over the defaults
+	Rules       string // Path of a JSON validation rules file applied by every mode
+	RejectFile  string // Path of the JSON reject report with per-rule counts
+	CountPolicy RecordCountPolicy
+	Strict      bool   // Abort on the first malformed row instead of skipping it
+	LogLevel    string // debug, info, warn or error
+	LogFormat   string // text or json
+	Progress    bool   // Report progress while reading the input
+	MetricsAddr string // Address of the /metrics HTTP endpoint; empty disables it
+	OpenMetrics string // Path of an OpenMetrics dump of the domain counts
+	TraceFile   string // Path of an OTLP/JSON trace file; empty disables it
+	TraceURL    string // OTLP/HTTP traces endpoint of a collector; empty disables it
+	Webhook     WebhookConfig
+	Checkpoint  CheckpointConfig
+	StateFile   string // Path of the state store compared and updated by incremental runs; empty disables it
+	ChangesFile string // Path of the JSON change report of an incremental run
+	SnapshotDir string // Directory of the snapshot store; empty disables snapshots
+	Database    string // SQLite database file customers are loaded into; empty disables loading
+	Sink        SQLSinkConfig
+}
+
+// parseOptions parses the command-line flags passed to the CLI
+func parseOptions(args []string) (Options, error) {
+	opts := Options{Sketch: DefaultApproximateConfig(), DedupLimit: DefaultDedupThreshold, CountPolicy: DefaultRecordCountPolicy(), Webhook: DefaultWebhookConfig(), Sink: DefaultSQLSinkConfig(), Checkpoint: CheckpointConfig{Interval: 30 * time.Second}}
+	var maxMemory string
+	var hllPrecision uint
+
+	flags := flag.NewFlagSet("customerimporter", flag.ContinueOnError)
+	flags.StringVar(&maxMemory, "max-memory", "", "memory budget for domain counts (e.g. 256MB); spills to disk when exceeded")
+	flags.BoolVar(&opts.Approximate, "approximate", false, "estimate top domains and distinct counts with Count-Min Sketch and HyperLogLog")
+	flags.IntVar(&opts.Sketch.TopN, "top", opts.Sketch.TopN, "number of top domains to report in approximate mode")
+	flags.Float64Var(&opts.Sketch.Epsilon, "epsilon", opts.Sketch.Epsilon, "Count-Min relative error bound in approximate mode")
+	flags.Float64Var(&opts.Sketch.Delta, "delta", opts.Sketch.Delta, "Count-Min failure probability in approximate mode")
+	flags.UintVar(&hllPrecision, "hll-precision", uint(opts.Sketch.HLLPrecision), "HyperLogLog precision (4-18) in approximate mode")
+	flags.BoolVar(&opts.Distinct, "distinct", false, "count unique customers (normalised emails) per domain instead of rows")
+	flags.StringVar(&opts.Duplicates, "duplicates-report", "", "write emails appearing more than once, with their row numbers, to this CSV file")
+	flags.StringVar(&opts.DedupReport, "fuzzy-dedup", "", "write clusters of probable duplicate customers to this CSV file")
+	flags.Float64Var(&opts.DedupLimit, "dedup-threshold", opts.DedupLimit, "minimum confidence (0-1) for two records to be clustered by --fuzzy-dedup")
+	flags.StringVar(&opts.Providers, "provider-rules", "", "JSON file of per-domain address rules (ignore_dots, strip_plus_tags, aliases)")
+	flags.StringVar(&opts.Rules, "rules", "", "JSON validation rules file with per-column constraints")
+	flags.StringVar(&opts.RejectFile, "reject-report", "", "write per-rule rejection counts to this JSON file (requires --rules)")
+	flags.IntVar(&opts.CountPolicy.MinRecords, "min-records", opts.CountPolicy.MinRecords, "fewest valid records accepted")
+	flags.IntVar(&opts.CountPolicy.MaxRecords, "max-records", opts.CountPolicy.MaxRecords, "most valid records accepted (0 for no limit)")
+	flags.Float64Var(&opts.CountPolicy.MaxRejectRatio, "max-reject-ratio", 0, "largest share (0-1) of invalid rows accepted, e.g. 0.05; 0 disables the check")
+	flags.StringVar(&opts.CountPolicy.Action, "count-policy", opts.CountPolicy.Action, "what to do when a record-count limit is broken: fail or warn")
+	flags.StringVar(&opts.LogLevel, "log-level", "info", "minimum log level: debug, info, warn or error")
+	flags.StringVar(&opts.LogFormat, "log-format", "text", "log output format: text or json")
+	flags.BoolVar(&opts.Progress, "progress", false, "show a progress bar on a terminal, or periodic progress log lines otherwise")
+	flags.StringVar(&opts.MetricsAddr, "metrics-addr", "", "serve Prometheus metrics on this address (e.g. :9090) at /metrics")
+	flags.StringVar(&opts.OpenMetrics, "openmetrics-file", "", "write the final domain counts to this file in OpenMetrics format")
+	flags.StringVar(&opts.TraceFile, "trace-file", "", "write pipeline trace spans to this file as OTLP/JSON lines")
+	flags.StringVar(&opts.TraceURL, "trace-endpoint", "", "send pipeline trace spans to this OTLP/HTTP endpoint (e.g. http://localhost:4318/v1/traces)")
+	flags.BoolVar(&opts.Strict, "strict", false, "abort on the first malformed row with its file, line, column and value")
+	flags.StringVar(&opts.Checkpoint.File, "checkpoint-file", "", "periodically save progress to this file so an interrupted import can be resumed")
+	flags.DurationVar(&opts.Checkpoint.Interval, "checkpoint-interval", opts.Checkpoint.Interval, "least time between checkpoints")
+	flags.BoolVar(&opts.Checkpoint.Resume, "resume", false, "continue from the last checkpoint in --checkpoint-file")
+	flags.StringVar(&opts.SnapshotDir, "snapshot-dir", "", "store the domain counts of every run in this directory for the trends command")
+	flags.StringVar(&opts.StateFile, "state-file", "", "compare customers with the previous run's fingerprints in this file and update it")
+	flags.StringVar(&opts.ChangesFile, "changes-report", "", "write added, removed and changed customers and per-domain deltas to this JSON file (requires --state-file)")
+	flags.StringVar(&opts.Database, "db", "", "load customers into this SQLite database, upserting them by normalised email")
+	flags.StringVar(&opts.Sink.Table, "db-table", opts.Sink.Table, "table customers are loaded into (created or migrated as needed)")
+	flags.IntVar(&opts.Sink.BatchSize, "db-batch-size", opts.Sink.BatchSize, "customers upserted per transaction")
+	webhookFlags(flags, &opts.Webhook)
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	if opts.Database != "" {
+		if err := opts.Sink.validate(); err != nil {
+			return opts, fmt.Errorf("invalid database options: %w", err)
+		}
+		if opts.Approximate || maxMemory != "" || opts.Distinct || opts.Duplicates != "" || opts.StateFile != "" {
+			return opts, fmt.Errorf("--db cannot be combined with --approximate, --max-memory, --distinct, --duplicates-report or --state-file")
+		}
+	}
+	// Each of these flags picks the processing mode, so only one may be set
+	if opts.Approximate && maxMemory != "" {
+		return opts, fmt.Errorf("--approximate and --max-memory cannot be combined")
+	}
+	if (opts.Distinct || opts.Duplicates != "") && (opts.Approximate || maxMemory != "") {
+		return opts, fmt.Errorf("--distinct and --duplicates-report cannot be combined with --approximate or --max-memory")
+	}
+	if opts.ChangesFile != "" && opts.StateFile == "" {
+		return opts, fmt.Errorf("--changes-report requires --state-file")
+	}
+	if opts.StateFile != "" && (opts.Approximate || maxMemory != "" || opts.Distinct || opts.Duplicates != "") {
+		return opts, fmt.Errorf("--state-file cannot be combined with --approximate, --max-memory, --distinct or --duplicates-report")
+	}
+	if opts.Checkpoint.Resume && opts.Checkpoint.File == "" {
+		return opts, fmt.Errorf("--resume requires --checkpoint-file")
+	}
+	if opts.Checkpoint.Interval < MinCheckpointInterval {
+		return opts, fmt.Errorf("invalid --checkpoint-interval: %s is shorter than %s", opts.Checkpoint.Interval, MinCheckpointInterval)
+	}
+	webhookSecretFromEnv(&opts.Webhook)
+	if err := validateWebhookConfig(opts.Webhook); err != nil {
+		return opts, err
+	}
+	if hllPrecision > 18 {
+		return opts, fmt.Errorf("invalid --hll-precision: %d", hllPrecision)
+	}
+	opts.Sketch.HLLPrecision = uint8(hllPrecision)
+	if opts.RejectFile != "" && opts.Rules == "" {
+		return opts, fmt.Errorf("--reject-report requires --rules")
+	}
+	if _, err := NewLogger(io.Discard, opts.LogLevel, opts.LogFormat); err != nil {
+		return opts, err
+	}
+	if opts.TraceFile != "" && opts.TraceURL != "" {
+		return opts, fmt.Errorf("--trace-file and --trace-endpoint cannot be combined")
+	}
+	if opts.OpenMetrics != "" && (opts.Approximate || maxMemory != "") {
+		return opts, fmt.Errorf("--openmetrics-file needs exact in-memory counts; it cannot be combined with --approximate or --max-memory")
+	}
+	if err := opts.CountPolicy.validate(); err != nil {
+		return opts, fmt.Errorf("invalid record-count policy: %w", err)
+	}
+	if opts.DedupReport != "" && (opts.Approximate || maxMemory != "") {
+		return opts, fmt.Errorf("--fuzzy-dedup holds every row in memory; it cannot be combined with --approximate or --max-memory")
+	}
+	if opts.DedupLimit <= 0 || opts.DedupLimit > 1 {
+		return opts, fmt.Errorf("invalid --dedup-threshold: %g", opts.DedupLimit)
+	}
+	if opts.Approximate {
+		if err := opts.Sketch.validate(); err != nil {
+			return opts, fmt.Errorf("invalid approximate settings: %w", err)
+		}
+	}
+
+	if maxMemory != "" {
+		size, err := parseByteSize(maxMemory)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --max-memory: %w", err)
+		}
+		opts.MaxMemory = size
+	}
+	return opts, nil
+}
+
+// Environment variable holding the default webhook signing secret, which keeps
+// it out of the process list
+const webhookSecretEnv = "CUSTOMERIMPORTER_WEBHOOK_SECRET"
+
+// webhookFlags registers the webhook flags shared by the CLI and serve command
+func webhookFlags(flags *flag.FlagSet, config *WebhookConfig) {
+	flags.StringVar(&config.URL, "webhook-url", "", "POST a JSON run summary to this URL when an import succeeds or fails")
+	flags.StringVar(&config.Secret, "webhook-secret", "", "sign webhook bodies with HMAC-SHA256 using this key; $"+webhookSecretEnv+" when unset")
+	flags.IntVar(&config.MaxAttempts, "webhook-attempts", config.MaxAttempts, "webhook delivery attempts before giving up")
+	flags.DurationVar(&config.InitialBackoff, "webhook-backoff", config.InitialBackoff, "wait before the first webhook retry, doubled for each further retry")
+	flags.StringVar(&config.DeadLetterFile, "webhook-dead-letter", "", "append run summaries that could not be delivered to this JSON lines file")
+}
+
+// webhookSecretFromEnv falls back to $CUSTOMERIMPORTER_WEBHOOK_SECRET after
+// parsing, so the secret is never shown as the flag's default in -h
+func webhookSecretFromEnv(config *WebhookConfig) {
+	if config.Secret == "" {
+		config.Secret = os.Getenv(webhookSecretEnv)
+	}
+}
+
+func validateWebhookConfig(config WebhookConfig) error {
+	if config.URL == "" {
+		if config.DeadLetterFile != "" {
+			return fmt.Errorf("--webhook-dead-letter requires --webhook-url")
+		}
+		return nil
+	}
+	u, err := url.Parse(config.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid --webhook-url %q: must be an http or https URL", config.URL)
+	}
+	if config.MaxAttempts <= 0 {
+		return fmt.Errorf("invalid --webhook-attempts: %d", config.MaxAttempts)
+	}
+	if config.InitialBackoff < 0 {
+		return fmt.Errorf("invalid --webhook-backoff: %s", config.InitialBackoff)
+	}
+	return nil
+}
+
+// Binary size units accepted by parseByteSize, longest suffix first
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// parseByteSize converts sizes such as "256MB", "1G" or "4096" to bytes
+func parseByteSize(value string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSpace(strings.TrimSuffix(upper, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%q is not a positive size", value)
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("%q is too large", value)
+	}
+	return n * multiplier, nil
+}
+
+// ServeOptions holds the settings of the serve command
+type ServeOptions struct {
+	Addr      string // Listen address of the import API
+	Server    ServerConfig
+	JobDir    string // Directory of the persisted job store
+	Queue     JobQueueConfig
+	Providers string // Path of a JSON provider rule table merged over the defaults
+	Rules     string // Path of a JSON validation rules file applied to every import
+	LogLevel  string
+	LogFormat string
+	Webhook   WebhookConfig
+	Snapshots string // Directory of the snapshot store; empty disables snapshots
+}
+
+// parseServeOptions parses the flags of the serve command
+func parseServeOptions(args []string) (ServeOptions, error) {
+	opts := ServeOptions{Server: DefaultServerConfig(), Queue: DefaultJobQueueConfig(), Webhook: DefaultWebhookConfig()}
+	maxUpload := "100MB"
+
+	flags := flag.NewFlagSet("customerimporter serve", flag.ContinueOnError)
+	flags.StringVar(&opts.Addr, "addr", ":8080", "listen address of the import API")
+	flags.StringVar(&maxUpload, "max-upload-size", maxUpload, "largest accepted upload (e.g. 100MB)")
+	flags.StringVar(&opts.JobDir, "job-dir", "customerimporter-jobs", "directory where jobs and their uploads are persisted")
+	flags.StringVar(&opts.Snapshots, "snapshot-dir", "", "store the domain counts of every successful import in this directory for the trends command")
+	flags.IntVar(&opts.Queue.Workers, "workers", opts.Queue.Workers, "imports run at once")
+	flags.IntVar(&opts.Queue.MaxFinished, "max-imports", opts.Queue.MaxFinished, "finished imports kept for GET /imports/{id}")
+	flags.StringVar(&opts.Providers, "provider-rules", "", "JSON file of per-domain address rules (ignore_dots, strip_plus_tags, aliases)")
+	flags.StringVar(&opts.Rules, "rules", "", "JSON validation rules file with per-column constraints")
+	flags.StringVar(&opts.LogLevel, "log-level", "info", "minimum log level: debug, info, warn or error")
+	flags.StringVar(&opts.LogFormat, "log-format", "text", "log output format: text or json")
+	webhookFlags(flags, &opts.Webhook)
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	if _, err := NewLogger(io.Discard, opts.LogLevel, opts.LogFormat); err != nil {
+		return opts, err
+	}
+	webhookSecretFromEnv(&opts.Webhook)
+	if err := validateWebhookConfig(opts.Webhook); err != nil {
+		return opts, err
+	}
+	if opts.Queue.Workers <= 0 {
+		return opts, fmt.Errorf("invalid --workers: %d", opts.Queue.Workers)
+	}
+	if opts.Queue.MaxFinished <= 0 {
+		return opts, fmt.Errorf("invalid --max-imports: %d", opts.Queue.MaxFinished)
+	}
+	size, err := parseByteSize(maxUpload)
+	if err != nil {
+		return opts, fmt.Errorf("invalid --max-upload-size: %w", err)
+	}
+	opts.Server.MaxUploadBytes = size
+	return opts, nil
+}
+
+// TrendsOptions holds the settings of the trends command
+type TrendsOptions struct {
+	SnapshotDir string
+	Trends      TrendOptions
+}
+
+// parseTrendsOptions parses the flags of the trends command
+func parseTrendsOptions(args []string) (TrendsOptions, error) {
+	opts := TrendsOptions{Trends: DefaultTrendOptions()}
+	var domains string
+
+	flags := flag.NewFlagSet("customerimporter trends", flag.ContinueOnError)
+	flags.StringVar(&opts.SnapshotDir, "snapshot-dir", "", "directory of the snapshot store")
+	flags.StringVar(&opts.Trends.From, "from", "", "snapshot ID to compare from (default the one before --to)")
+	flags.StringVar(&opts.Trends.To, "to", "", "snapshot ID to compare to (default the latest)")
+	flags.StringVar(&domains, "domain", "", "comma-separated domains to show growth for (default the --top largest)")
+	flags.IntVar(&opts.Trends.Top, "top", opts.Trends.Top, "domains listed in the growth and movers tables")
+	flags.IntVar(&opts.Trends.History, "history", opts.Trends.History, "snapshots shown in the growth table")
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	for _, domain := range strings.Split(domains, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			opts.Trends.Domains = append(opts.Trends.Domains, domain)
+		}
+	}
+	if opts.SnapshotDir == "" {
+		return opts, fmt.Errorf("--snapshot-dir is required")
+	}
+	if opts.Trends.Top <= 0 {
+		return opts, fmt.Errorf("invalid --top: %d", opts.Trends.Top)
+	}
+	if opts.Trends.History < 2 {
+		return opts, fmt.Errorf("invalid --history: %d; at least 2 snapshots are needed", opts.Trends.History)
+	}
+	return opts, nil
+}
+
+// DiffOptions holds the settings of the diff command
+type DiffOptions struct {
+	Old, New  string // Result files compared
+	Threshold DiffThreshold
+}
+
+// parseDiffOptions parses the flags and the two result files of the diff command
+func parseDiffOptions(args []string) (DiffOptions, error) {
+	var opts DiffOptions
+	flags := flag.NewFlagSet("customerimporter diff", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: customerimporter diff [flags] OLD NEW")
+		fmt.Fprintf(flags.Output(), "exits with %d when a difference is beyond the threshold\n", diffExceededStatus)
+		flags.PrintDefaults()
+	}
+	flags.IntVar(&opts.Threshold.MaxChange, "max-change", 0, "largest count change per domain tolerated")
+	flags.Float64Var(&opts.Threshold.MaxPercent, "max-change-pct", 0, "largest count change per domain tolerated, as a percentage of the old count")
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	if flags.NArg() != 2 {
+		return opts, fmt.Errorf("diff needs two result files, got %d", flags.NArg())
+	}
+	opts.Old, opts.New = flags.Arg(0), flags.Arg(1)
+	if opts.Threshold.MaxChange < 0 {
+		return opts, fmt.Errorf("invalid --max-change: %d", opts.Threshold.MaxChange)
+	}
+	if opts.Threshold.MaxPercent < 0 {
+		return opts, fmt.Errorf("invalid --max-change-pct: %g", opts.Threshold.MaxPercent)
+	}
+	return opts, nil
+}
@@ -0,0 +1,274 @@
+package customerimporter
+
+import (
+	"bytes"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int64
+		wantErr  bool
+	}{
+		{"4096", 4096, false},
+		{"256MB", 256 << 20, false},
+		{"256mb", 256 << 20, false},
+		{"1G", 1 << 30, false},
+		{"512 KiB", 512 << 10, false},
+		{"10B", 10, false},
+		{"", 0, true},
+		{"-5MB", 0, true},
+		{"lots", 0, true},
+		{"9223372036854775807", 9223372036854775807, false},
+		{"9223372036854775807KB", 0, true},
+		{"8589934592GB", 0, true},
+	}
+
+	for _, test := range tests {
+		result, err := parseByteSize(test.value)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseByteSize(%q) did not return an error", test.value)
+			}
+			continue
+		}
+		if err != nil || result != test.expected {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d", test.value, result, err, test.expected)
+		}
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	opts, err := parseOptions([]string{"--max-memory", "256MB"})
+	if err != nil {
+		t.Errorf("parseOptions() returned an error: %v", err)
+	}
+	if opts.MaxMemory != 256<<20 {
+		t.Errorf("parseOptions() MaxMemory = %d; want %d", opts.MaxMemory, 256<<20)
+	}
+
+	opts, err = parseOptions([]string{"--approximate", "--top", "5", "--epsilon", "0.01"})
+	if err != nil {
+		t.Errorf("parseOptions() returned an error: %v", err)
+	}
+	if !opts.Approximate || opts.Sketch.TopN != 5 || opts.Sketch.Epsilon != 0.01 || opts.Sketch.HLLPrecision != 14 {
+		t.Errorf("parseOptions() = %+v; want approximate mode with top 5 and epsilon 0.01", opts)
+	}
+
+	if _, err := parseOptions([]string{"--approximate", "--hll-precision", "30"}); err == nil {
+		t.Errorf("parseOptions() did not return an error for an invalid precision")
+	}
+
+	if _, err := parseOptions([]string{"--max-memory", "huge"}); err == nil {
+		t.Errorf("parseOptions() did not return an error for an invalid size")
+	}
+
+	opts, err = parseOptions([]string{"--min-records", "1", "--max-reject-ratio", "0.05", "--count-policy", "warn"})
+	if err != nil {
+		t.Errorf("parseOptions() returned an error: %v", err)
+	}
+	expected := RecordCountPolicy{MinRecords: 1, MaxRecords: MaxRecords, MaxRejectRatio: 0.05, Action: PolicyWarn}
+	if opts.CountPolicy != expected {
+		t.Errorf("parseOptions() CountPolicy = %+v; want %+v", opts.CountPolicy, expected)
+	}
+
+	opts, err = parseOptions([]string{"--strict"})
+	if err != nil || !opts.Strict {
+		t.Errorf("parseOptions() Strict = %v, %v; want true", opts.Strict, err)
+	}
+
+	opts, err = parseOptions([]string{"--log-level", "debug", "--log-format", "json"})
+	if err != nil || opts.LogLevel != "debug" || opts.LogFormat != "json" {
+		t.Errorf("parseOptions() = %q, %q, %v; want debug, json", opts.LogLevel, opts.LogFormat, err)
+	}
+
+	opts, err = parseOptions(nil)
+	if err != nil || opts.Progress {
+		t.Errorf("parseOptions() Progress = %v, %v; want false by default", opts.Progress, err)
+	}
+	opts, err = parseOptions([]string{"--progress"})
+	if err != nil || !opts.Progress {
+		t.Errorf("parseOptions() Progress = %v, %v; want true", opts.Progress, err)
+	}
+
+	for _, args := range [][]string{{"--fuzzy-dedup", "clusters.csv", "--approximate"}, {"--fuzzy-dedup", "clusters.csv", "--max-memory", "64MB"}} {
+		if _, err := parseOptions(args); err == nil {
+			t.Errorf("parseOptions(%v) did not return an error", args)
+		}
+	}
+
+	// Flags that each pick a processing mode are mutually exclusive
+	for _, args := range [][]string{
+		{"--approximate", "--max-memory", "64MB"},
+		{"--approximate", "--distinct"},
+		{"--approximate", "--duplicates-report", "duplicates.csv"},
+		{"--max-memory", "64MB", "--distinct"},
+		{"--max-memory", "64MB", "--duplicates-report", "duplicates.csv"},
+	} {
+		if _, err := parseOptions(args); err == nil {
+			t.Errorf("parseOptions(%v) did not return an error", args)
+		}
+	}
+	if _, err := parseOptions([]string{"--distinct", "--duplicates-report", "duplicates.csv"}); err != nil {
+		t.Errorf("parseOptions() returned an error for --distinct with --duplicates-report: %v", err)
+	}
+
+	if _, err := parseOptions([]string{"--openmetrics-file", "domains.prom", "--approximate"}); err == nil {
+		t.Errorf("parseOptions() did not return an error for --openmetrics-file with --approximate")
+	}
+
+	opts, err = parseOptions([]string{"--trace-file", "trace.jsonl"})
+	if err != nil || opts.TraceFile != "trace.jsonl" {
+		t.Errorf("parseOptions() TraceFile = %q, %v; want trace.jsonl", opts.TraceFile, err)
+	}
+
+	if _, err := parseOptions([]string{"--trace-file", "trace.jsonl", "--trace-endpoint", "http://localhost:4318/v1/traces"}); err == nil {
+		t.Errorf("parseOptions() did not return an error for --trace-file with --trace-endpoint")
+	}
+
+	opts, err = parseOptions([]string{"--webhook-url", "https://hooks.example.com/import", "--webhook-secret", "key", "--webhook-attempts", "3", "--webhook-backoff", "2s", "--webhook-dead-letter", "dead.jsonl"})
+	expectedWebhook := WebhookConfig{URL: "https://hooks.example.com/import", Secret: "key", MaxAttempts: 3, InitialBackoff: 2 * time.Second, MaxBackoff: DefaultWebhookConfig().MaxBackoff, DeadLetterFile: "dead.jsonl"}
+	if err != nil || opts.Webhook != expectedWebhook {
+		t.Errorf("parseOptions() Webhook = %+v, %v; want %+v", opts.Webhook, err, expectedWebhook)
+	}
+
+	t.Setenv(webhookSecretEnv, "from-env")
+	opts, err = parseOptions([]string{"--webhook-url", "http://localhost:8080/hook"})
+	if err != nil || opts.Webhook.Secret != "from-env" {
+		t.Errorf("parseOptions() Webhook.Secret = %q, %v; want from-env", opts.Webhook.Secret, err)
+	}
+	opts, err = parseOptions([]string{"--webhook-url", "http://localhost:8080/hook", "--webhook-secret", "key"})
+	if err != nil || opts.Webhook.Secret != "key" {
+		t.Errorf("parseOptions() Webhook.Secret = %q, %v; want the flag to override the environment", opts.Webhook.Secret, err)
+	}
+
+	for _, args := range [][]string{{"--webhook-url", "ftp://example.com"}, {"--webhook-dead-letter", "dead.jsonl"}, {"--webhook-url", "http://example.com", "--webhook-attempts", "0"}} {
+		if _, err := parseOptions(args); err == nil {
+			t.Errorf("parseOptions(%v) did not return an error", args)
+		}
+	}
+
+	opts, err = parseOptions([]string{"--checkpoint-file", "import.checkpoint", "--checkpoint-interval", "1m", "--resume"})
+	expectedCheckpoint := CheckpointConfig{File: "import.checkpoint", Interval: time.Minute, Resume: true}
+	if err != nil || opts.Checkpoint != expectedCheckpoint {
+		t.Errorf("parseOptions() Checkpoint = %+v, %v; want %+v", opts.Checkpoint, err, expectedCheckpoint)
+	}
+
+	for _, args := range [][]string{{"--resume"}, {"--checkpoint-file", "import.checkpoint", "--checkpoint-interval", "-1s"}, {"--checkpoint-file", "import.checkpoint", "--checkpoint-interval", "0s"}} {
+		if _, err := parseOptions(args); err == nil {
+			t.Errorf("parseOptions(%v) did not return an error", args)
+		}
+	}
+
+	opts, err = parseOptions([]string{"--state-file", "state.json", "--changes-report", "changes.json"})
+	if err != nil || opts.StateFile != "state.json" || opts.ChangesFile != "changes.json" {
+		t.Errorf("parseOptions() = %q, %q, %v; want state.json, changes.json", opts.StateFile, opts.ChangesFile, err)
+	}
+
+	for _, args := range [][]string{{"--changes-report", "changes.json"}, {"--state-file", "state.json", "--approximate"}, {"--state-file", "state.json", "--distinct"}} {
+		if _, err := parseOptions(args); err == nil {
+			t.Errorf("parseOptions(%v) did not return an error", args)
+		}
+	}
+
+	opts, err = parseOptions([]string{"--db", "customers.db", "--db-table", "people", "--db-batch-size", "100"})
+	expectedSink := SQLSinkConfig{Table: "people", BatchSize: 100}
+	if err != nil || opts.Database != "customers.db" || opts.Sink != expectedSink {
+		t.Errorf("parseOptions() = %q, %+v, %v; want customers.db, %+v", opts.Database, opts.Sink, err, expectedSink)
+	}
+
+	for _, args := range [][]string{{"--db", "customers.db", "--db-table", "bad name"}, {"--db", "customers.db", "--db-batch-size", "0"}, {"--db", "customers.db", "--approximate"}} {
+		if _, err := parseOptions(args); err == nil {
+			t.Errorf("parseOptions(%v) did not return an error", args)
+		}
+	}
+
+	if _, err := parseOptions([]string{"--log-format", "xml"}); err == nil {
+		t.Errorf("parseOptions() did not return an error for an invalid log format")
+	}
+
+	if _, err := parseOptions([]string{"--count-policy", "ignore"}); err == nil {
+		t.Errorf("parseOptions() did not return an error for an invalid count policy")
+	}
+
+	if _, err := parseOptions([]string{"--reject-report", "rejects.json"}); err == nil {
+		t.Errorf("parseOptions() did not return an error for --reject-report without --rules")
+	}
+}
+
+func TestParseServeOptions(t *testing.T) {
+	opts, err := parseServeOptions(nil)
+	if err != nil || opts.Addr != ":8080" || opts.Server != DefaultServerConfig() || !reflect.DeepEqual(opts.Queue, DefaultJobQueueConfig()) {
+		t.Errorf("parseServeOptions() = %+v, %v; want the defaults", opts, err)
+	}
+
+	opts, err = parseServeOptions([]string{"--addr", "127.0.0.1:9000", "--max-upload-size", "5MB", "--max-imports", "50", "--workers", "4", "--job-dir", "jobs"})
+	if err != nil || opts.Addr != "127.0.0.1:9000" || opts.Server.MaxUploadBytes != 5<<20 || !reflect.DeepEqual(opts.Queue, JobQueueConfig{Workers: 4, MaxFinished: 50}) || opts.JobDir != "jobs" {
+		t.Errorf("parseServeOptions() = %+v, %v; want 127.0.0.1:9000, 5 MiB, 4 workers, 50 imports and jobs", opts, err)
+	}
+
+	for _, args := range [][]string{{"--max-upload-size", "lots"}, {"--max-imports", "0"}, {"--workers", "0"}, {"--log-level", "loud"}} {
+		if _, err := parseServeOptions(args); err == nil {
+			t.Errorf("parseServeOptions(%v) did not return an error", args)
+		}
+	}
+}
+
+func TestWebhookFlags_SecretNotInUsage(t *testing.T) {
+	t.Setenv(webhookSecretEnv, "s3cret-from-env")
+	flags := flag.NewFlagSet("customerimporter", flag.ContinueOnError)
+	var usage bytes.Buffer
+	flags.SetOutput(&usage)
+	var config WebhookConfig
+	webhookFlags(flags, &config)
+	flags.PrintDefaults()
+
+	if strings.Contains(usage.String(), "s3cret-from-env") {
+		t.Errorf("usage shows the webhook secret:\n%s", usage.String())
+	}
+	if !strings.Contains(usage.String(), webhookSecretEnv) {
+		t.Errorf("usage does not mention $%s:\n%s", webhookSecretEnv, usage.String())
+	}
+}
+
+func TestParseTrendsOptions(t *testing.T) {
+	if _, err := parseTrendsOptions(nil); err == nil {
+		t.Errorf("parseTrendsOptions() did not return an error without --snapshot-dir")
+	}
+
+	opts, err := parseTrendsOptions([]string{"--snapshot-dir", "history"})
+	if err != nil || !reflect.DeepEqual(opts.Trends, DefaultTrendOptions()) {
+		t.Errorf("parseTrendsOptions() = %+v, %v; want the defaults", opts, err)
+	}
+
+	opts, err = parseTrendsOptions([]string{"--snapshot-dir", "history", "--from", "a", "--to", "b", "--domain", "example.com, another.com", "--top", "3", "--history", "4"})
+	expected := TrendOptions{From: "a", To: "b", Domains: []string{"example.com", "another.com"}, Top: 3, History: 4}
+	if err != nil || opts.SnapshotDir != "history" || !reflect.DeepEqual(opts.Trends, expected) {
+		t.Errorf("parseTrendsOptions() = %+v, %v; want history and %+v", opts, err, expected)
+	}
+
+	for _, args := range [][]string{{"--snapshot-dir", ""}, {"--top", "0"}, {"--history", "1"}} {
+		if _, err := parseTrendsOptions(args); err == nil {
+			t.Errorf("parseTrendsOptions(%v) did not return an error", args)
+		}
+	}
+}
+
+func TestParseDiffOptions(t *testing.T) {
+	opts, err := parseDiffOptions([]string{"--max-change", "5", "--max-change-pct", "2.5", "last.txt", "this.txt"})
+	expected := DiffOptions{Old: "last.txt", New: "this.txt", Threshold: DiffThreshold{MaxChange: 5, MaxPercent: 2.5}}
+	if err != nil || opts != expected {
+		t.Errorf("parseDiffOptions() = %+v, %v; want %+v", opts, err, expected)
+	}
+
+	for _, args := range [][]string{{"last.txt"}, {"a", "b", "c"}, {"--max-change", "-1", "a", "b"}, {"--max-change-pct", "-5", "a", "b"}} {
+		if _, err := parseDiffOptions(args); err == nil {
+			t.Errorf("parseDiffOptions(%v) did not return an error", args)
+		}
+	}
+}
@@ -2,101 +2,210 @@ package customerimporter
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"regexp"
 )
 
-const (
-	NoRecords  = 0
-	MinRecords = 1000
-	MaxRecords = 1000000
-	ChunkSize  = 1000
-	FieldCount = 5
-)
-
 // Regex pattern for validating email addresses
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 
 // Main Process Function
 func Process(inputFileName string, outputFileName string) (map[string]int, error) {
-	records, skipped, err := readCSV(inputFileName)
+	run := NewRun(RunConfig{})
+	defer run.LogSkipSummary()
+	return run.Process(inputFileName, outputFileName)
+}
+
+// Process is the package-level Process under the run's settings
+func (r *Run) Process(inputFileName string, outputFileName string) (map[string]int, error) {
+	span := r.config.Tracer.startSpan("customerimporter.Process")
+	defer span.End()
+
+	read := span.Child("read_csv")
+	records, skipped, cp, err := r.readCSVTraced(inputFileName, read)
+	read.SetAttr("rows", len(records))
+	read.SetAttr("skipped", skipped)
+	read.SetError(err)
+	read.End()
 	if err != nil {
-		return nil, fmt.Errorf("error processing CSV: %v", err)
+		span.SetError(err)
+		return nil, fmt.Errorf("error processing CSV: %w", err)
+	}
+
+	count := span.Child("count_domains")
+	domainCounts := r.countEmailDomains(records)
+	base, resumed := cp.Resumed()
+	if resumed {
+		mergeCounts(domainCounts, base.DomainCounts)
 	}
+	count.SetAttr("domains", len(domainCounts))
+	count.End()
 
-	domainCounts := countEmailDomains(records)
+	sorting := span.Child("sort_domains")
 	sortedDomains := sortDomains(domainCounts)
+	sorting.End()
+
+	write := span.Child("write_output")
 	err = writeOutput(sortedDomains, outputFileName)
+	write.SetError(err)
+	write.End()
 	if err != nil {
-		return nil, fmt.Errorf("error writing output: %v", err)
+		span.SetError(err)
+		return nil, fmt.Errorf("error writing output: %w", err)
 	}
 
-	log.Printf("Summary: Processed %d records, Skipped %d malformed rows", len(records), skipped)
+	cp.Finish()
+	logger.Info("summary", "processed", base.Valid+len(records), "skipped", skipped)
 	return domainCounts, nil
 }
 
 // CSV Reading and Validation
 func readCSV(fileName string) ([]Record, int, error) {
+	records, skipped, _, err := NewRun(RunConfig{}).readCSVTraced(fileName, nil)
+	return records, skipped, err
+}
+
+// readCSVTraced is readCSV recording stage timings on span and checkpointing
+// as the run is configured to. When resuming, the records are only those after
+// the checkpoint; the returned checkpointer holds the counts of the rest.
+func (r *Run) readCSVTraced(fileName string, span *Span) ([]Record, int, *checkpointer, error) {
 	file, err := os.Open(fileName)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error opening file: %v", err)
+		return nil, 0, nil, fmt.Errorf("error opening file: %w", err)
 	}
 	defer file.Close()
 
-	records, skipped, err := parseCSVRecords(file)
+	cp, err := r.openCheckpoint(file, checkpointSingle)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, nil, err
+	}
+	records, skipped, err := r.parseCSVRecordsFrom(file, span, cp)
+	if err != nil {
+		return nil, 0, nil, err
 	}
 
-	if err := validateRecordCounts(records, MinRecords, MaxRecords); err != nil {
-		return nil, 0, err
+	base, _ := cp.Resumed()
+	if err := r.checkProcessCounts(base.Valid+len(records), skipped); err != nil {
+		return nil, 0, nil, err
 	}
-	return records, skipped, nil
+	return records, skipped, cp, nil
 }
 
 func parseCSVRecords(file *os.File) ([]Record, int, error) {
-	reader := csv.NewReader(file)
+	return NewRun(RunConfig{}).parseCSVRecordsFrom(file, nil, nil)
+}
+
+// parseCSVRecordsFrom is parseCSVRecords under the run's settings, recording
+// the time spent in validation rules on span and saving checkpoints through
+// cp. When cp resumes a run, file is already past the checkpoint; the records
+// returned are the rest, while skipped includes the rows skipped before it.
+func (r *Run) parseCSVRecordsFrom(file *os.File, span *Span, cp *checkpointer) ([]Record, int, error) {
+	validate := newStageTimer(span)
+	defer validate.Record(span, "validate")
+	base, resumed := cp.Resumed()
+	progress := r.startProgress(inputSize(file))
+	defer progress.Stop()
+	progress.Resume(base.Offset)
+	reader := csv.NewReader(progress.Reader(file))
+	cp.Reader(reader)
 	var records []Record
-	var skipped int
+	skipped := base.Skipped
 
-	// Skip the first line (header row)
-	_, err := reader.Read()
-	if err == io.EOF {
-		return nil, 0, fmt.Errorf("file is empty or contains only headers")
+	// Skip the first line (header row), keeping its names for strict-mode errors
+	header, rowNumber, endLine := base.Header, base.Row, 0
+	if !resumed {
+		var err error
+		header, err = reader.Read()
+		if err == io.EOF {
+			return nil, 0, ErrEmptyFile
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("error reading header row: %w", err)
+		}
+		rowNumber, endLine = 1, recordEndLine(reader, header)
 	}
-	if err != nil {
-		return nil, 0, fmt.Errorf("error reading header row: %v", err)
+
+	// Counts of the records up to the last checkpoint, kept only for checkpoints
+	var counted map[string]int
+	if cp != nil {
+		counted = make(map[string]int)
+		mergeCounts(counted, base.DomainCounts)
 	}
+	countedRecords := 0
 
 	// Process the remaining rows
-	rowNumber := 1
 	for {
+		if cp.Due() {
+			mergeCounts(counted, r.countEmailDomains(records[countedRecords:]))
+			countedRecords = len(records)
+			err := cp.Save(Checkpoint{
+				Header:       header,
+				Offset:       base.Offset + reader.InputOffset(),
+				Row:          rowNumber,
+				Line:         base.Line + endLine,
+				Valid:        base.Valid + len(records),
+				Skipped:      skipped,
+				DomainCounts: counted,
+			})
+			if err != nil {
+				return nil, skipped, err
+			}
+		}
 		fields, err := reader.Read()
 		rowNumber++
 		if err == io.EOF {
 			break
 		}
+		r.rowRead()
 		if err != nil {
-			log.Printf("Error reading row %d: %v", rowNumber, err)
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				endLine = parseErr.Line
+			}
+			if err := r.strictReadError(file.Name(), rowNumber, err); err != nil {
+				return nil, skipped, err
+			}
+			r.logSkip(reasonReadError, "line", rowNumber, "error", err)
 			skipped++
 			continue
 		}
+		line, _ := reader.FieldPos(0)
+		line += base.Line
+		endLine = recordEndLine(reader, fields)
 		if len(fields) < FieldCount {
-			log.Printf("Skipping malformed row %d: %v", rowNumber, fields)
+			reason := fmt.Sprintf("expected %d fields, got %d", FieldCount, len(fields))
+			if err := r.strictRowError(file.Name(), line, header, -1, "", reason); err != nil {
+				return nil, skipped, err
+			}
+			r.logSkip(reasonFieldCount, "line", line, "fields", len(fields))
 			skipped++
 			continue
 		}
 		if !emailRegex.MatchString(fields[2]) {
-			log.Printf("Skipping row %d due to invalid email: %s", rowNumber, fields[2])
+			if err := r.strictRowError(file.Name(), line, header, 2, fields[2], "invalid email"); err != nil {
+				return nil, skipped, err
+			}
+			r.logSkip(reasonInvalidEmail, "line", line, "email", fields[2])
 			skipped++
 			continue
 		}
 		record, err := createRecord(fields)
 		if err != nil {
-			log.Printf("Skipping row %d due to error: %v", rowNumber, err)
+			r.logSkip(reasonRecordError, "line", line, "error", err)
+			skipped++
+			continue
+		}
+		validate.Start()
+		rule, ok := r.checkRecord(record)
+		validate.Stop()
+		if !ok {
+			if err := r.strictRuleError(file.Name(), line, rule, record); err != nil {
+				return nil, skipped, err
+			}
+			r.logSkip(reasonRule+":"+rule, "line", line)
 			skipped++
 			continue
 		}
@@ -1,62 +1,175 @@
 package customerimporter
 
 import (
+	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
-	"regexp"
+	"runtime"
 	"sync"
 )
 
-const ChunkSize = 1000
-
-// Regex pattern for validating email domains
-var domainRegex = regexp.MustCompile(`^[a-zA-Z0-9-]+\.[a-zA-Z]{2,}$`)
-
 // ProcessWithConcurrentStreaming processes a CSV file concurrently with streaming
 func ProcessWithConcurrentStreaming(file *os.File) (map[string]int, error) {
-	reader := csv.NewReader(file)
+	return ProcessWithConcurrentStreamingContext(context.Background(), file)
+}
+
+// ProcessWithConcurrentStreamingContext is ProcessWithConcurrentStreaming
+// stopping early, with an error wrapping ctx.Err(), once ctx is cancelled
+func ProcessWithConcurrentStreamingContext(ctx context.Context, file *os.File) (map[string]int, error) {
+	run := NewRun(RunConfig{})
+	defer run.LogSkipSummary()
+	return run.ProcessWithConcurrentStreamingContext(ctx, file)
+}
+
+// ProcessWithConcurrentStreaming is the package-level
+// ProcessWithConcurrentStreaming under the run's settings
+func (r *Run) ProcessWithConcurrentStreaming(file *os.File) (map[string]int, error) {
+	return r.ProcessWithConcurrentStreamingContext(context.Background(), file)
+}
+
+// ProcessWithConcurrentStreamingContext is the package-level
+// ProcessWithConcurrentStreamingContext under the run's settings
+func (r *Run) ProcessWithConcurrentStreamingContext(ctx context.Context, file *os.File) (map[string]int, error) {
+	span := r.config.Tracer.startSpan("customerimporter.ProcessWithConcurrentStreaming")
+	defer span.End()
+	cp, err := r.openCheckpoint(file, checkpointStreaming)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	base, _ := cp.Resumed()
+	progress := r.startProgress(inputSize(file))
+	defer progress.Stop()
+	progress.Resume(base.Offset)
+	reader := csv.NewReader(progress.Reader(contextReader{ctx: ctx, r: file}))
+	cp.Reader(reader)
 	ch := make(chan map[string]int)
-	var domainCounts sync.Map
+	domainCounts := newDomainCounter()
+	domainCounts.Merge(base.DomainCounts)
+	cp.TrackCounts(domainCounts)
 	var wg sync.WaitGroup
 
-	// Process chunks and collect results concurrently
-	processChunks(reader, ch, &wg)
-	collectResults(ch, &domainCounts)
+	// Collect results while chunks are read and processed, so a checkpoint
+	// can wait for the chunks before it to be merged
+	var collectors sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		collectors.Add(1)
+		go func() {
+			defer collectors.Done()
+			collectResults(ch, domainCounts, cp.pendingMerges())
+		}()
+	}
+	read := span.Child("read_csv")
+	rows, err := r.processChunks(reader, ch, &wg, span, cp)
+	read.SetAttr("rows", rows)
+	read.SetError(err)
+	read.End()
+	aggregate := span.Child("aggregate")
+	collectors.Wait()
+	aggregate.End()
+	if err != nil {
+		span.SetError(err)
+		return nil, fmt.Errorf("error reading CSV: %w", err)
+	}
 
-	// Convert sync.Map to regular map and return
-	return convertSyncMapToRegularMap(&domainCounts), nil
+	// Rows read before a resumed checkpoint count towards the totals
+	rows += base.Valid + base.Skipped
+	result := domainCounts.Snapshot()
+	valid := countValid(result)
+	if err := r.checkStreamingCounts(valid, rows-valid); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	cp.Finish()
+	return result, nil
+}
+
+// countValid totals the domain counts, which is the number of valid rows
+func countValid(domainCounts map[string]int) int {
+	valid := 0
+	for _, count := range domainCounts {
+		valid += count
+	}
+	return valid
+}
+
+// contextReader fails reads with ctx.Err() once ctx is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
 }
 
-// processChunks reads CSV records in chunks and processes them concurrently
-func processChunks(reader *csv.Reader, ch chan map[string]int, wg *sync.WaitGroup) {
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// processChunks reads CSV records in chunks and processes them concurrently,
+// tracing each chunk under parent and checkpointing between chunks through
+// cp. It returns the number of data rows read after the header, or after the
+// resumed checkpoint, including unreadable ones, and the error that stopped
+// reading when the input itself failed.
+func (r *Run) processChunks(reader *csv.Reader, ch chan map[string]int, wg *sync.WaitGroup, parent *Span, cp *checkpointer) (int, error) {
 	var chunk [][]string
-	rowNumber := 1
+	base, resumed := cp.Resumed()
+	header, rowNumber := base.Header, base.Row
+	rows := 0
+	var readErr error
+	dispatch := func() {
+		wg.Add(1)
+		if merges := cp.pendingMerges(); merges != nil {
+			merges.Add(1)
+		}
+		go r.processChunkTraced(chunk, ch, wg, parent)
+		chunk = nil
+	}
+
+	// Skip the header row; it is not a data row
+	var parseErr *csv.ParseError
+	if !resumed {
+		var err error
+		rowNumber = 1
+		if header, err = reader.Read(); errors.As(err, &parseErr) {
+			r.logSkip(reasonReadError, "line", rowNumber, "error", err)
+		} else if err != nil && err != io.EOF {
+			readErr = err
+		}
+	}
 
-	for {
+	for readErr == nil {
 		fields, err := reader.Read()
 		rowNumber++
 		if err == io.EOF {
 			break
 		}
+		rows++
+		r.rowRead()
+		if err != nil && !errors.As(err, &parseErr) {
+			// The input itself failed; no later row can be read
+			readErr = err
+			break
+		}
 		if err != nil {
-			log.Printf("Error reading row %d: %v", rowNumber, err)
+			r.logSkip(reasonReadError, "line", rowNumber, "error", err)
 			continue
 		}
 		chunk = append(chunk, fields)
 		if len(chunk) >= ChunkSize {
-			wg.Add(1)
-			go processChunk(chunk, ch, wg)
-			chunk = nil
+			dispatch()
+			if cp.Due() {
+				readErr = cp.SaveStreaming(header, base.Offset+reader.InputOffset(), rowNumber, base.Valid+base.Skipped+rows)
+			}
 		}
 	}
 
 	// Process any remaining records in the last chunk
 	if len(chunk) > 0 {
-		wg.Add(1)
-		go processChunk(chunk, ch, wg)
+		dispatch()
 	}
 
 	// Close the channel once all goroutines are done
@@ -64,63 +177,71 @@ func processChunks(reader *csv.Reader, ch chan map[string]int, wg *sync.WaitGrou
 		wg.Wait()
 		close(ch)
 	}()
+	return rows, readErr
 }
 
 // processChunk processes a single chunk of records and sends results to the channel
 func processChunk(chunk [][]string, ch chan map[string]int, wg *sync.WaitGroup) {
+	NewRun(RunConfig{}).processChunkTraced(chunk, ch, wg, nil)
+}
+
+// processChunkTraced is processChunk under the run's settings, recorded as a
+// "chunk" span under parent with the time spent extracting domains and
+// applying validation rules
+func (r *Run) processChunkTraced(chunk [][]string, ch chan map[string]int, wg *sync.WaitGroup, parent *Span) {
 	defer wg.Done()
+	done := metrics.chunkStarted()
+	span := parent.Child("chunk")
+	extract, validate := newStageTimer(span), newStageTimer(span)
 	localCounts := make(map[string]int)
 
 	for _, fields := range chunk {
 		// Validate row length
 		if len(fields) < 3 {
-			log.Printf("Skipping malformed row: %v", fields)
+			r.logSkip(reasonFieldCount, "fields", len(fields))
 			continue
 		}
 
 		// Extract and validate email domain
+		extract.Start()
 		domain := extractDomain(fields[2])
+		extract.Stop()
 		if domain == "" || !domainRegex.MatchString(domain) {
-			log.Printf("Skipping row due to invalid domain: %s", fields[2])
+			r.logSkip(reasonInvalidDomain, "email", fields[2])
 			continue
 		}
 
-		// Increment domain count
-		localCounts[domain]++
+		// Apply the configured validation rules, if any
+		validate.Start()
+		rule, ok := r.checkRecord(recordFromFields(fields))
+		validate.Stop()
+		if !ok {
+			r.logSkip(reasonRule+":"+rule, "email", fields[2])
+			continue
+		}
+
+		// Increment domain count, folding provider aliases into one domain
+		localCounts[r.providers.canonicalDomain(domain)]++
 	}
 
 	// Send local counts to the channel
+	span.SetAttr("rows", len(chunk))
+	span.SetAttr("valid", countValid(localCounts))
+	extract.Record(span, "extract_domain")
+	validate.Record(span, "validate")
+	span.End()
+	done()
 	ch <- localCounts
 }
 
-// collectResults aggregates results from multiple goroutines into a sync.Map
-func collectResults(ch chan map[string]int, domainCounts *sync.Map) {
+// collectResults merges results from the channel into the shared counter,
+// marking each merge done on merged when it is not nil. Several collectors may
+// drain the same channel concurrently.
+func collectResults(ch chan map[string]int, domainCounts *domainCounter, merged *sync.WaitGroup) {
 	for localCounts := range ch {
-		for domain, count := range localCounts {
-			// Atomically update the sync.Map
-			actual, _ := domainCounts.LoadOrStore(domain, count)
-			if actual != nil {
-				domainCounts.Store(domain, actual.(int)+count)
-			}
+		domainCounts.Merge(localCounts)
+		if merged != nil {
+			merged.Done()
 		}
 	}
 }
-
-// convertSyncMapToRegularMap converts sync.Map to a regular map
-func convertSyncMapToRegularMap(domainCounts *sync.Map) map[string]int {
-	finalCounts := make(map[string]int)
-	domainCounts.Range(func(key, value interface{}) bool {
-		finalCounts[key.(string)] = value.(int)
-		return true
-	})
-	return finalCounts
-}
-
-// extractDomain extracts the domain from an email address
-func extractDomain(email string) string {
-	at := strings.Index(email, "@")
-	if at == -1 {
-		return ""
-	}
-	return email[at+1:]
-}
@@ -1,8 +1,12 @@
 package customerimporter
 
 import (
+	"context"
+	"encoding/csv"
+	"errors"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -64,6 +68,16 @@ func TestProcessWithConcurrentStreaming_EmptyFile(t *testing.T) {
 	}
 }
 
+func TestProcessWithConcurrentStreamingContext_Cancelled(t *testing.T) {
+	file := writeStrictTestFile(t, "first_name,last_name,email,gender,ip_address\nJohn,Doe,john@example.com,Male,1.1.1.1\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := ProcessWithConcurrentStreamingContext(ctx, file); !errors.Is(err, context.Canceled) {
+		t.Errorf("ProcessWithConcurrentStreamingContext() = %v; want %v", err, context.Canceled)
+	}
+}
+
 func TestProcessChunk(t *testing.T) {
 	chunk := [][]string{
 		{"John", "Doe", "john.doe@example.com", "1234567890"},
@@ -90,47 +104,76 @@ func TestProcessChunk(t *testing.T) {
 	}
 }
 
+func TestProcessChunks_SkipsHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		rows     int
+		expected map[string]int
+		skipped  map[string]int
+	}{
+		{
+			"header and two rows",
+			"first_name,last_name,email,gender,ip_address\n" +
+				"John,Doe,john@example.com,Male,1.1.1.1\n" +
+				"Jane,Doe,jane@example.com,Female,2.2.2.2\n",
+			2, map[string]int{"example.com": 2}, map[string]int{},
+		},
+		{"header only", "first_name,last_name,email,gender,ip_address\n", 0, map[string]int{}, map[string]int{}},
+		{
+			"malformed header",
+			"first_\"name,last_name,email,gender,ip_address\n" +
+				"John,Doe,john@example.com,Male,1.1.1.1\n",
+			1, map[string]int{"example.com": 1}, map[string]int{reasonReadError: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			run := NewRun(RunConfig{})
+			reader := csv.NewReader(strings.NewReader(test.data))
+			reader.FieldsPerRecord = -1
+			ch := make(chan map[string]int, 4)
+			var wg sync.WaitGroup
+			rows, err := run.processChunks(reader, ch, &wg, nil, nil)
+			if err != nil {
+				t.Fatalf("processChunks() returned an error: %v", err)
+			}
+			domainCounts := newDomainCounter()
+			collectResults(ch, domainCounts, nil)
+
+			// The header is neither counted as a data row nor skipped as an invalid one
+			if rows != test.rows {
+				t.Errorf("processChunks() = %d rows; want %d", rows, test.rows)
+			}
+			if !reflect.DeepEqual(domainCounts.Snapshot(), test.expected) {
+				t.Errorf("processChunks() counts = %v; want %v", domainCounts.Snapshot(), test.expected)
+			}
+			if skipped := run.skips.snapshot(); !reflect.DeepEqual(skipped, test.skipped) {
+				t.Errorf("processChunks() skipped %v; want %v", skipped, test.skipped)
+			}
+		})
+	}
+}
+
 func TestCollectResults(t *testing.T) {
-	ch := make(chan map[string]int, 2)
-	var domainCounts sync.Map
+	ch := make(chan map[string]int, 3)
+	domainCounts := newDomainCounter()
 
-	// Simulate two chunks of results
+	// Simulate three chunks of results
 	ch <- map[string]int{"example.com": 2}
 	ch <- map[string]int{"another.com": 1}
+	ch <- map[string]int{"example.com": 3}
 	close(ch)
 
-	collectResults(ch, &domainCounts)
-
-	// Convert sync.Map to regular map for verification
-	finalCounts := make(map[string]int)
-	domainCounts.Range(func(key, value interface{}) bool {
-		finalCounts[key.(string)] = value.(int)
-		return true
-	})
-
-	// Verify the results
-	expected := map[string]int{
-		"example.com": 2,
-		"another.com": 1,
-	}
-	if !reflect.DeepEqual(finalCounts, expected) {
-		t.Errorf("collectResults() = %v; want %v", finalCounts, expected)
-	}
-}
-
-func TestConvertSyncMapToRegularMap(t *testing.T) {
-	var domainCounts sync.Map
-	domainCounts.Store("example.com", 2)
-	domainCounts.Store("another.com", 1)
-
-	result := convertSyncMapToRegularMap(&domainCounts)
+	collectResults(ch, domainCounts, nil)
 
 	// Verify the results
 	expected := map[string]int{
-		"example.com": 2,
+		"example.com": 5,
 		"another.com": 1,
 	}
-	if !reflect.DeepEqual(result, expected) {
-		t.Errorf("convertSyncMapToRegularMap() = %v; want %v", result, expected)
+	if !reflect.DeepEqual(domainCounts.Snapshot(), expected) {
+		t.Errorf("collectResults() = %v; want %v", domainCounts.Snapshot(), expected)
 	}
 }
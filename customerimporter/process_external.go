@@ -0,0 +1,507 @@
+package customerimporter
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Rough per-entry overhead of a map entry or slice element beyond the domain bytes
+const entryOverhead = 64
+
+// Most run files merged at once; more runs are merged in several passes so
+// the open files stay well under the process limit
+const maxMergeFanIn = 64
+
+// domainCount is one aggregated result, also the unit written to spill files
+type domainCount struct {
+	Domain string
+	Count  int
+}
+
+// byDomain orders counts alphabetically so runs can be merged and summed
+func byDomain(a, b domainCount) bool { return a.Domain < b.Domain }
+
+// byRank matches sortDomains: count descending, then alphabetically for ties
+func byRank(a, b domainCount) bool {
+	if a.Count == b.Count {
+		return a.Domain < b.Domain
+	}
+	return a.Count > b.Count
+}
+
+// ProcessWithMemoryLimit counts email domains while keeping memory use near
+// maxMemory bytes. Partial counts are spilled to sorted temp files and merged,
+// and the ranked output is written to output in the same format as writeOutput.
+// It returns the number of distinct domains.
+func ProcessWithMemoryLimit(input io.Reader, output io.Writer, maxMemory int64) (int, error) {
+	run := NewRun(RunConfig{})
+	defer run.LogSkipSummary()
+	return run.ProcessWithMemoryLimit(input, output, maxMemory)
+}
+
+// ProcessWithMemoryLimit is the package-level ProcessWithMemoryLimit under
+// the run's settings
+func (r *Run) ProcessWithMemoryLimit(input io.Reader, output io.Writer, maxMemory int64) (int, error) {
+	return r.processWithMemoryLimit(input, output, maxMemory, nil)
+}
+
+// processWithMemoryLimit is ProcessWithMemoryLimit, also passing each domain
+// count written to written when it is not nil
+func (r *Run) processWithMemoryLimit(input io.Reader, output io.Writer, maxMemory int64, written func(domainCount)) (int, error) {
+	span := r.config.Tracer.startSpan("customerimporter.ProcessWithMemoryLimit")
+	defer span.End()
+
+	// Half of the budget aggregates counts, the other half ranks the merged result
+	aggregator := newSpillAggregator(maxMemory / 2)
+	defer aggregator.Close()
+
+	read := span.Child("read_csv")
+	processed, skipped, err := r.streamCSVDomains(input, func(_ int, domain string, _ Record) {
+		aggregator.Add(domain)
+	})
+	if err == nil {
+		err = aggregator.spillErr
+	}
+	read.SetAttr("rows", processed)
+	read.SetAttr("skipped", skipped)
+	read.SetError(err)
+	read.End()
+	if err == nil {
+		err = r.checkStreamingCounts(processed, skipped)
+	}
+	if err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	merge := span.Child("aggregate")
+	ranker := newRunSorter(maxMemory/2, byRank)
+	defer ranker.Close()
+	distinct := 0
+	err = aggregator.Merge(func(dc domainCount) error {
+		distinct++
+		return ranker.Add(dc)
+	})
+	merge.SetAttr("domains", distinct)
+	merge.SetError(err)
+	merge.End()
+	if err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	write := span.Child("write_output")
+	defer write.End()
+	writer := bufio.NewWriter(output)
+	err = ranker.Merge(func(dc domainCount) error {
+		if written != nil {
+			written(dc)
+		}
+		_, err := fmt.Fprintf(writer, "%s: %d\n", dc.Domain, dc.Count)
+		return err
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		write.SetError(err)
+		span.SetError(err)
+		return 0, fmt.Errorf("error writing output: %w", err)
+	}
+
+	logger.Info("summary", "processed", processed, "skipped", skipped, "spill_files", aggregator.spills+ranker.spills)
+	return distinct, nil
+}
+
+// streamCSVDomains reads rows one at a time with the same validation as
+// parseCSVRecords and passes each valid row number, domain and record to add,
+// never holding the rows
+func (r *Run) streamCSVDomains(input io.Reader, add func(rowNumber int, domain string, record Record)) (int, int, error) {
+	progress := r.startProgress(inputSize(input))
+	defer progress.Stop()
+	reader := csv.NewReader(progress.Reader(input))
+	name := fileName(input)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return 0, 0, ErrEmptyFile
+	} else if err != nil {
+		return 0, 0, fmt.Errorf("error reading header row: %w", err)
+	}
+
+	var processed, skipped int
+	rowNumber := 1
+	for {
+		fields, err := reader.Read()
+		rowNumber++
+		if err == io.EOF {
+			break
+		}
+		r.rowRead()
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			// The input itself failed, e.g. a dropped connection; no later row can be read
+			return processed, skipped, fmt.Errorf("error reading line %d: %w", rowNumber, err)
+		}
+		if err != nil {
+			if err := r.strictReadError(name, rowNumber, err); err != nil {
+				return processed, skipped, err
+			}
+			r.logSkip(reasonReadError, "line", rowNumber, "error", err)
+			skipped++
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		if len(fields) < FieldCount {
+			reason := fmt.Sprintf("expected %d fields, got %d", FieldCount, len(fields))
+			if err := r.strictRowError(name, line, header, -1, "", reason); err != nil {
+				return processed, skipped, err
+			}
+			r.logSkip(reasonFieldCount, "line", line, "fields", len(fields))
+			skipped++
+			continue
+		}
+		if !emailRegex.MatchString(fields[2]) {
+			if err := r.strictRowError(name, line, header, 2, fields[2], "invalid email"); err != nil {
+				return processed, skipped, err
+			}
+			r.logSkip(reasonInvalidEmail, "line", line, "email", fields[2])
+			skipped++
+			continue
+		}
+		record, err := createRecord(fields)
+		if err != nil {
+			r.logSkip(reasonRecordError, "line", line, "error", err)
+			skipped++
+			continue
+		}
+		if rule, ok := r.checkRecord(record); !ok {
+			if err := r.strictRuleError(name, line, rule, record); err != nil {
+				return processed, skipped, err
+			}
+			r.logSkip(reasonRule+":"+rule, "line", line)
+			skipped++
+			continue
+		}
+		domain := extractDomain(record.Email)
+		if domain == "" {
+			if err := r.strictRowError(name, line, header, 2, record.Email, "invalid email domain"); err != nil {
+				return processed, skipped, err
+			}
+			r.logSkip(reasonInvalidDomain, "line", line, "email", record.Email)
+			skipped++
+			continue
+		}
+		add(rowNumber, r.providers.canonicalDomain(domain), record)
+		processed++
+	}
+	return processed, skipped, nil
+}
+
+// spillAggregator counts domains in a map until the budget is exceeded, then
+// writes the partial counts as a domain-sorted run file and starts afresh
+type spillAggregator struct {
+	budget   int64
+	used     int64
+	counts   map[string]int
+	runs     []string
+	spills   int
+	spillErr error
+}
+
+func newSpillAggregator(budget int64) *spillAggregator {
+	return &spillAggregator{budget: budget, counts: make(map[string]int)}
+}
+
+// Add counts one occurrence of domain
+func (a *spillAggregator) Add(domain string) {
+	if a.spillErr != nil {
+		return
+	}
+	if _, ok := a.counts[domain]; !ok {
+		a.used += int64(len(domain)) + entryOverhead
+	}
+	a.counts[domain]++
+	if a.used > a.budget {
+		a.spillErr = a.spill()
+	}
+}
+
+func (a *spillAggregator) spill() error {
+	items := make([]domainCount, 0, len(a.counts))
+	for domain, count := range a.counts {
+		items = append(items, domainCount{domain, count})
+	}
+	sort.Slice(items, func(i, j int) bool { return byDomain(items[i], items[j]) })
+	path, err := writeRun(items)
+	if err != nil {
+		return err
+	}
+	a.runs = append(a.runs, path)
+	a.spills++
+	a.counts = make(map[string]int)
+	a.used = 0
+	return nil
+}
+
+// Merge emits every domain once, in alphabetical order, with its total count
+func (a *spillAggregator) Merge(emit func(domainCount) error) error {
+	if len(a.counts) > 0 {
+		if err := a.spill(); err != nil {
+			return err
+		}
+	}
+	var current domainCount
+	started := false
+	err := mergeRuns(a.runs, byDomain, func(dc domainCount) error {
+		if started && dc.Domain == current.Domain {
+			current.Count += dc.Count
+			return nil
+		}
+		if started {
+			if err := emit(current); err != nil {
+				return err
+			}
+		}
+		current, started = dc, true
+		return nil
+	})
+	if err != nil || !started {
+		return err
+	}
+	return emit(current)
+}
+
+// Close removes the run files
+func (a *spillAggregator) Close() {
+	removeRuns(a.runs)
+}
+
+// runSorter is an external merge sort over domainCount values
+type runSorter struct {
+	budget int64
+	used   int64
+	less   func(a, b domainCount) bool
+	items  []domainCount
+	runs   []string
+	spills int
+}
+
+func newRunSorter(budget int64, less func(a, b domainCount) bool) *runSorter {
+	return &runSorter{budget: budget, less: less}
+}
+
+// Add buffers one value, spilling a sorted run when the budget is exceeded
+func (s *runSorter) Add(dc domainCount) error {
+	s.items = append(s.items, dc)
+	s.used += int64(len(dc.Domain)) + entryOverhead
+	if s.used > s.budget {
+		return s.spill()
+	}
+	return nil
+}
+
+func (s *runSorter) spill() error {
+	sort.Slice(s.items, func(i, j int) bool { return s.less(s.items[i], s.items[j]) })
+	path, err := writeRun(s.items)
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, path)
+	s.spills++
+	s.items = s.items[:0]
+	s.used = 0
+	return nil
+}
+
+// Merge emits every value in sorted order
+func (s *runSorter) Merge(emit func(domainCount) error) error {
+	if len(s.items) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	return mergeRuns(s.runs, s.less, emit)
+}
+
+// Close removes the run files
+func (s *runSorter) Close() {
+	removeRuns(s.runs)
+}
+
+// writeRun writes sorted values to a temp file as "domain\tcount" lines
+func writeRun(items []domainCount) (string, error) {
+	run, err := createRun()
+	if err != nil {
+		return "", err
+	}
+	for _, dc := range items {
+		run.Write(dc)
+	}
+	return run.Close()
+}
+
+// runWriter writes one run file value by value
+type runWriter struct {
+	file   *os.File
+	writer *bufio.Writer
+}
+
+func createRun() (*runWriter, error) {
+	file, err := os.CreateTemp("", "customerimporter-run-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating spill file: %w", err)
+	}
+	return &runWriter{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// Write appends one value; errors are reported by Close
+func (w *runWriter) Write(dc domainCount) error {
+	w.writer.WriteString(dc.Domain)
+	w.writer.WriteByte('\t')
+	w.writer.WriteString(strconv.Itoa(dc.Count))
+	return w.writer.WriteByte('\n')
+}
+
+// Close finishes the run and returns its path, removing it on failure
+func (w *runWriter) Close() (string, error) {
+	err := w.writer.Flush()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(w.file.Name())
+		return "", fmt.Errorf("error writing spill file: %w", err)
+	}
+	return w.file.Name(), nil
+}
+
+func removeRuns(runs []string) {
+	for _, path := range runs {
+		os.Remove(path)
+	}
+}
+
+// runReader yields the values of one run file in order
+type runReader struct {
+	scanner *bufio.Scanner
+	head    domainCount
+}
+
+func (r *runReader) next() (bool, error) {
+	if !r.scanner.Scan() {
+		return false, r.scanner.Err()
+	}
+	line := r.scanner.Text()
+	tab := strings.LastIndexByte(line, '\t')
+	if tab == -1 {
+		return false, fmt.Errorf("corrupt spill file line: %q", line)
+	}
+	count, err := strconv.Atoi(line[tab+1:])
+	if err != nil {
+		return false, fmt.Errorf("corrupt spill file line: %q", line)
+	}
+	r.head = domainCount{line[:tab], count}
+	return true, nil
+}
+
+// runHeap orders run readers by their current head value
+type runHeap struct {
+	readers []*runReader
+	less    func(a, b domainCount) bool
+}
+
+func (h *runHeap) Len() int           { return len(h.readers) }
+func (h *runHeap) Less(i, j int) bool { return h.less(h.readers[i].head, h.readers[j].head) }
+func (h *runHeap) Swap(i, j int)      { h.readers[i], h.readers[j] = h.readers[j], h.readers[i] }
+func (h *runHeap) Push(x interface{}) { h.readers = append(h.readers, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	last := h.readers[len(h.readers)-1]
+	h.readers = h.readers[:len(h.readers)-1]
+	return last
+}
+
+// mergeRuns performs a k-way merge of sorted run files. Beyond maxMergeFanIn
+// runs, groups of runs are first merged into intermediate runs, which are
+// removed once merged in turn.
+func mergeRuns(runs []string, less func(a, b domainCount) bool, emit func(domainCount) error) error {
+	var intermediate []string
+	defer func() { removeRuns(intermediate) }()
+	for len(runs) > maxMergeFanIn {
+		var merged []string
+		for start := 0; start < len(runs); start += maxMergeFanIn {
+			group := runs[start:min(start+maxMergeFanIn, len(runs))]
+			if len(group) == 1 {
+				merged = append(merged, group[0])
+				continue
+			}
+			path, err := mergeToRun(group, less)
+			if err != nil {
+				return err
+			}
+			intermediate = append(intermediate, path)
+			merged = append(merged, path)
+		}
+		runs = merged
+	}
+	return mergeOpenRuns(runs, less, emit)
+}
+
+// mergeToRun merges runs into a new run file and returns its path
+func mergeToRun(runs []string, less func(a, b domainCount) bool) (string, error) {
+	run, err := createRun()
+	if err != nil {
+		return "", err
+	}
+	if err := mergeOpenRuns(runs, less, run.Write); err != nil {
+		path, _ := run.Close()
+		os.Remove(path)
+		return "", err
+	}
+	return run.Close()
+}
+
+// mergeOpenRuns merges runs with every run file open at once
+func mergeOpenRuns(runs []string, less func(a, b domainCount) bool, emit func(domainCount) error) error {
+	h := &runHeap{less: less}
+	for _, path := range runs {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("error opening spill file: %w", err)
+		}
+		defer file.Close()
+		reader := &runReader{scanner: bufio.NewScanner(file)}
+		ok, err := reader.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.readers = append(h.readers, reader)
+		}
+	}
+	heap.Init(h)
+
+	for h.Len() > 0 {
+		reader := h.readers[0]
+		if err := emit(reader.head); err != nil {
+			return err
+		}
+		ok, err := reader.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
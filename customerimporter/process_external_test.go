@@ -0,0 +1,149 @@
+package customerimporter
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func expectedRankedOutput(t *testing.T, inputFile string) string {
+	t.Helper()
+	file, err := os.Open(inputFile)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", inputFile, err)
+	}
+	defer file.Close()
+
+	records, _, err := parseCSVRecords(file)
+	if err != nil {
+		t.Fatalf("parseCSVRecords() returned an error: %v", err)
+	}
+	return strings.Join(sortDomains(countEmailDomains(records)), "\n") + "\n"
+}
+
+func TestProcessWithMemoryLimit(t *testing.T) {
+	expected := expectedRankedOutput(t, "input_test.csv")
+	distinct := strings.Count(expected, "\n")
+
+	// A tiny budget forces many spill files; a large one keeps everything in memory
+	for _, budget := range []int64{512, 4 << 10, 64 << 20} {
+		file, err := os.Open("input_test.csv")
+		if err != nil {
+			t.Fatalf("Failed to open input_test.csv: %v", err)
+		}
+
+		var output bytes.Buffer
+		result, err := ProcessWithMemoryLimit(file, &output, budget)
+		file.Close()
+		if err != nil {
+			t.Errorf("ProcessWithMemoryLimit(budget=%d) returned an error: %v", budget, err)
+			continue
+		}
+		if result != distinct {
+			t.Errorf("ProcessWithMemoryLimit(budget=%d) = %d distinct domains; want %d", budget, result, distinct)
+		}
+		if output.String() != expected {
+			t.Errorf("ProcessWithMemoryLimit(budget=%d) output does not match sortDomains output", budget)
+		}
+	}
+}
+
+func TestProcessWithMemoryLimit_Written(t *testing.T) {
+	input := "first_name,last_name,email,gender,ip_address\n" +
+		"A,B,a@example.com,x,1.1.1.1\n" +
+		"C,D,c@another.com,x,1.1.1.1\n" +
+		"E,F,e@example.com,x,1.1.1.1\n"
+	written := map[string]int{}
+	var output bytes.Buffer
+	_, err := NewRun(RunConfig{}).processWithMemoryLimit(strings.NewReader(input), &output, 1<<20, func(dc domainCount) {
+		written[dc.Domain] = dc.Count
+	})
+	if err != nil {
+		t.Fatalf("processWithMemoryLimit() returned an error: %v", err)
+	}
+	expected := map[string]int{"example.com": 2, "another.com": 1}
+	if !reflect.DeepEqual(written, expected) {
+		t.Errorf("processWithMemoryLimit() wrote %v; want %v", written, expected)
+	}
+}
+
+func TestProcessWithMemoryLimit_EmptyFile(t *testing.T) {
+	var output bytes.Buffer
+	if _, err := ProcessWithMemoryLimit(strings.NewReader(""), &output, 1<<20); err == nil {
+		t.Errorf("ProcessWithMemoryLimit() did not return an error for empty input")
+	}
+}
+
+func TestSpillAggregator_Merge(t *testing.T) {
+	aggregator := newSpillAggregator(entryOverhead * 2)
+	defer aggregator.Close()
+	for _, domain := range []string{"b.com", "a.com", "c.com", "a.com", "b.com", "d.com", "a.com"} {
+		aggregator.Add(domain)
+	}
+	if aggregator.spills == 0 {
+		t.Fatalf("spillAggregator did not spill with a tiny budget")
+	}
+
+	var merged []domainCount
+	err := aggregator.Merge(func(dc domainCount) error {
+		merged = append(merged, dc)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("spillAggregator.Merge() returned an error: %v", err)
+	}
+
+	expected := []domainCount{{"a.com", 3}, {"b.com", 2}, {"c.com", 1}, {"d.com", 1}}
+	if len(merged) != len(expected) {
+		t.Fatalf("spillAggregator.Merge() = %v; want %v", merged, expected)
+	}
+	for i := range expected {
+		if merged[i] != expected[i] {
+			t.Errorf("spillAggregator.Merge() = %v; want %v", merged, expected)
+			break
+		}
+	}
+}
+
+func TestMergeRuns_ManyRuns(t *testing.T) {
+	// More runs than are merged at once, each holding one domain twice
+	runs := make([]string, 2*maxMergeFanIn+3)
+	for i := range runs {
+		domain := fmt.Sprintf("domain%03d.com", i)
+		path, err := writeRun([]domainCount{{domain, 1}, {domain, 2}})
+		if err != nil {
+			t.Fatalf("writeRun() returned an error: %v", err)
+		}
+		runs[i] = path
+	}
+	defer removeRuns(runs)
+
+	spillFiles := func() int {
+		matches, _ := filepath.Glob(filepath.Join(os.TempDir(), "customerimporter-run-*"))
+		return len(matches)
+	}
+	before := spillFiles()
+
+	var merged []domainCount
+	err := mergeRuns(runs, byDomain, func(dc domainCount) error {
+		merged = append(merged, dc)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("mergeRuns() returned an error: %v", err)
+	}
+	if len(merged) != 2*len(runs) {
+		t.Fatalf("mergeRuns() emitted %d values; want %d", len(merged), 2*len(runs))
+	}
+	if !sort.SliceIsSorted(merged, func(i, j int) bool { return byDomain(merged[i], merged[j]) }) {
+		t.Errorf("mergeRuns() emitted values out of order")
+	}
+	if after := spillFiles(); after != before {
+		t.Errorf("mergeRuns() left %d spill files behind", after-before)
+	}
+}
@@ -0,0 +1,262 @@
+package customerimporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// Ranges smaller than this are not worth a goroutine of their own
+const minRangeSize = 1 << 20
+
+// byteRange is a section of the input file that starts on a record boundary
+type byteRange struct {
+	start int64
+	end   int64
+}
+
+// rangeScan holds what a pre-scan learns about a raw byte range: the parity of
+// its quote characters and, for each possible quote state at the start of the
+// range, the offset just past the first newline that lies outside quotes.
+type rangeScan struct {
+	parity   int
+	boundary [2]int64 // -1 when no record boundary falls inside the range
+}
+
+// ProcessWithParallelRanges parses a seekable CSV file by splitting it into
+// byte ranges, resynchronising each range at a record boundary and parsing the
+// ranges in parallel. Results match ProcessWithConcurrentStreaming.
+func ProcessWithParallelRanges(file *os.File, workers int) (map[string]int, error) {
+	run := NewRun(RunConfig{})
+	defer run.LogSkipSummary()
+	return run.ProcessWithParallelRanges(file, workers)
+}
+
+// ProcessWithParallelRanges is the package-level ProcessWithParallelRanges
+// under the run's settings
+func (r *Run) ProcessWithParallelRanges(file *os.File, workers int) (map[string]int, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading file size: %w", err)
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if n := int(info.Size()/minRangeSize) + 1; workers > n {
+		workers = n
+	}
+	return r.processRanges(file, info.Size(), workers)
+}
+
+func (r *Run) processRanges(file io.ReaderAt, size int64, workers int) (map[string]int, error) {
+	span := r.config.Tracer.startSpan("customerimporter.ProcessWithParallelRanges")
+	defer span.End()
+
+	// Read the header serially so every range parses with the same field count
+	header := csv.NewReader(io.NewSectionReader(file, 0, size))
+	fields, err := header.Read()
+	if err == io.EOF {
+		span.SetError(ErrEmptyFile)
+		return nil, ErrEmptyFile
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading header row: %w", err)
+	}
+	fieldCount := len(fields)
+	headerEnd := header.InputOffset()
+	if headerEnd >= size {
+		span.SetError(ErrEmptyFile)
+		return nil, ErrEmptyFile
+	}
+
+	split := span.Child("split_ranges")
+	ranges, err := splitRanges(file, headerEnd, size, workers)
+	split.SetAttr("ranges", len(ranges))
+	split.SetError(err)
+	split.End()
+	if err != nil {
+		return nil, err
+	}
+
+	progress := r.startProgress(size)
+	defer progress.Stop()
+	progress.Header(headerEnd)
+
+	ch := make(chan map[string]int)
+	var wg sync.WaitGroup
+	domainCounts := newDomainCounter()
+	done := make(chan struct{})
+	go func() {
+		collectResults(ch, domainCounts, nil)
+		close(done)
+	}()
+
+	var rangeWG sync.WaitGroup
+	errs := make([]error, len(ranges))
+	rows := make([]int, len(ranges))
+	for i, br := range ranges {
+		rangeWG.Add(1)
+		go func(i int, br byteRange) {
+			defer rangeWG.Done()
+			rangeSpan := span.Child("parse_range")
+			rangeSpan.SetAttr("start", br.start)
+			rangeSpan.SetAttr("end", br.end)
+			rows[i], errs[i] = r.parseRange(file, br, fieldCount, progress, ch, &wg, rangeSpan)
+			rangeSpan.SetAttr("rows", rows[i])
+			rangeSpan.SetError(errs[i])
+			rangeSpan.End()
+		}(i, br)
+	}
+	rangeWG.Wait()
+	wg.Wait()
+	close(ch)
+	<-done
+
+	total := 0
+	for i, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+		total += rows[i]
+	}
+	result := domainCounts.Snapshot()
+	valid := countValid(result)
+	if err := r.checkStreamingCounts(valid, total-valid); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// parseRange reads the records of range br and hands them to processChunk,
+// counting the range's bytes on progress and tracing each chunk under span.
+// It returns the number of rows read, including unreadable ones.
+func (r *Run) parseRange(file io.ReaderAt, br byteRange, fieldCount int, progress *progressTracker, ch chan map[string]int, wg *sync.WaitGroup, span *Span) (int, error) {
+	// Ranges do not overlap, so every byte is counted once
+	reader := csv.NewReader(progress.Reader(io.NewSectionReader(file, br.start, br.end-br.start)))
+	reader.FieldsPerRecord = fieldCount
+	var chunk [][]string
+	rows := 0
+
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		rows++
+		r.rowRead()
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return rows, fmt.Errorf("error reading range at offset %d: %w", br.start, err)
+			}
+			r.logSkip(reasonReadError, "range_offset", br.start, "error", err)
+			continue
+		}
+		chunk = append(chunk, fields)
+		if len(chunk) >= ChunkSize {
+			wg.Add(1)
+			r.processChunkTraced(chunk, ch, wg, span)
+			chunk = nil
+		}
+	}
+
+	if len(chunk) > 0 {
+		wg.Add(1)
+		r.processChunkTraced(chunk, ch, wg, span)
+	}
+	return rows, nil
+}
+
+// splitRanges divides [start, size) into up to n ranges whose boundaries fall
+// on record starts, so quoted fields containing newlines are never split
+func splitRanges(file io.ReaderAt, start, size int64, n int) ([]byteRange, error) {
+	if n < 1 {
+		n = 1
+	}
+	step := (size - start) / int64(n)
+	if step == 0 {
+		return []byteRange{{start, size}}, nil
+	}
+
+	// Pre-scan every raw range in parallel
+	scans := make([]rangeScan, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		rawStart := start + int64(i)*step
+		rawEnd := rawStart + step
+		if i == n-1 {
+			rawEnd = size
+		}
+		wg.Add(1)
+		go func(i int, rawStart, rawEnd int64) {
+			defer wg.Done()
+			scans[i], errs[i] = scanRange(file, rawStart, rawEnd)
+		}(i, rawStart, rawEnd)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Walk the ranges serially: the quote state at the start of the first range
+	// is known, and each range's parity gives the state at the start of the next
+	ranges := []byteRange{{start: start}}
+	state := 0
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			if boundary := scans[i].boundary[state]; boundary >= 0 {
+				ranges[len(ranges)-1].end = boundary
+				ranges = append(ranges, byteRange{start: boundary})
+			}
+		}
+		state ^= scans[i].parity
+	}
+	ranges[len(ranges)-1].end = size
+	return ranges, nil
+}
+
+// scanRange computes the quote parity and candidate record boundaries of a range
+func scanRange(file io.ReaderAt, start, end int64) (rangeScan, error) {
+	scan := rangeScan{boundary: [2]int64{-1, -1}}
+	buf := make([]byte, 1<<20)
+	offset := start
+	for offset < end {
+		n := int64(len(buf))
+		if end-offset < n {
+			n = end - offset
+		}
+		read, err := file.ReadAt(buf[:n], offset)
+		if err != nil && !(err == io.EOF && int64(read) == n) {
+			return scan, fmt.Errorf("error scanning range at offset %d: %w", offset, err)
+		}
+		data := buf[:read]
+
+		if scan.boundary[0] < 0 || scan.boundary[1] < 0 {
+			parity := scan.parity
+			for i, b := range data {
+				switch b {
+				case '"':
+					parity ^= 1
+				case '\n':
+					// Outside quotes if the starting state cancels the parity so far
+					state := parity
+					if scan.boundary[state] < 0 {
+						scan.boundary[state] = offset + int64(i) + 1
+					}
+				}
+			}
+			scan.parity = parity
+		} else {
+			scan.parity ^= bytes.Count(data, []byte{'"'}) & 1
+		}
+		offset += int64(read)
+	}
+	return scan, nil
+}
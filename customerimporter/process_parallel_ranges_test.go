@@ -0,0 +1,151 @@
+package customerimporter
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// serialDomainCounts is the reference result: one csv.Reader over the whole
+// file feeding every row through processChunk
+func serialDomainCounts(t *testing.T, data string) map[string]int {
+	t.Helper()
+	reader := csv.NewReader(strings.NewReader(data))
+	var rows [][]string
+	reader.Read() // Skip the header row
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		rows = append(rows, fields)
+	}
+
+	ch := make(chan map[string]int, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	processChunk(rows, ch, &wg)
+	return <-ch
+}
+
+// quotedTestData builds a CSV whose quoted fields contain newlines, commas,
+// escaped quotes and lines that look like records, with CRLF line endings
+func quotedTestData(rows int) string {
+	var b strings.Builder
+	b.WriteString("first_name,last_name,email,gender,ip_address\r\n")
+	domains := []string{"example.com", "another.com", "test.org", "sample.net"}
+	for i := 0; i < rows; i++ {
+		domain := domains[i%len(domains)]
+		switch i % 5 {
+		case 0:
+			fmt.Fprintf(&b, "\"Multi\nLine\",Doe,user%d@%s,Male,1.2.3.4\r\n", i, domain)
+		case 1:
+			fmt.Fprintf(&b, "\"Fake\nrow,x,fake%d@fake.com,Male,1.2.3.4\n\",\"Smith, Jr\",user%d@%s,Female,5.6.7.8\r\n", i, i, domain)
+		case 2:
+			fmt.Fprintf(&b, "\"He said \"\"hi\"\"\",Quote,user%d@%s,Male,9.9.9.9\r\n", i, domain)
+		case 3:
+			fmt.Fprintf(&b, "Bad,Row,not-an-email,Male,1.1.1.1\r\n")
+		default:
+			fmt.Fprintf(&b, "Plain,Row,user%d@%s,Female,2.2.2.2\r\n", i, domain)
+		}
+	}
+	return b.String()
+}
+
+func TestProcessRanges_MatchesSerial(t *testing.T) {
+	inputTest, err := os.ReadFile("input_test.csv")
+	if err != nil {
+		t.Fatalf("Failed to read input_test.csv: %v", err)
+	}
+
+	inputs := map[string]string{
+		"input_test.csv": string(inputTest),
+		"quoted":         quotedTestData(2000),
+	}
+
+	for name, data := range inputs {
+		expected := serialDomainCounts(t, data)
+		// Many small ranges force boundaries into the middle of quoted fields
+		for _, workers := range []int{1, 2, 3, 7, 16, 64, 257} {
+			result, err := NewRun(RunConfig{}).processRanges(strings.NewReader(data), int64(len(data)), workers)
+			if err != nil {
+				t.Errorf("%s: processRanges(workers=%d) returned an error: %v", name, workers, err)
+				continue
+			}
+			if !reflect.DeepEqual(result, expected) {
+				t.Errorf("%s: processRanges(workers=%d) = %v; want %v", name, workers, result, expected)
+			}
+		}
+	}
+}
+
+func TestProcessWithParallelRanges(t *testing.T) {
+	file, err := os.Open("input_test.csv")
+	if err != nil {
+		t.Fatalf("Failed to open input_test.csv: %v", err)
+	}
+	defer file.Close()
+
+	data, _ := os.ReadFile("input_test.csv")
+	expected := serialDomainCounts(t, string(data))
+
+	result, err := ProcessWithParallelRanges(file, 4)
+	if err != nil {
+		t.Errorf("ProcessWithParallelRanges() returned an error: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("ProcessWithParallelRanges() = %v; want %v", result, expected)
+	}
+}
+
+func TestProcessWithParallelRanges_EmptyFile(t *testing.T) {
+	file, err := os.CreateTemp("", "empty_test.csv")
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	result, err := ProcessWithParallelRanges(file, 4)
+	if !errors.Is(err, ErrEmptyFile) || result != nil {
+		t.Errorf("ProcessWithParallelRanges() of an empty file = %v, %v; want %v", result, err, ErrEmptyFile)
+	}
+
+	// A header without rows is empty too
+	file.WriteString("first_name,last_name,email,gender,ip_address\n")
+	result, err = ProcessWithParallelRanges(file, 4)
+	if !errors.Is(err, ErrEmptyFile) || result != nil {
+		t.Errorf("ProcessWithParallelRanges() of a header-only file = %v, %v; want %v", result, err, ErrEmptyFile)
+	}
+}
+
+func TestSplitRanges(t *testing.T) {
+	data := "h\n\"a\nb\",c\nd,e\n\"f\ng\nh\",i\n"
+
+	for n := 1; n <= len(data); n++ {
+		ranges, err := splitRanges(strings.NewReader(data), 2, int64(len(data)), n)
+		if err != nil {
+			t.Fatalf("splitRanges(n=%d) returned an error: %v", n, err)
+		}
+		// Ranges must be contiguous and start only at real record starts
+		valid := map[int64]bool{2: true, 10: true, 14: true, int64(len(data)): true}
+		prev := int64(2)
+		for _, r := range ranges {
+			if r.start != prev || !valid[r.start] {
+				t.Errorf("splitRanges(n=%d) = %v; range starts at %d", n, ranges, r.start)
+			}
+			prev = r.end
+		}
+		if prev != int64(len(data)) {
+			t.Errorf("splitRanges(n=%d) = %v; does not cover the input", n, ranges)
+		}
+	}
+}
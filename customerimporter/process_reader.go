@@ -0,0 +1,49 @@
+package customerimporter
+
+import (
+	"fmt"
+	"io"
+)
+
+// ImportResult holds the domain counts of one import and how many rows were
+// counted and skipped
+type ImportResult struct {
+	DomainCounts map[string]int
+	Rows         int // Valid rows counted
+	Skipped      int // Rows skipped as invalid
+}
+
+// ProcessReader streams CSV rows from input into per-domain counts without
+// holding the rows, so input can be a network stream such as a request body.
+// An input without a single valid row fails with ErrNoRecords; otherwise only
+// the streaming record-count policy applies, as for the concurrent mode.
+func ProcessReader(input io.Reader) (ImportResult, error) {
+	run := NewRun(RunConfig{})
+	defer run.LogSkipSummary()
+	return run.ProcessReader(input)
+}
+
+// ProcessReader is the package-level ProcessReader under the run's settings
+func (r *Run) ProcessReader(input io.Reader) (ImportResult, error) {
+	span := r.config.Tracer.startSpan("customerimporter.ProcessReader")
+	defer span.End()
+
+	result := ImportResult{DomainCounts: make(map[string]int)}
+	processed, skipped, err := r.streamCSVDomains(input, func(rowNumber int, domain string, record Record) {
+		result.DomainCounts[domain]++
+	})
+	span.SetAttr("rows", processed)
+	span.SetAttr("skipped", skipped)
+	if err != nil {
+		span.SetError(err)
+		return ImportResult{}, fmt.Errorf("error processing CSV: %w", err)
+	}
+	if err := r.checkReaderCounts(processed, skipped); err != nil {
+		span.SetError(err)
+		return ImportResult{}, err
+	}
+	result.Rows, result.Skipped = processed, skipped
+
+	logger.Info("summary", "processed", processed, "skipped", skipped)
+	return result, nil
+}
@@ -0,0 +1,53 @@
+package customerimporter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestProcessReader(t *testing.T) {
+	input := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n" +
+		"Jane,Doe,jane@example.com,Female,2.2.2.2\n" +
+		"Bob,Roe,bob@test.org,Male,3.3.3.3\n" +
+		"Bad,Row,not-an-email,Male,4.4.4.4\n"
+
+	result, err := ProcessReader(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ProcessReader() returned an error: %v", err)
+	}
+	if result.Rows != 3 || result.Skipped != 1 {
+		t.Errorf("ProcessReader() rows, skipped = %d, %d; want 3, 1", result.Rows, result.Skipped)
+	}
+	expected := map[string]int{"example.com": 2, "test.org": 1}
+	for domain, count := range expected {
+		if result.DomainCounts[domain] != count {
+			t.Errorf("ProcessReader() count for %s = %d; want %d", domain, result.DomainCounts[domain], count)
+		}
+	}
+	if len(result.DomainCounts) != len(expected) {
+		t.Errorf("ProcessReader() = %v; want %v", result.DomainCounts, expected)
+	}
+}
+
+func TestProcessReader_NoValidRows(t *testing.T) {
+	input := "first_name,last_name,email,gender,ip_address\nBad,Row,not-an-email,Male,4.4.4.4\n"
+	if _, err := ProcessReader(strings.NewReader(input)); !errors.Is(err, ErrNoRecords) {
+		t.Errorf("ProcessReader() = %v; want %v", err, ErrNoRecords)
+	}
+}
+
+func TestProcessReader_ReadFailure(t *testing.T) {
+	failure := errors.New("connection reset")
+	input := iotest.TimeoutReader(strings.NewReader("first_name,last_name,email,gender,ip_address\nJohn,Doe,john@example.com,Male,1.1.1.1\n"))
+	if _, err := ProcessReader(input); err == nil {
+		t.Errorf("ProcessReader() did not return an error for a failing reader")
+	}
+
+	input = iotest.ErrReader(failure)
+	if _, err := ProcessReader(input); !errors.Is(err, failure) {
+		t.Errorf("ProcessReader() = %v; want %v", err, failure)
+	}
+}
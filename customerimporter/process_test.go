@@ -1,8 +1,10 @@
 package customerimporter
 
 import (
+	"errors"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -13,20 +15,24 @@ func TestProcess(t *testing.T) {
 	defer os.Remove(outputFile) // Clean up the output file after the test
 
 	// Run the Process function
-	_, err := Process(inputFile, outputFile)
+	counts, err := Process(inputFile, outputFile)
 	if err != nil {
-		t.Errorf("Process() returned an error: %v", err)
+		t.Fatalf("Process() returned an error: %v", err)
 	}
 
-	// Verify the output file contents
+	// Verify the output file contents: one line per domain, most frequent first
 	outputData, err := os.ReadFile(outputFile)
 	if err != nil {
 		t.Fatalf("Failed to read output file: %v", err)
 	}
 
-	expectedOutput := "example.com\nanother.com\n"
-	if string(outputData) != expectedOutput {
-		t.Errorf("Output file does not match expected output. Got = %q; want %q", string(outputData), expectedOutput)
+	lines := strings.Split(strings.TrimSuffix(string(outputData), "\n"), "\n")
+	if len(lines) != len(counts) {
+		t.Errorf("Output file has %d lines; want one per domain (%d)", len(lines), len(counts))
+	}
+	expectedTop := []string{"loc.gov: 14", "domainmarket.com: 13", "reddit.com: 13"}
+	if len(lines) < len(expectedTop) || !reflect.DeepEqual(lines[:len(expectedTop)], expectedTop) {
+		t.Errorf("Output file starts with %q; want %q", lines[:min(len(lines), len(expectedTop))], expectedTop)
 	}
 }
 
@@ -35,7 +41,7 @@ func TestReadCSV(t *testing.T) {
 	inputFile := "input_test.csv"
 
 	// Run the readCSV function
-	records, err := readCSV(inputFile)
+	records, _, err := readCSV(inputFile)
 	if err != nil {
 		t.Errorf("readCSV() returned an error: %v", err)
 	}
@@ -64,7 +70,7 @@ func TestParseCSVRecords(t *testing.T) {
 	defer file.Close()
 
 	// Run the parseCSVRecords function
-	records, err := parseCSVRecords(file)
+	records, _, err := parseCSVRecords(file)
 	if err != nil {
 		t.Errorf("parseCSVRecords() returned an error: %v", err)
 	}
@@ -119,9 +125,9 @@ func TestReadCSV_EmptyFile(t *testing.T) {
 	defer os.Remove(file.Name())
 
 	// Run the readCSV function
-	records, err := readCSV(file.Name())
-	if err != nil {
-		t.Errorf("readCSV() returned an error for empty file: %v", err)
+	records, _, err := readCSV(file.Name())
+	if !errors.Is(err, ErrEmptyFile) {
+		t.Errorf("readCSV() error = %v; want %v", err, ErrEmptyFile)
 	}
 
 	// Verify the records
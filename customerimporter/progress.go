@@ -0,0 +1,316 @@
+package customerimporter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressUpdate is a snapshot of how far a run has read its input
+type ProgressUpdate struct {
+	Bytes      int64 // Bytes consumed from the input so far
+	TotalBytes int64 // Input size; 0 when unknown
+	Rows       int64 // Lines read so far, header included; records for a Source
+	Elapsed    time.Duration
+	Done       bool // Set on the final update of a run
+}
+
+// Percent returns the share of the input consumed, or 0 when the size is unknown
+func (u ProgressUpdate) Percent() float64 {
+	if u.TotalBytes <= 0 {
+		return 0
+	}
+	return 100 * float64(u.Bytes) / float64(u.TotalBytes)
+}
+
+// BytesPerSecond returns the average read throughput
+func (u ProgressUpdate) BytesPerSecond() float64 {
+	if u.Elapsed <= 0 {
+		return 0
+	}
+	return float64(u.Bytes) / u.Elapsed.Seconds()
+}
+
+// RowsPerSecond returns the average row throughput
+func (u ProgressUpdate) RowsPerSecond() float64 {
+	if u.Elapsed <= 0 {
+		return 0
+	}
+	return float64(u.Rows) / u.Elapsed.Seconds()
+}
+
+// ETA estimates the time left from the average throughput; 0 when unknown
+func (u ProgressUpdate) ETA() time.Duration {
+	rate := u.BytesPerSecond()
+	if u.TotalBytes <= 0 || rate <= 0 || u.Bytes >= u.TotalBytes {
+		return 0
+	}
+	return time.Duration(float64(u.TotalBytes-u.Bytes) / rate * float64(time.Second))
+}
+
+// ProgressFunc receives progress updates. It is called from a background
+// goroutine, one update at a time.
+type ProgressFunc func(ProgressUpdate)
+
+// progressTracker counts bytes and lines read and reports them periodically
+type progressTracker struct {
+	total   int64
+	start   time.Time
+	bytes   atomic.Int64
+	rows    atomic.Int64
+	stopped chan struct{}
+	wg      sync.WaitGroup
+}
+
+func (t *progressTracker) count(p []byte) {
+	t.bytes.Add(int64(len(p)))
+	t.rows.Add(int64(bytes.Count(p, []byte{'\n'})))
+}
+
+func (t *progressTracker) update(done bool) ProgressUpdate {
+	return ProgressUpdate{
+		Bytes:      t.bytes.Load(),
+		TotalBytes: t.total,
+		Rows:       t.rows.Load(),
+		Elapsed:    time.Since(t.start),
+		Done:       done,
+	}
+}
+
+// startProgress begins tracking the run over an input of total bytes (0 when
+// unknown). It returns nil when the run reports no progress.
+func (r *Run) startProgress(total int64) *progressTracker {
+	fn, interval := r.config.Progress, r.config.ProgressInterval
+	if fn == nil {
+		return nil
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	t := &progressTracker{total: total, start: time.Now(), stopped: make(chan struct{})}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn(t.update(false))
+			case <-t.stopped:
+				fn(t.update(true))
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// Stop sends the final update and waits for the reporter to return
+func (t *progressTracker) Stop() {
+	if t == nil {
+		return
+	}
+	close(t.stopped)
+	t.wg.Wait()
+}
+
+// Resume counts the offset bytes already processed by an interrupted run
+func (t *progressTracker) Resume(offset int64) {
+	if t != nil {
+		t.bytes.Add(offset)
+	}
+}
+
+// Reader wraps r so reads are counted; it returns r unchanged when t is nil
+func (t *progressTracker) Reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &progressReader{r: r, tracker: t}
+}
+
+// Row counts one record read from a Source
+func (t *progressTracker) Row() {
+	if t != nil {
+		t.rows.Add(1)
+	}
+}
+
+// Header counts a header row of n bytes read before tracking began
+func (t *progressTracker) Header(n int64) {
+	if t != nil {
+		t.bytes.Add(n)
+		t.rows.Add(1)
+	}
+}
+
+type progressReader struct {
+	r       io.Reader
+	tracker *progressTracker
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.tracker.count(b[:n])
+	return n, err
+}
+
+// sourceInput is the input of a Source that supports progress reporting. It
+// counts bytes read before tracking begins, such as the header row, so they
+// are reported once a tracker is attached.
+type sourceInput struct {
+	r       io.Reader
+	size    int64 // 0 when unknown
+	read    int64
+	tracker *progressTracker
+}
+
+func (s *sourceInput) Read(b []byte) (int, error) {
+	n, err := s.r.Read(b)
+	s.read += int64(n)
+	if s.tracker != nil {
+		s.tracker.bytes.Add(int64(n))
+	}
+	return n, err
+}
+
+// Size returns the input size, or 0 when unknown or s is nil
+func (s *sourceInput) Size() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.size
+}
+
+// Track counts the bytes read so far and every later read on t
+func (s *sourceInput) Track(t *progressTracker) {
+	if s == nil || t == nil {
+		return
+	}
+	s.tracker = t
+	t.bytes.Add(s.read)
+}
+
+// inputSize returns the size of inputs that can report one, such as *os.File
+func inputSize(input interface{}) int64 {
+	if f, ok := input.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			return info.Size()
+		}
+	}
+	return 0
+}
+
+// Width of the terminal progress bar in characters
+const progressBarWidth = 30
+
+// terminalBar is a progress bar line redrawn in place on a terminal
+type terminalBar struct {
+	mu   sync.Mutex
+	w    io.Writer
+	line string // Shown on the terminal; empty before the first update and after the last
+}
+
+// TerminalProgress renders updates as a single redrawn progress bar line,
+// for use when w is a terminal. Other output to the terminal, such as log
+// lines, should go through the returned writer, which clears the bar before
+// each write and redraws it after.
+func TerminalProgress(w io.Writer) (ProgressFunc, io.Writer) {
+	bar := &terminalBar{w: w}
+	return bar.update, bar
+}
+
+func (b *terminalBar) update(u ProgressUpdate) {
+	line := formatProgress(u)
+	if u.TotalBytes > 0 {
+		filled := int(u.Percent() / 100 * progressBarWidth)
+		if filled > progressBarWidth {
+			filled = progressBarWidth
+		}
+		bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+		line = "[" + bar + "] " + line
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// Pad so a shorter line fully overwrites the previous one
+	fmt.Fprintf(b.w, "\r%-100s", line)
+	b.line = line
+	if u.Done {
+		fmt.Fprint(b.w, "\n")
+		b.line = ""
+	}
+}
+
+// Write clears the bar, writes p and redraws the bar after it
+func (b *terminalBar) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.line != "" {
+		fmt.Fprintf(b.w, "\r%-100s\r", "")
+	}
+	n, err := b.w.Write(p)
+	if b.line != "" {
+		fmt.Fprintf(b.w, "\r%-100s", b.line)
+	}
+	return n, err
+}
+
+// LogProgress reports updates as log lines, for use when stderr is not a terminal
+func LogProgress() ProgressFunc {
+	return func(u ProgressUpdate) {
+		args := []any{
+			"bytes", u.Bytes,
+			"rows", u.Rows,
+			"rows_per_second", int64(u.RowsPerSecond()),
+			"bytes_per_second", int64(u.BytesPerSecond()),
+		}
+		if u.TotalBytes > 0 {
+			args = append(args, "percent", fmt.Sprintf("%.1f", u.Percent()), "eta", u.ETA().Round(time.Second).String())
+		}
+		logger.Info("progress", args...)
+	}
+}
+
+// formatProgress summarises an update as percentage, volume, throughput and ETA
+func formatProgress(u ProgressUpdate) string {
+	var b strings.Builder
+	if u.TotalBytes > 0 {
+		fmt.Fprintf(&b, "%5.1f%%  %s/%s", u.Percent(), formatBytes(u.Bytes), formatBytes(u.TotalBytes))
+	} else {
+		b.WriteString(formatBytes(u.Bytes))
+	}
+	fmt.Fprintf(&b, "  %d rows/s  %s/s", int64(u.RowsPerSecond()), formatBytes(int64(u.BytesPerSecond())))
+	switch {
+	case u.Done:
+		fmt.Fprintf(&b, "  done in %s", u.Elapsed.Round(time.Second))
+	case u.ETA() > 0:
+		fmt.Fprintf(&b, "  ETA %s", u.ETA().Round(time.Second))
+	}
+	return b.String()
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. "1.5 GiB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// isTerminal reports whether f is attached to a character device such as a TTY
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,218 @@
+package customerimporter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgressUpdate(t *testing.T) {
+	u := ProgressUpdate{Bytes: 250, TotalBytes: 1000, Rows: 50, Elapsed: 5 * time.Second}
+	if u.Percent() != 25 {
+		t.Errorf("Percent() = %v; want 25", u.Percent())
+	}
+	if u.BytesPerSecond() != 50 || u.RowsPerSecond() != 10 {
+		t.Errorf("BytesPerSecond(), RowsPerSecond() = %v, %v; want 50, 10", u.BytesPerSecond(), u.RowsPerSecond())
+	}
+	if u.ETA() != 15*time.Second {
+		t.Errorf("ETA() = %v; want 15s", u.ETA())
+	}
+
+	unknown := ProgressUpdate{Bytes: 250, Elapsed: time.Second}
+	if unknown.Percent() != 0 || unknown.ETA() != 0 {
+		t.Errorf("Percent(), ETA() = %v, %v for an unknown size; want 0, 0", unknown.Percent(), unknown.ETA())
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n        int64
+		expected string
+	}{
+		{512, "512 B"},
+		{1536, "1.5 KiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+	for _, test := range tests {
+		if result := formatBytes(test.n); result != test.expected {
+			t.Errorf("formatBytes(%d) = %q; want %q", test.n, result, test.expected)
+		}
+	}
+}
+
+func TestTerminalProgress(t *testing.T) {
+	var buf bytes.Buffer
+	render, _ := TerminalProgress(&buf)
+
+	render(ProgressUpdate{Bytes: 500, TotalBytes: 1000, Rows: 10, Elapsed: time.Second})
+	if out := buf.String(); !strings.HasPrefix(out, "\r[===============               ]  50.0%") || !strings.Contains(out, "ETA 1s") || strings.HasSuffix(out, "\n") {
+		t.Errorf("TerminalProgress() rendered %q; want a half-full bar with an ETA", out)
+	}
+
+	buf.Reset()
+	render(ProgressUpdate{Bytes: 1000, TotalBytes: 1000, Rows: 20, Elapsed: 2 * time.Second, Done: true})
+	if out := buf.String(); !strings.Contains(out, "100.0%") || !strings.Contains(out, "done in 2s") || !strings.HasSuffix(out, "\n") {
+		t.Errorf("TerminalProgress() rendered %q; want a full bar ending the line", out)
+	}
+}
+
+func TestTerminalProgress_PausesForLogs(t *testing.T) {
+	var buf bytes.Buffer
+	render, output := TerminalProgress(&buf)
+
+	// Without a bar on screen, log lines are written as they are
+	output.Write([]byte("before\n"))
+	if buf.String() != "before\n" {
+		t.Errorf("Write() before the first update wrote %q; want the line alone", buf.String())
+	}
+
+	render(ProgressUpdate{Bytes: 500, TotalBytes: 1000, Elapsed: time.Second})
+	bar := strings.TrimPrefix(buf.String(), "before\n")
+	buf.Reset()
+	output.Write([]byte("level=WARN msg=\"skipping row\"\n"))
+	clear := "\r" + strings.Repeat(" ", 100) + "\r"
+	if expected := clear + "level=WARN msg=\"skipping row\"\n" + bar; buf.String() != expected {
+		t.Errorf("Write() with a bar on screen wrote %q; want %q", buf.String(), expected)
+	}
+
+	render(ProgressUpdate{Bytes: 1000, TotalBytes: 1000, Elapsed: time.Second, Done: true})
+	buf.Reset()
+	output.Write([]byte("after\n"))
+	if buf.String() != "after\n" {
+		t.Errorf("Write() after the final update wrote %q; want the line alone", buf.String())
+	}
+}
+
+// recordProgress returns a run whose reporter keeps every update, and a
+// function returning the updates so far
+func recordProgress(t *testing.T) (*Run, func() []ProgressUpdate) {
+	t.Helper()
+	var mu sync.Mutex
+	var updates []ProgressUpdate
+	run := NewRun(RunConfig{Progress: func(u ProgressUpdate) {
+		mu.Lock()
+		defer mu.Unlock()
+		updates = append(updates, u)
+	}, ProgressInterval: time.Millisecond})
+	return run, func() []ProgressUpdate {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]ProgressUpdate(nil), updates...)
+	}
+}
+
+func TestProgressReporter_AppliedByModes(t *testing.T) {
+	run, updates := recordProgress(t)
+
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n" +
+		"Jane,Doe,jane@example.com,Female,2.2.2.2\n"
+	path := filepath.Join(t.TempDir(), "progress.csv")
+	os.WriteFile(path, []byte(data), 0644)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := run.ProcessWithConcurrentStreaming(file); err != nil {
+		t.Fatalf("ProcessWithConcurrentStreaming() returned an error: %v", err)
+	}
+	got := updates()
+	final := got[len(got)-1]
+	expected := ProgressUpdate{Bytes: int64(len(data)), TotalBytes: int64(len(data)), Rows: 3, Done: true}
+	final.Elapsed = 0
+	if final != expected {
+		t.Errorf("ProcessWithConcurrentStreaming() final progress = %+v; want %+v", final, expected)
+	}
+
+	file.Seek(0, 0)
+	if _, err := run.ProcessDistinct(file); err != nil {
+		t.Fatalf("ProcessDistinct() returned an error: %v", err)
+	}
+	got = updates()
+	if final := got[len(got)-1]; !final.Done || final.Bytes != int64(len(data)) || final.Percent() != 100 {
+		t.Errorf("ProcessDistinct() final progress = %+v; want all %d bytes read", final, len(data))
+	}
+
+	// The header, read separately, is counted once along with every range
+	if _, err := run.ProcessWithParallelRanges(file, 2); err != nil {
+		t.Fatalf("ProcessWithParallelRanges() returned an error: %v", err)
+	}
+	got = updates()
+	final = got[len(got)-1]
+	final.Elapsed = 0
+	if final != expected {
+		t.Errorf("ProcessWithParallelRanges() final progress = %+v; want %+v", final, expected)
+	}
+
+	// Several ranges still count each byte once
+	if _, err := run.processRanges(file, int64(len(data)), 3); err != nil {
+		t.Fatalf("processRanges() returned an error: %v", err)
+	}
+	got = updates()
+	final = got[len(got)-1]
+	final.Elapsed = 0
+	if final != expected {
+		t.Errorf("processRanges() over 3 ranges final progress = %+v; want %+v", final, expected)
+	}
+}
+
+func TestProgressReporter_Sources(t *testing.T) {
+	run, updates := recordProgress(t)
+
+	data := "CUSTOMER EXTRACT\n" +
+		"John      Doe       john.doe@example.com          male\n" +
+		"Jane      Smith     jane.smith@example.com        female\n"
+	path := filepath.Join(t.TempDir(), "progress.dat")
+	os.WriteFile(path, []byte(data), 0644)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer file.Close()
+	src, err := NewFixedWidthSource(file, testLayout)
+	if err != nil {
+		t.Fatalf("NewFixedWidthSource() returned an error: %v", err)
+	}
+	if _, err := run.ProcessSource(src); err != nil {
+		t.Fatalf("ProcessSource() returned an error: %v", err)
+	}
+	got := updates()
+	final := got[len(got)-1]
+	final.Elapsed = 0
+	expected := ProgressUpdate{Bytes: int64(len(data)), TotalBytes: int64(len(data)), Rows: 2, Done: true}
+	if final != expected {
+		t.Errorf("ProcessSource() final fixed-width progress = %+v; want %+v", final, expected)
+	}
+
+	// The header row, read when the workbook is opened, is counted too
+	workbook, err := OpenXLSX(testWorkbook(t), "Customers")
+	if err != nil {
+		t.Fatalf("OpenXLSX() returned an error: %v", err)
+	}
+	defer workbook.Close()
+	if _, err := run.ProcessSource(workbook); err != nil {
+		t.Fatalf("ProcessSource() returned an error: %v", err)
+	}
+	got = updates()
+	if final := got[len(got)-1]; !final.Done || final.TotalBytes == 0 || final.Bytes != final.TotalBytes || final.Rows != 4 {
+		t.Errorf("ProcessSource() final XLSX progress = %+v; want the whole sheet and 4 rows read", final)
+	}
+}
+
+func TestProgressReporter_Disabled(t *testing.T) {
+	if tracker := NewRun(RunConfig{}).startProgress(100); tracker != nil {
+		t.Errorf("startProgress() = %v with no reporter installed; want nil", tracker)
+	}
+	var tracker *progressTracker
+	r := strings.NewReader("data")
+	if tracker.Reader(r) != r {
+		t.Errorf("Reader() wrapped the input with no reporter installed")
+	}
+	tracker.Stop()
+}
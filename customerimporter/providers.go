@@ -0,0 +1,104 @@
+package customerimporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ProviderRule describes how a mail provider treats addresses in its domain
+type ProviderRule struct {
+	IgnoreDots    bool     `json:"ignore_dots"`       // "j.doe" and "jdoe" are the same mailbox
+	StripPlusTags bool     `json:"strip_plus_tags"`   // "jdoe+promo" delivers to "jdoe"
+	Aliases       []string `json:"aliases,omitempty"` // Other domains delivering to the same mailboxes
+}
+
+// ProviderRules maps a canonical domain to its rule
+type ProviderRules map[string]ProviderRule
+
+// DefaultProviderRules returns the built-in rules for common providers
+func DefaultProviderRules() ProviderRules {
+	return ProviderRules{
+		"gmail.com":      {IgnoreDots: true, StripPlusTags: true, Aliases: []string{"googlemail.com"}},
+		"outlook.com":    {StripPlusTags: true},
+		"hotmail.com":    {StripPlusTags: true},
+		"live.com":       {StripPlusTags: true},
+		"icloud.com":     {StripPlusTags: true, Aliases: []string{"me.com", "mac.com"}},
+		"fastmail.com":   {StripPlusTags: true},
+		"protonmail.com": {StripPlusTags: true, Aliases: []string{"proton.me", "pm.me"}},
+	}
+}
+
+// LoadProviderRules reads a JSON rule table and merges it over the defaults;
+// entries in the file replace the built-in rule for the same domain
+func LoadProviderRules(fileName string) (ProviderRules, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading provider rules: %w", err)
+	}
+	var loaded ProviderRules
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("error parsing provider rules: %w", err)
+	}
+	rules := DefaultProviderRules()
+	for domain, rule := range loaded {
+		rules[strings.ToLower(domain)] = rule
+	}
+	return rules, nil
+}
+
+// providerIndex resolves any canonical or alias domain to its canonical rule
+type providerIndex map[string]providerEntry
+
+type providerEntry struct {
+	canonical string
+	rule      ProviderRule
+}
+
+func (r ProviderRules) index() providerIndex {
+	index := make(providerIndex, len(r))
+	for domain, rule := range r {
+		domain = strings.ToLower(domain)
+		index[domain] = providerEntry{domain, rule}
+		for _, alias := range rule.Aliases {
+			index[strings.ToLower(alias)] = providerEntry{domain, rule}
+		}
+	}
+	return index
+}
+
+// Index of the built-in rules, for normalisation outside a Run
+var defaultProviders = DefaultProviderRules().index()
+
+// canonicalDomain maps provider alias domains (e.g. googlemail.com) to their
+// canonical domain; other domains are returned unchanged
+func (p providerIndex) canonicalDomain(domain string) string {
+	if entry, ok := p[strings.ToLower(domain)]; ok {
+		return entry.canonical
+	}
+	return domain
+}
+
+// canonicaliseEmail applies the provider rule for the email's domain to a
+// lowercased address
+func (p providerIndex) canonicaliseEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at == -1 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+	entry, ok := p[domain]
+	if !ok {
+		return email
+	}
+	if entry.rule.StripPlusTags {
+		if plus := strings.Index(local, "+"); plus != -1 {
+			local = local[:plus]
+		}
+	}
+	if entry.rule.IgnoreDots {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + entry.canonical
+}
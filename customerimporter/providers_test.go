@@ -0,0 +1,116 @@
+package customerimporter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCanonicaliseEmail(t *testing.T) {
+	tests := []struct {
+		email    string
+		expected string
+	}{
+		{"john.doe+promo@gmail.com", "johndoe@gmail.com"},
+		{"j.o.h.n.doe@googlemail.com", "johndoe@gmail.com"},
+		{"john.doe+promo@outlook.com", "john.doe@outlook.com"},
+		{"john.doe+promo@example.com", "john.doe+promo@example.com"}, // No rule for the domain
+		{"jdoe@me.com", "jdoe@icloud.com"},
+		{"invalid-email", "invalid-email"},
+	}
+
+	for _, test := range tests {
+		result := defaultProviders.canonicaliseEmail(test.email)
+		if result != test.expected {
+			t.Errorf("canonicaliseEmail(%q) = %q; want %q", test.email, result, test.expected)
+		}
+	}
+}
+
+func TestNormaliseEmail_ProviderRules(t *testing.T) {
+	if result := normaliseEmail(" John.Doe+News@GoogleMail.com "); result != "johndoe@gmail.com" {
+		t.Errorf("normaliseEmail() = %q; want %q", result, "johndoe@gmail.com")
+	}
+}
+
+func TestCanonicalDomain(t *testing.T) {
+	tests := []struct {
+		domain   string
+		expected string
+	}{
+		{"googlemail.com", "gmail.com"},
+		{"GoogleMail.com", "gmail.com"},
+		{"gmail.com", "gmail.com"},
+		{"Example.com", "Example.com"}, // Unknown domains are left untouched
+	}
+
+	for _, test := range tests {
+		result := defaultProviders.canonicalDomain(test.domain)
+		if result != test.expected {
+			t.Errorf("canonicalDomain(%q) = %q; want %q", test.domain, result, test.expected)
+		}
+	}
+}
+
+func TestLoadProviderRules(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "providers.json")
+	os.WriteFile(rulesFile, []byte(`{
+		"acme.com": {"ignore_dots": true, "aliases": ["acme-mail.com"]},
+		"gmail.com": {"strip_plus_tags": true}
+	}`), 0644)
+
+	rules, err := LoadProviderRules(rulesFile)
+	if err != nil {
+		t.Fatalf("LoadProviderRules() returned an error: %v", err)
+	}
+	index := rules.index()
+
+	tests := []struct {
+		email    string
+		expected string
+	}{
+		{"j.doe+x@acme-mail.com", "jdoe+x@acme.com"},
+		{"j.doe+x@gmail.com", "j.doe@gmail.com"},     // File rule replaces the default
+		{"j.doe+x@outlook.com", "j.doe@outlook.com"}, // Defaults are kept
+	}
+	for _, test := range tests {
+		result := index.normaliseEmail(test.email)
+		if result != test.expected {
+			t.Errorf("normaliseEmail(%q) = %q; want %q", test.email, result, test.expected)
+		}
+	}
+
+	if _, err := LoadProviderRules(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("LoadProviderRules() did not return an error for a missing file")
+	}
+}
+
+func TestProviderRules_CountingAndDuplicates(t *testing.T) {
+	records := []Record{
+		{Email: "john.doe@gmail.com"},
+		{Email: "johndoe+shop@googlemail.com"},
+		{Email: "jane@gmail.com"},
+	}
+	expected := map[string]int{"gmail.com": 3}
+	if result := countEmailDomains(records); !reflect.DeepEqual(result, expected) {
+		t.Errorf("countEmailDomains() = %v; want %v", result, expected)
+	}
+
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john.doe@gmail.com,Male,1.1.1.1\n" +
+		"John,Doe,johndoe+shop@googlemail.com,Male,1.1.1.1\n" +
+		"Jane,Doe,jane@gmail.com,Female,2.2.2.2\n"
+	result, err := ProcessDistinct(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("ProcessDistinct() returned an error: %v", err)
+	}
+	if !reflect.DeepEqual(result.UniqueCounts, map[string]int{"gmail.com": 2}) {
+		t.Errorf("ProcessDistinct() UniqueCounts = %v; want map[gmail.com:2]", result.UniqueCounts)
+	}
+	expectedDuplicates := []DuplicateEmail{{Email: "johndoe@gmail.com", Rows: []int{2, 3}}}
+	if !reflect.DeepEqual(result.Duplicates, expectedDuplicates) {
+		t.Errorf("ProcessDistinct() Duplicates = %v; want %v", result.Duplicates, expectedDuplicates)
+	}
+}
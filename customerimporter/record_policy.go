@@ -0,0 +1,98 @@
+package customerimporter
+
+import (
+	"fmt"
+)
+
+// Actions taken when a run breaks its record-count policy
+const (
+	PolicyFail = "fail"
+	PolicyWarn = "warn"
+)
+
+// RecordCountPolicy sets the limits a run must meet to be accepted
+type RecordCountPolicy struct {
+	MinRecords     int     // Fewest valid rows accepted
+	MaxRecords     int     // Most valid rows accepted; 0 means no limit
+	MaxRejectRatio float64 // Largest share of rejected rows (0-1); 0 disables the check
+	Action         string  // PolicyFail aborts the run, PolicyWarn only logs
+}
+
+// DefaultRecordCountPolicy returns the historical fixed limits
+func DefaultRecordCountPolicy() RecordCountPolicy {
+	return RecordCountPolicy{MinRecords: MinRecords, MaxRecords: MaxRecords, Action: PolicyFail}
+}
+
+func (p RecordCountPolicy) validate() error {
+	if p.Action != PolicyFail && p.Action != PolicyWarn {
+		return fmt.Errorf("policy action must be %q or %q, got %q", PolicyFail, PolicyWarn, p.Action)
+	}
+	if p.MinRecords < 0 || p.MaxRecords < 0 {
+		return fmt.Errorf("record limits must not be negative")
+	}
+	if p.MaxRecords > 0 && p.MinRecords > p.MaxRecords {
+		return fmt.Errorf("minimum records %d exceeds maximum %d", p.MinRecords, p.MaxRecords)
+	}
+	if p.MaxRejectRatio < 0 || p.MaxRejectRatio > 1 {
+		return fmt.Errorf("reject ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// Check applies the policy to the valid and rejected row counts of a run. A
+// violation is returned as an error under PolicyFail and logged under PolicyWarn.
+func (p RecordCountPolicy) Check(valid, rejected int) error {
+	err := p.violation(valid, rejected)
+	if err != nil && p.Action == PolicyWarn {
+		logger.Warn("record-count policy not met", "error", err)
+		return nil
+	}
+	return err
+}
+
+func (p RecordCountPolicy) violation(valid, rejected int) error {
+	maxRecords := p.MaxRecords
+	if maxRecords == 0 {
+		maxRecords = int(^uint(0) >> 1)
+	}
+	// An empty run is only an error when records are required
+	if valid == NoRecords && p.MinRecords == 0 {
+		return nil
+	}
+	if err := checkRecordCount(valid, p.MinRecords, maxRecords); err != nil {
+		return err
+	}
+	if total := valid + rejected; p.MaxRejectRatio > 0 && total > 0 {
+		if ratio := float64(rejected) / float64(total); ratio > p.MaxRejectRatio {
+			return fmt.Errorf("%w: %d of %d (%.1f%%, limit %.1f%%)",
+				ErrTooManyRejects, rejected, total, 100*ratio, 100*p.MaxRejectRatio)
+		}
+	}
+	return nil
+}
+
+// checkProcessCounts applies the run's policy, or the default limits when it
+// has none, to Process
+func (r *Run) checkProcessCounts(valid, rejected int) error {
+	if r.config.CountPolicy == nil {
+		return DefaultRecordCountPolicy().Check(valid, rejected)
+	}
+	return r.config.CountPolicy.Check(valid, rejected)
+}
+
+// checkStreamingCounts applies the run's policy, if any, to a streaming mode
+func (r *Run) checkStreamingCounts(valid, rejected int) error {
+	if r.config.CountPolicy == nil {
+		return nil
+	}
+	return r.config.CountPolicy.Check(valid, rejected)
+}
+
+// checkReaderCounts applies the run's policy to a mode reading an io.Reader.
+// Without a policy, an input with no valid row fails with ErrNoRecords.
+func (r *Run) checkReaderCounts(valid, rejected int) error {
+	if r.config.CountPolicy == nil && valid == NoRecords {
+		return ErrNoRecords
+	}
+	return r.checkStreamingCounts(valid, rejected)
+}
@@ -0,0 +1,164 @@
+package customerimporter
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordCountPolicy_Check(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RecordCountPolicy
+		valid    int
+		rejected int
+		wantErr  bool
+	}{
+		{"within limits", RecordCountPolicy{MinRecords: 1, MaxRecords: 10, Action: PolicyFail}, 5, 0, false},
+		{"too few", RecordCountPolicy{MinRecords: 10, Action: PolicyFail}, 5, 0, true},
+		{"too few warns", RecordCountPolicy{MinRecords: 10, Action: PolicyWarn}, 5, 0, false},
+		{"too many", RecordCountPolicy{MaxRecords: 4, Action: PolicyFail}, 5, 0, true},
+		{"no upper limit", RecordCountPolicy{Action: PolicyFail}, 5000000, 0, false},
+		{"no records", RecordCountPolicy{MinRecords: 1, Action: PolicyFail}, 0, 3, true},
+		{"no records allowed", RecordCountPolicy{Action: PolicyFail}, 0, 3, false},
+		{"reject ratio within limit", RecordCountPolicy{MaxRejectRatio: 0.05, Action: PolicyFail}, 95, 5, false},
+		{"reject ratio exceeded", RecordCountPolicy{MaxRejectRatio: 0.05, Action: PolicyFail}, 94, 6, true},
+		{"reject ratio warns", RecordCountPolicy{MaxRejectRatio: 0.05, Action: PolicyWarn}, 50, 50, false},
+	}
+
+	for _, test := range tests {
+		err := test.policy.Check(test.valid, test.rejected)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: Check(%d, %d) = %v; want error %v", test.name, test.valid, test.rejected, err, test.wantErr)
+		}
+	}
+}
+
+func TestRecordCountPolicy_Validate(t *testing.T) {
+	invalid := []RecordCountPolicy{
+		{Action: "ignore"},
+		{MinRecords: -1, Action: PolicyFail},
+		{MinRecords: 10, MaxRecords: 5, Action: PolicyFail},
+		{MaxRejectRatio: 1.5, Action: PolicyWarn},
+	}
+	for _, policy := range invalid {
+		if err := policy.validate(); err == nil {
+			t.Errorf("validate(%+v) did not return an error", policy)
+		}
+	}
+	if err := DefaultRecordCountPolicy().validate(); err != nil {
+		t.Errorf("validate() returned an error for the default policy: %v", err)
+	}
+}
+
+func TestRecordCountPolicy_AppliedToStreaming(t *testing.T) {
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n" +
+		"Jane,Doe,jane@example.com,Female,2.2.2.2\n" +
+		"Bad,Row,not-an-email,Male,3.3.3.3\n"
+	file, err := os.CreateTemp(t.TempDir(), "policy_test.csv")
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	file.WriteString(data)
+
+	tests := []struct {
+		policy  RecordCountPolicy
+		wantErr bool
+	}{
+		{RecordCountPolicy{MinRecords: 2, Action: PolicyFail}, false},
+		{RecordCountPolicy{MinRecords: 3, Action: PolicyFail}, true},
+		{RecordCountPolicy{MinRecords: 3, Action: PolicyWarn}, false},
+		{RecordCountPolicy{MaxRejectRatio: 0.5, Action: PolicyFail}, false},
+		{RecordCountPolicy{MaxRejectRatio: 0.3, Action: PolicyFail}, true},
+	}
+
+	for _, test := range tests {
+		run := NewRun(RunConfig{CountPolicy: &test.policy})
+
+		file.Seek(0, 0)
+		_, err := run.ProcessWithConcurrentStreaming(file)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ProcessWithConcurrentStreaming() with %+v returned %v; want error %v", test.policy, err, test.wantErr)
+		}
+
+		_, err = run.ProcessWithParallelRanges(file, 2)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ProcessWithParallelRanges() with %+v returned %v; want error %v", test.policy, err, test.wantErr)
+		}
+	}
+}
+
+func TestRecordCountPolicy_AppliedToEveryMode(t *testing.T) {
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n" +
+		"Jane,Doe,jane@example.com,Female,2.2.2.2\n" +
+		"Bad,Row,not-an-email,Male,3.3.3.3\n"
+	fixedWidth := strings.Join([]string{
+		"CUSTOMER EXTRACT",
+		"John      Doe       john.doe@example.com          male",
+		"Jane      Smith     jane.smith@example.com        female",
+		"Bad       Row       not-an-email                  male",
+	}, "\n")
+
+	modes := map[string]func(run *Run) error{
+		"ProcessSource": func(run *Run) error {
+			src, err := NewFixedWidthSource(strings.NewReader(fixedWidth), testLayout)
+			if err != nil {
+				return err
+			}
+			_, err = run.ProcessSource(src)
+			return err
+		},
+		"ProcessApproximate": func(run *Run) error {
+			_, err := run.ProcessApproximate(strings.NewReader(data), DefaultApproximateConfig())
+			return err
+		},
+		"ProcessWithMemoryLimit": func(run *Run) error {
+			_, err := run.ProcessWithMemoryLimit(strings.NewReader(data), io.Discard, 1<<20)
+			return err
+		},
+		"ProcessDistinct": func(run *Run) error {
+			_, err := run.ProcessDistinct(strings.NewReader(data))
+			return err
+		},
+	}
+
+	tests := []struct {
+		policy  RecordCountPolicy
+		wantErr bool
+	}{
+		{RecordCountPolicy{MinRecords: 2, Action: PolicyFail}, false},
+		{RecordCountPolicy{MinRecords: 3, Action: PolicyFail}, true},
+		{RecordCountPolicy{MaxRejectRatio: 0.3, Action: PolicyFail}, true},
+	}
+	for name, process := range modes {
+		for _, test := range tests {
+			err := process(NewRun(RunConfig{CountPolicy: &test.policy}))
+			if (err != nil) != test.wantErr {
+				t.Errorf("%s() with %+v returned %v; want error %v", name, test.policy, err, test.wantErr)
+			}
+		}
+	}
+}
+
+func TestRecordCountPolicy_NoMinimum(t *testing.T) {
+	header := "first_name,last_name,email,gender,ip_address\n"
+
+	// Without a policy an empty input is still an error
+	if _, err := NewRun(RunConfig{}).ProcessReader(strings.NewReader(header)); !errors.Is(err, ErrNoRecords) {
+		t.Errorf("ProcessReader() without a policy returned %v; want ErrNoRecords", err)
+	}
+
+	policy := RecordCountPolicy{Action: PolicyFail}
+	run := NewRun(RunConfig{CountPolicy: &policy})
+	if _, err := run.ProcessReader(strings.NewReader(header)); err != nil {
+		t.Errorf("ProcessReader() with no minimum returned %v; want an empty result", err)
+	}
+	if _, err := run.Process(writeStrictTestFile(t, header).Name(), filepath.Join(t.TempDir(), "out.txt")); err != nil {
+		t.Errorf("Process() with no minimum returned %v; want an empty result", err)
+	}
+}
@@ -0,0 +1,70 @@
+package customerimporter
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// RunConfig holds the settings of one import. The zero value skips malformed
+// rows, applies the default provider rules and record-count limits, and
+// validates, reports progress, traces and checkpoints nothing.
+type RunConfig struct {
+	Strict           bool               // Fail on the first malformed row instead of skipping it
+	Providers        ProviderRules      // Email canonicalisation rules; nil uses DefaultProviderRules
+	Validator        *Validator         // Validation rules; nil applies none
+	CountPolicy      *RecordCountPolicy // Record-count limits; nil keeps the built-in behaviour
+	Progress         ProgressFunc       // Receives progress updates; nil disables progress reporting
+	ProgressInterval time.Duration      // Time between progress updates; one second when 0
+	Tracer           *Tracer            // nil disables tracing
+	Checkpoint       CheckpointConfig   // Single-threaded and concurrent-streaming modes only
+}
+
+// Run is one import under a RunConfig. It keeps the skipped-row tally and
+// rejection counts of that import alone, so runs with different settings can
+// proceed concurrently. The package-level Process functions each use a new
+// Run with the zero RunConfig.
+type Run struct {
+	config    RunConfig
+	providers providerIndex
+	validator *Validator // Applies config.Validator's rules with counts of its own
+	skips     skipTally
+	rows      atomic.Int64 // Data rows read, skipped or not
+	quiet     bool         // Re-reads rows already imported: skips are neither logged nor counted
+}
+
+// NewRun prepares a run with config
+func NewRun(config RunConfig) *Run {
+	rules := config.Providers
+	if rules == nil {
+		rules = DefaultProviderRules()
+	}
+	return &Run{
+		config:    config,
+		providers: rules.index(),
+		validator: config.Validator.forRun(),
+		skips:     skipTally{counts: make(map[string]int), totals: make(map[string]int)},
+	}
+}
+
+// rowRead counts a data row read by the run
+func (r *Run) rowRead() {
+	r.rows.Add(1)
+	if !r.quiet {
+		metrics.rowRead()
+	}
+}
+
+// Rejects returns the rows rejected so far by the built-in email checks and
+// the validation rules
+func (r *Run) Rejects() RejectReport {
+	report := RejectReport{Rules: make(map[string]int64)}
+	if r.validator != nil {
+		report = r.validator.Report()
+	}
+	skipped := r.skips.snapshot()
+	for reason, rule := range builtinRules {
+		report.Rules[rule] = int64(skipped[reason])
+		report.Rejected += int64(skipped[reason])
+	}
+	return report
+}
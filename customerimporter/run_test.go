@@ -0,0 +1,80 @@
+package customerimporter
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRun_SettingsAreIndependent(t *testing.T) {
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john.doe@acme.com,Male,1.1.1.1\n" +
+		"John,Doe,johndoe@acme-mail.com,Robot,2.2.2.2\n" +
+		"Bad,Row,not-an-email,Male,3.3.3.3\n"
+	v := testValidator(t)
+	acme := ProviderRules{"acme.com": {IgnoreDots: true, Aliases: []string{"acme-mail.com"}}}
+
+	tests := []struct {
+		name     string
+		config   RunConfig
+		expected map[string]int
+		rejected int64
+		strict   bool
+	}{
+		{"defaults", RunConfig{}, map[string]int{"acme.com": 1, "acme-mail.com": 1}, 1, false},
+		{"providers", RunConfig{Providers: acme}, map[string]int{"acme.com": 2}, 1, false},
+		{"validator", RunConfig{Validator: v}, map[string]int{"acme.com": 1}, 2, false},
+		{"strict", RunConfig{Strict: true, Providers: acme}, nil, 0, true},
+	}
+
+	// Runs with different settings proceed side by side
+	var wg sync.WaitGroup
+	for _, test := range tests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run := NewRun(test.config)
+			result, err := run.ProcessReader(strings.NewReader(data))
+			var rowErr *RowError
+			switch {
+			case test.strict && !errors.As(err, &rowErr):
+				t.Errorf("%s: ProcessReader() error = %v; want a *RowError", test.name, err)
+			case !test.strict && (err != nil || !reflect.DeepEqual(result.DomainCounts, test.expected)):
+				t.Errorf("%s: ProcessReader() = %v, %v; want %v", test.name, result.DomainCounts, err, test.expected)
+			}
+			if rejected := run.Rejects().Rejected; rejected != test.rejected {
+				t.Errorf("%s: Rejects() = %d rejected; want %d", test.name, rejected, test.rejected)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if report := v.Report(); report.Rejected != 0 {
+		t.Errorf("Report() of the shared validator = %+v; want the runs' rejections kept apart", report)
+	}
+}
+
+func TestRun_CountsRowsRead(t *testing.T) {
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john.doe@acme.com,Male,1.1.1.1\n" +
+		"Bad,Row,not-an-email,Male,3.3.3.3\n"
+	run := NewRun(RunConfig{})
+	if _, err := run.ProcessReader(strings.NewReader(data)); err != nil {
+		t.Fatalf("ProcessReader() error = %v", err)
+	}
+	// The skip summary resets the log tally but not the run's totals
+	run.LogSkipSummary()
+
+	if rows := run.rows.Load(); rows != 2 {
+		t.Errorf("rows read = %d; want 2", rows)
+	}
+	if skipped := run.skips.snapshot(); !reflect.DeepEqual(skipped, map[string]int{reasonInvalidEmail: 1}) {
+		t.Errorf("skips.snapshot() = %v; want one invalid email", skipped)
+	}
+	// Built-in checks are reported as rules
+	if report := run.Rejects(); report.Rejected != 1 || report.Rules["email.format"] != 1 || report.Rules["email.domain"] != 0 {
+		t.Errorf("Rejects() = %+v; want one email.format rejection", report)
+	}
+}
@@ -0,0 +1,233 @@
+package customerimporter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ServerConfig tunes the import HTTP server
+type ServerConfig struct {
+	MaxUploadBytes int64 // Largest accepted request body
+}
+
+// DefaultServerConfig returns the limits used by the serve command
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{MaxUploadBytes: 100 << 20}
+}
+
+// DomainCount is one domain and its customer count in an import result
+type DomainCount struct {
+	Domain string `json:"domain"`
+	Count  int    `json:"count"`
+}
+
+// ImportServer serves imports over HTTP, running them as jobs on a JobQueue:
+//
+//	POST   /imports        queue the CSV in a multipart "file" field or the raw body
+//	GET    /imports/{id}   job state and results as JSON, or CSV with ?format=csv
+//	DELETE /imports/{id}   cancel a queued or running job
+//	GET    /healthz        liveness
+//	GET    /readyz         readiness; 503 once shutdown has begun
+//	GET    /metrics        Prometheus metrics
+type ImportServer struct {
+	config   ServerConfig
+	queue    *JobQueue
+	mux      *http.ServeMux
+	draining atomic.Bool
+}
+
+// NewImportServer returns a server with the given limits that runs imports on queue
+func NewImportServer(config ServerConfig, queue *JobQueue) *ImportServer {
+	s := &ImportServer{config: config, queue: queue, mux: http.NewServeMux()}
+	s.mux.HandleFunc("POST /imports", s.handleCreate)
+	s.mux.HandleFunc("GET /imports/{id}", s.handleGet)
+	s.mux.HandleFunc("DELETE /imports/{id}", s.handleCancel)
+	s.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	s.mux.HandleFunc("GET /readyz", s.handleReady)
+	s.mux.Handle("GET /metrics", MetricsHandler())
+	return s
+}
+
+func (s *ImportServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves on addr until ctx is cancelled, then stops reporting
+// ready and waits up to 30 seconds for in-flight requests to finish. Running
+// jobs are left to the queue, which the caller closes.
+func (s *ImportServer) ListenAndServe(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error starting import server: %w", err)
+	}
+	server := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	logger.Info("serving imports", "address", listener.Addr().String())
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(listener) }()
+	select {
+	case err := <-errs:
+		return fmt.Errorf("error serving imports: %w", err)
+	case <-ctx.Done():
+	}
+	s.draining.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error shutting down import server: %w", err)
+	}
+	return nil
+}
+
+func (s *ImportServer) handleReady(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	io.WriteString(w, "ok\n")
+}
+
+func (s *ImportServer) handleCreate(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxUploadBytes)
+	input, err := uploadReader(r)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	job, err := s.queue.Submit(input)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeUploadError(w, err)
+		return
+	} else if err != nil {
+		logger.Error("unable to queue import", "error", err)
+		http.Error(w, "unable to queue import", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", "/imports/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *ImportServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	job, err := s.queue.Get(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !wantsCSV(r) {
+		writeJSON(w, http.StatusOK, job)
+		return
+	}
+	if job.State != JobSucceeded {
+		http.Error(w, "import has no results: "+job.State, http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"domain", "count"})
+	for _, dc := range job.Domains {
+		writer.Write([]string{dc.Domain, strconv.Itoa(dc.Count)})
+	}
+	writer.Flush()
+}
+
+func (s *ImportServer) handleCancel(w http.ResponseWriter, r *http.Request) {
+	job, err := s.queue.Cancel(r.PathValue("id"))
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrJobFinished):
+		http.Error(w, "import has already "+job.State, http.StatusConflict)
+	default:
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+// uploadReader returns the CSV in a request: the "file" field of a multipart
+// form, streamed without buffering the whole part, or else the raw body
+func uploadReader(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+	parts, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("invalid multipart body: %w", err)
+	}
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			return nil, errors.New(`multipart body has no "file" field`)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid multipart body: %w", err)
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+// writeUploadError reports a body that could not be read as 413 when it was
+// over the size limit and 400 otherwise
+func writeUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("upload exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// wantsCSV reports whether the client asked for CSV by query or Accept header
+func wantsCSV(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "csv"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/csv")
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// rankDomainCounts orders domain counts as sortDomains does: by count,
+// descending, then alphabetically
+func rankDomainCounts(domainCounts map[string]int) []DomainCount {
+	ranked := make([]DomainCount, 0, len(domainCounts))
+	for domain, count := range domainCounts {
+		ranked = append(ranked, DomainCount{Domain: domain, Count: count})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Count == ranked[j].Count {
+			return ranked[i].Domain < ranked[j].Domain
+		}
+		return ranked[i].Count > ranked[j].Count
+	})
+	return ranked
+}
+
+// newImportID returns a random 16-hex-digit import ID
+func newImportID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
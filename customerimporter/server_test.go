@@ -0,0 +1,188 @@
+package customerimporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const serverTestCSV = "first_name,last_name,email,gender,ip_address\n" +
+	"John,Doe,john@example.com,Male,1.1.1.1\n" +
+	"Jane,Doe,jane@example.com,Female,2.2.2.2\n" +
+	"Bob,Roe,bob@test.org,Male,3.3.3.3\n" +
+	"Bad,Row,not-an-email,Male,4.4.4.4\n"
+
+func newTestImportServer(t *testing.T, config ServerConfig) *httptest.Server {
+	t.Helper()
+	queue := newTestJobQueue(t, t.TempDir(), DefaultJobQueueConfig())
+	server := httptest.NewServer(NewImportServer(config, queue))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// postImport submits body and decodes the returned job
+func postImport(t *testing.T, url, contentType string, body io.Reader) (int, Job) {
+	t.Helper()
+	resp, err := http.Post(url+"/imports", contentType, body)
+	if err != nil {
+		t.Fatalf("POST /imports failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var job Job
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+			t.Fatalf("POST /imports returned invalid JSON: %v", err)
+		}
+		if resp.Header.Get("Location") != "/imports/"+job.ID {
+			t.Errorf("POST /imports Location = %q; want /imports/%s", resp.Header.Get("Location"), job.ID)
+		}
+	}
+	return resp.StatusCode, job
+}
+
+// getImport polls GET /imports/{id} until the job finishes
+func getImport(t *testing.T, url, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(url + "/imports/" + id)
+		if err != nil {
+			t.Fatalf("GET /imports/{id} failed: %v", err)
+		}
+		var job Job
+		json.NewDecoder(resp.Body).Decode(&job)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /imports/{id} = %d; want 200", resp.StatusCode)
+		}
+		if job.Done() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("import %s did not finish", id)
+	return Job{}
+}
+
+func request(t *testing.T, method, url string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestImportServer_RawUpload(t *testing.T) {
+	server := newTestImportServer(t, DefaultServerConfig())
+
+	code, created := postImport(t, server.URL, "text/csv", strings.NewReader(serverTestCSV))
+	if code != http.StatusAccepted || created.State != JobQueued {
+		t.Fatalf("POST /imports = %d %+v; want 202 and a queued job", code, created)
+	}
+	job := getImport(t, server.URL, created.ID)
+	expected := []DomainCount{{"example.com", 2}, {"test.org", 1}}
+	if job.State != JobSucceeded || job.Rows != 3 || len(job.Domains) != 2 || job.Domains[0] != expected[0] || job.Domains[1] != expected[1] {
+		t.Errorf("GET /imports/{id} = %+v; want 3 rows and domains %v", job, expected)
+	}
+
+	resp, err := http.Get(server.URL + "/imports/" + created.ID + "?format=csv")
+	if err != nil {
+		t.Fatalf("GET /imports/{id}?format=csv failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want := "domain,count\nexample.com,2\ntest.org,1\n"; string(body) != want {
+		t.Errorf("GET /imports/{id}?format=csv = %q; want %q", body, want)
+	}
+
+	if resp := request(t, http.MethodDelete, server.URL+"/imports/"+created.ID); resp.StatusCode != http.StatusConflict {
+		t.Errorf("DELETE of a finished import = %d; want 409", resp.StatusCode)
+	}
+}
+
+func TestImportServer_MultipartUpload(t *testing.T) {
+	server := newTestImportServer(t, DefaultServerConfig())
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("note", "ignored")
+	part, _ := form.CreateFormFile("file", "customers.csv")
+	io.WriteString(part, serverTestCSV)
+	form.Close()
+
+	code, created := postImport(t, server.URL, form.FormDataContentType(), &body)
+	if code != http.StatusAccepted {
+		t.Fatalf("POST /imports (multipart) = %d; want 202", code)
+	}
+	if job := getImport(t, server.URL, created.ID); job.Rows != 3 {
+		t.Errorf("multipart import = %+v; want 3 rows", job)
+	}
+
+	body.Reset()
+	form = multipart.NewWriter(&body)
+	form.WriteField("note", "no file")
+	form.Close()
+	if code, _ := postImport(t, server.URL, form.FormDataContentType(), &body); code != http.StatusBadRequest {
+		t.Errorf("POST /imports without a file field = %d; want 400", code)
+	}
+}
+
+func TestImportServer_Errors(t *testing.T) {
+	server := newTestImportServer(t, ServerConfig{MaxUploadBytes: 64})
+
+	if code, _ := postImport(t, server.URL, "text/csv", strings.NewReader(serverTestCSV)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST /imports over the size limit = %d; want 413", code)
+	}
+
+	_, created := postImport(t, server.URL, "text/csv", strings.NewReader("name,phone\nJohn,123\n"))
+	if job := getImport(t, server.URL, created.ID); job.State != JobFailed || job.Error == "" {
+		t.Errorf("import with no valid rows = %+v; want a failed job", job)
+	}
+	if resp := request(t, http.MethodGet, server.URL+"/imports/"+created.ID+"?format=csv"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("GET CSV of a failed import = %d; want 409", resp.StatusCode)
+	}
+	if resp := request(t, http.MethodGet, server.URL+"/imports/unknown"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /imports/unknown = %d; want 404", resp.StatusCode)
+	}
+	if resp := request(t, http.MethodDelete, server.URL+"/imports/unknown"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("DELETE /imports/unknown = %d; want 404", resp.StatusCode)
+	}
+}
+
+func TestImportServer_Health(t *testing.T) {
+	s := NewImportServer(DefaultServerConfig(), newTestJobQueue(t, t.TempDir(), DefaultJobQueueConfig()))
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	tests := []struct {
+		path     string
+		draining bool
+		expected int
+	}{
+		{"/healthz", false, http.StatusOK},
+		{"/readyz", false, http.StatusOK},
+		{"/metrics", false, http.StatusOK},
+		{"/readyz", true, http.StatusServiceUnavailable},
+		{"/healthz", true, http.StatusOK},
+	}
+	for _, test := range tests {
+		s.draining.Store(test.draining)
+		resp, err := http.Get(server.URL + test.path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", test.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.expected {
+			t.Errorf("GET %s (draining %v) = %d; want %d", test.path, test.draining, resp.StatusCode, test.expected)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package customerimporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Layout of snapshot IDs: the UTC time taken, sortable and safe in file names
+const snapshotIDLayout = "20060102T150405.000000Z"
+
+// ErrSnapshotNotFound is returned for a snapshot ID the store does not hold
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot is the domain counts of one run, kept for trend reporting
+type Snapshot struct {
+	ID           string         `json:"id"`
+	Taken        time.Time      `json:"taken"`
+	Input        string         `json:"input,omitempty"`
+	JobID        string         `json:"job_id,omitempty"` // Set for imports run by the serve command
+	Mode         string         `json:"mode,omitempty"`   // Processing mode, e.g. "single-threaded"; "serve" for the serve command
+	Rows         int            `json:"rows"`
+	DomainCounts map[string]int `json:"domain_counts"`
+}
+
+// SnapshotStore keeps snapshots in a directory, one <id>.json file each
+type SnapshotStore struct {
+	dir string
+}
+
+// NewSnapshotStore opens the snapshot store in dir, creating it if needed
+func NewSnapshotStore(dir string) (*SnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating snapshot directory: %w", err)
+	}
+	return &SnapshotStore{dir: dir}, nil
+}
+
+// Save stores snapshot, stamping it with the current time when Taken is unset,
+// and returns it with its ID
+func (s *SnapshotStore) Save(snapshot Snapshot) (Snapshot, error) {
+	if snapshot.Taken.IsZero() {
+		snapshot.Taken = time.Now()
+	}
+	snapshot.Taken = snapshot.Taken.UTC()
+	snapshot.ID = snapshot.Taken.Format(snapshotIDLayout)
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return snapshot, fmt.Errorf("error encoding snapshot %s: %w", snapshot.ID, err)
+	}
+	tmp, err := os.CreateTemp(s.dir, ".snapshot-*")
+	if err != nil {
+		return snapshot, fmt.Errorf("error saving snapshot %s: %w", snapshot.ID, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return snapshot, fmt.Errorf("error saving snapshot %s: %w", snapshot.ID, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return snapshot, fmt.Errorf("error saving snapshot %s: %w", snapshot.ID, err)
+	}
+	if err := os.Rename(tmp.Name(), s.snapshotPath(snapshot.ID)); err != nil {
+		return snapshot, fmt.Errorf("error saving snapshot %s: %w", snapshot.ID, err)
+	}
+	return snapshot, nil
+}
+
+// List returns every stored snapshot, oldest first
+func (s *SnapshotStore) List() ([]Snapshot, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot directory: %w", err)
+	}
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".json" {
+			continue
+		}
+		snapshot, err := s.Get(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Taken.Before(snapshots[j].Taken) })
+	return snapshots, nil
+}
+
+// Get returns the snapshot with id
+func (s *SnapshotStore) Get(id string) (Snapshot, error) {
+	data, err := os.ReadFile(s.snapshotPath(id))
+	if os.IsNotExist(err) {
+		return Snapshot{}, fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+	}
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error reading snapshot %s: %w", id, err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return Snapshot{}, fmt.Errorf("error parsing snapshot %s: %w", id, err)
+	}
+	return snapshot, nil
+}
+
+func (s *SnapshotStore) snapshotPath(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".json")
+}
+
+// Active snapshot store; nil disables snapshots
+var snapshotStore *SnapshotStore
+
+// SetSnapshotStore installs the store every successful run is recorded in;
+// nil disables snapshots
+func SetSnapshotStore(store *SnapshotStore) {
+	snapshotStore = store
+}
+
+// recordSnapshot stores the row counts per domain of a successful run,
+// logging rather than failing the run when the store cannot be written. Rows
+// defaults to the sum of the counts.
+func recordSnapshot(snapshot Snapshot) {
+	if snapshotStore == nil || snapshot.DomainCounts == nil {
+		return
+	}
+	if snapshot.Rows == 0 {
+		snapshot.Rows = countValid(snapshot.DomainCounts)
+	}
+	snapshot, err := snapshotStore.Save(snapshot)
+	if err != nil {
+		logger.Warn("unable to save snapshot", "error", err)
+		return
+	}
+	logger.Info("snapshot saved", "id", snapshot.ID, "domains", len(snapshot.DomainCounts), "dir", snapshotStore.dir)
+}
@@ -0,0 +1,75 @@
+package customerimporter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	store, err := NewSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSnapshotStore() returned an error: %v", err)
+	}
+	later := time.Date(2026, 10, 2, 9, 0, 0, 0, time.UTC)
+	earlier := later.Add(-24 * time.Hour)
+	for _, snapshot := range []Snapshot{
+		{Taken: later, Input: "day2.csv", Rows: 3, DomainCounts: map[string]int{"example.com": 3}},
+		{Taken: earlier, Input: "day1.csv", Rows: 2, DomainCounts: map[string]int{"example.com": 2}},
+	} {
+		if _, err := store.Save(snapshot); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+
+	snapshots, err := store.List()
+	if err != nil {
+		t.Fatalf("List() returned an error: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Input != "day1.csv" || snapshots[1].Input != "day2.csv" {
+		t.Fatalf("List() = %+v; want day1.csv then day2.csv", snapshots)
+	}
+	if snapshots[0].ID != "20261001T090000.000000Z" {
+		t.Errorf("List() ID = %q; want 20261001T090000.000000Z", snapshots[0].ID)
+	}
+
+	snapshot, err := store.Get(snapshots[1].ID)
+	if err != nil || !reflect.DeepEqual(snapshot, snapshots[1]) {
+		t.Errorf("Get(%q) = %+v, %v; want %+v", snapshots[1].ID, snapshot, err, snapshots[1])
+	}
+	if _, err := store.Get("20200101T000000.000000Z"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Get() of an unknown ID = %v; want %v", err, ErrSnapshotNotFound)
+	}
+}
+
+func TestRecordSnapshot(t *testing.T) {
+	store, err := NewSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSnapshotStore() returned an error: %v", err)
+	}
+	SetSnapshotStore(store)
+	t.Cleanup(func() { SetSnapshotStore(nil) })
+
+	// A run without counts is not recorded
+	recordSnapshot(Snapshot{Input: "customers.csv", Mode: "external"})
+	recordSnapshot(Snapshot{Input: "customers.csv", Mode: "single-threaded", DomainCounts: map[string]int{"example.com": 2, "another.com": 1}})
+
+	snapshots, err := store.List()
+	if err != nil {
+		t.Fatalf("List() returned an error: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Input != "customers.csv" || snapshots[0].Mode != "single-threaded" || snapshots[0].Rows != 3 {
+		t.Errorf("recordSnapshot() stored %+v; want one single-threaded snapshot of customers.csv with 3 rows", snapshots)
+	}
+
+	// Approximate runs keep the rows read, as the counts cover the top domains only
+	recordSnapshot(Snapshot{Input: "customers.csv", Mode: "approximate", Rows: 10, DomainCounts: map[string]int{"example.com": 6}})
+	snapshots, err = store.List()
+	if err != nil {
+		t.Fatalf("List() returned an error: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[1].Mode != "approximate" || snapshots[1].Rows != 10 {
+		t.Errorf("recordSnapshot() stored %+v; want an approximate snapshot with 10 rows", snapshots)
+	}
+}
@@ -0,0 +1,199 @@
+package customerimporter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Source yields customer records one at a time. Next returns io.EOF once the
+// input is exhausted and a *RowError for a malformed row, after which reading
+// continues with the next row.
+type Source interface {
+	Next() (Record, error)
+}
+
+// trackedSource is a Source reading through a sourceInput, whose bytes
+// ProcessSource reports as progress
+type trackedSource interface {
+	progressInput() *sourceInput
+}
+
+// sourceLine returns the line or row number of the record last read from
+// sources that track one, such as *XLSXSource, and n otherwise
+func sourceLine(src Source, n int) int {
+	if lined, ok := src.(interface{ Line() int }); ok {
+		return lined.Line()
+	}
+	return n
+}
+
+// columnMap holds the position of each Record field within a row (-1 if absent)
+type columnMap struct {
+	FirstName int
+	LastName  int
+	Email     int
+	Gender    int
+	IPAddress int
+}
+
+// Header aliases, compared after lowercasing and stripping non-alphanumerics
+var headerAliases = map[string]string{
+	"firstname":    "FirstName",
+	"first":        "FirstName",
+	"givenname":    "FirstName",
+	"lastname":     "LastName",
+	"last":         "LastName",
+	"surname":      "LastName",
+	"familyname":   "LastName",
+	"email":        "Email",
+	"emailaddress": "Email",
+	"mail":         "Email",
+	"gender":       "Gender",
+	"sex":          "Gender",
+	"ipaddress":    "IPAddress",
+	"ip":           "IPAddress",
+}
+
+// mapHeader resolves header cells to Record fields; an email column is required
+func mapHeader(header []string) (columnMap, error) {
+	cols := columnMap{-1, -1, -1, -1, -1}
+	for i, cell := range header {
+		field := headerAliases[normaliseHeader(cell)]
+		target := cols.field(field)
+		if target != nil && *target == -1 {
+			*target = i
+		}
+	}
+	if cols.Email == -1 {
+		return cols, fmt.Errorf("%w: %v", ErrNoEmailColumn, header)
+	}
+	return cols, nil
+}
+
+func (c *columnMap) field(name string) *int {
+	switch name {
+	case "FirstName":
+		return &c.FirstName
+	case "LastName":
+		return &c.LastName
+	case "Email":
+		return &c.Email
+	case "Gender":
+		return &c.Gender
+	case "IPAddress":
+		return &c.IPAddress
+	}
+	return nil
+}
+
+func normaliseHeader(cell string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(cell) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// recordFromRow builds a Record from a row using the resolved column positions
+func recordFromRow(cols columnMap, row []string) (Record, error) {
+	if cols.Email >= len(row) || strings.TrimSpace(row[cols.Email]) == "" {
+		return Record{}, fmt.Errorf("missing email in row: %v", row)
+	}
+	cell := func(i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+		return row[i]
+	}
+	return Record{
+		FirstName: cell(cols.FirstName),
+		LastName:  cell(cols.LastName),
+		Email:     cell(cols.Email),
+		Gender:    cell(cols.Gender),
+		IPAddress: cell(cols.IPAddress),
+	}, nil
+}
+
+// ProcessSource streams records from any Source into per-domain counts
+func ProcessSource(src Source) (map[string]int, error) {
+	run := NewRun(RunConfig{})
+	defer run.LogSkipSummary()
+	return run.ProcessSource(src)
+}
+
+// ProcessSource is the package-level ProcessSource under the run's settings
+func (r *Run) ProcessSource(src Source) (map[string]int, error) {
+	domainCounts := make(map[string]int)
+	chunk := make([]Record, 0, ChunkSize)
+	flush := func() {
+		for domain, count := range r.countEmailDomains(chunk) {
+			domainCounts[domain] += count
+		}
+		chunk = chunk[:0]
+	}
+
+	var input *sourceInput
+	if tracked, ok := src.(trackedSource); ok {
+		input = tracked.progressInput()
+	}
+	progress := r.startProgress(input.Size())
+	defer progress.Stop()
+	input.Track(progress)
+
+	name := fileName(src)
+	rows := 0
+	for n := 1; ; n++ {
+		record, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		progress.Row()
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			rows++
+			r.rowRead()
+			if r.config.Strict {
+				rowErr.File = name
+				return nil, rowErr
+			}
+			r.logSkip(reasonFieldCount, "line", rowErr.Line, "error", rowErr.Err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading source: %w", err)
+		}
+		rows++
+		r.rowRead()
+		line := sourceLine(src, n)
+		if !emailRegex.MatchString(record.Email) {
+			if err := r.strictRowError(name, line, []string{"email"}, 0, record.Email, "invalid email"); err != nil {
+				return nil, err
+			}
+			r.logSkip(reasonInvalidEmail, "line", line, "email", record.Email)
+			continue
+		}
+		if rule, ok := r.checkRecord(record); !ok {
+			if err := r.strictRuleError(name, line, rule, record); err != nil {
+				return nil, err
+			}
+			r.logSkip(reasonRule+":"+rule, "line", line, "email", record.Email)
+			continue
+		}
+		chunk = append(chunk, record)
+		if len(chunk) >= ChunkSize {
+			flush()
+		}
+	}
+	flush()
+
+	valid := countValid(domainCounts)
+	if err := r.checkStreamingCounts(valid, rows-valid); err != nil {
+		return nil, err
+	}
+	return domainCounts, nil
+}
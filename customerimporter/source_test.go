@@ -0,0 +1,90 @@
+package customerimporter
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+// sliceSource is an in-memory Source used by tests
+type sliceSource struct {
+	records []Record
+}
+
+func (s *sliceSource) Next() (Record, error) {
+	if len(s.records) == 0 {
+		return Record{}, io.EOF
+	}
+	record := s.records[0]
+	s.records = s.records[1:]
+	return record, nil
+}
+
+func TestMapHeader(t *testing.T) {
+	tests := []struct {
+		header   []string
+		expected columnMap
+		wantErr  bool
+	}{
+		{[]string{"first_name", "last_name", "email", "gender", "ip_address"}, columnMap{0, 1, 2, 3, 4}, false},
+		{[]string{"Email Address", "First Name", "Surname"}, columnMap{1, 2, 0, -1, -1}, false},
+		{[]string{"IP", "Sex", "EMAIL"}, columnMap{-1, -1, 2, 1, 0}, false},
+		{[]string{"first_name", "last_name"}, columnMap{}, true}, // No email column
+	}
+
+	for _, test := range tests {
+		result, err := mapHeader(test.header)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("mapHeader(%v) did not return an error", test.header)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("mapHeader(%v) returned an error: %v", test.header, err)
+		}
+		if result != test.expected {
+			t.Errorf("mapHeader(%v) = %v; want %v", test.header, result, test.expected)
+		}
+	}
+}
+
+func TestRecordFromRow(t *testing.T) {
+	cols := columnMap{FirstName: 1, LastName: -1, Email: 0, Gender: -1, IPAddress: 5}
+
+	record, err := recordFromRow(cols, []string{"john@example.com", "John"})
+	if err != nil {
+		t.Errorf("recordFromRow() returned an error: %v", err)
+	}
+	expected := Record{FirstName: "John", Email: "john@example.com"}
+	if record != expected {
+		t.Errorf("recordFromRow() = %v; want %v", record, expected)
+	}
+
+	// A row without an email value is malformed
+	if _, err := recordFromRow(cols, []string{"", "John"}); err == nil {
+		t.Errorf("recordFromRow() did not return an error for a missing email")
+	}
+}
+
+func TestProcessSource(t *testing.T) {
+	src := &sliceSource{records: []Record{
+		{Email: "user1@example.com"},
+		{Email: "user2@example.com"},
+		{Email: "user3@another.com"},
+		{Email: "invalid-email"}, // Invalid email should be ignored
+	}}
+
+	result, err := ProcessSource(src)
+	if err != nil {
+		t.Errorf("ProcessSource() returned an error: %v", err)
+	}
+
+	expected := map[string]int{
+		"example.com": 2,
+		"another.com": 1,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("ProcessSource() = %v; want %v", result, expected)
+	}
+}
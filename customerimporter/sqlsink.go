@@ -0,0 +1,313 @@
+package customerimporter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SQLiteDriver is the database/sql driver name the CLI opens databases with.
+// Programs register it by importing modernc.org/sqlite, as main does.
+const SQLiteDriver = "sqlite"
+
+// Largest batch size: looking up a batch binds one variable per record, and
+// SQLite builds before 3.32 allow at most 999 variables per statement
+const maxSQLBatchSize = 999
+
+// Table names must be plain identifiers, as they cannot be query parameters
+var tableNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// customerMigrations create and evolve the customers table, in order. The
+// table name replaces each %[1]s. Applied migrations are recorded in the
+// <table>_schema table, so only new ones run.
+var customerMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS %[1]s (
+		email TEXT PRIMARY KEY,
+		email_address TEXT NOT NULL,
+		first_name TEXT NOT NULL,
+		last_name TEXT NOT NULL,
+		gender TEXT NOT NULL,
+		ip_address TEXT NOT NULL,
+		domain TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS %[1]s_domain ON %[1]s (domain)`,
+}
+
+// SQLSinkConfig configures loading customers into a database
+type SQLSinkConfig struct {
+	Table     string
+	BatchSize int // Records upserted per transaction, at most 999
+}
+
+// DefaultSQLSinkConfig returns the settings used by the CLI
+func DefaultSQLSinkConfig() SQLSinkConfig {
+	return SQLSinkConfig{Table: "customers", BatchSize: 500}
+}
+
+func (c SQLSinkConfig) validate() error {
+	if !tableNameRegex.MatchString(c.Table) {
+		return fmt.Errorf("invalid table name %q", c.Table)
+	}
+	if c.BatchSize <= 0 || c.BatchSize > maxSQLBatchSize {
+		return fmt.Errorf("batch size must be between 1 and %d, got %d", maxSQLBatchSize, c.BatchSize)
+	}
+	return nil
+}
+
+// LoadResult counts what loading did to the customers table
+type LoadResult struct {
+	DomainCounts map[string]int
+	Rows         int // Valid rows loaded
+	Skipped      int // Rows skipped as invalid
+	Inserted     int // New customers
+	Updated      int // Existing customers whose fields changed
+	Unchanged    int // Existing customers loaded again as they were
+}
+
+// SQLSink batch-upserts customer records keyed on normalised email. Each
+// batch is one transaction, so a failed load keeps the batches before it;
+// loading the same input again is safe and only counts them as unchanged.
+// Queries use SQLite syntax with ? placeholders.
+type SQLSink struct {
+	db      *sql.DB
+	config  SQLSinkConfig
+	batch   []sinkRecord
+	pending map[string]bool // Normalised emails in batch
+	result  LoadResult
+}
+
+// sinkRecord is one record waiting in a batch
+type sinkRecord struct {
+	key, domain, fingerprint string
+	record                   Record
+}
+
+// NewSQLSink returns a sink writing to db, creating or migrating its table
+func NewSQLSink(ctx context.Context, db *sql.DB, config SQLSinkConfig) (*SQLSink, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	s := &SQLSink{db: db, config: config, pending: make(map[string]bool)}
+	if err := s.migrate(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate applies the customer migrations the table does not have yet
+func (s *SQLSink) migrate(ctx context.Context) error {
+	schema := s.config.Table + "_schema"
+	if _, err := s.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+schema+" (version INTEGER NOT NULL)"); err != nil {
+		return fmt.Errorf("error creating schema table: %w", err)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error migrating %s: %w", s.config.Table, err)
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM "+schema).Scan(&version); err != nil {
+		return fmt.Errorf("error reading schema version: %w", err)
+	}
+	for i := version; i < len(customerMigrations); i++ {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(customerMigrations[i], s.config.Table)); err != nil {
+			return fmt.Errorf("error applying migration %d to %s: %w", i+1, s.config.Table, err)
+		}
+	}
+	if version < len(customerMigrations) {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO "+schema+" (version) VALUES (?)", len(customerMigrations)); err != nil {
+			return fmt.Errorf("error recording schema version: %w", err)
+		}
+		logger.Info("customer table migrated", "table", s.config.Table, "from", version, "to", len(customerMigrations))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error migrating %s: %w", s.config.Table, err)
+	}
+	return nil
+}
+
+// Add queues record for upserting under domain, writing a batch once full.
+// A second row for an email already in the batch writes the batch first, so
+// every row counts once as inserted, updated or unchanged. Emails are
+// normalised under the default provider rules.
+func (s *SQLSink) Add(ctx context.Context, domain string, record Record) error {
+	return s.add(ctx, normaliseEmail(record.Email), domain, record)
+}
+
+// add is Add with the customer's email already normalised into key
+func (s *SQLSink) add(ctx context.Context, key, domain string, record Record) error {
+	if s.pending[key] {
+		if err := s.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	s.pending[key] = true
+	s.batch = append(s.batch, sinkRecord{key: key, domain: domain, fingerprint: fingerprintRecord(record), record: record})
+	if len(s.batch) >= s.config.BatchSize {
+		return s.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush upserts the queued records in one transaction
+func (s *SQLSink) Flush(ctx context.Context) error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting batch: %w", err)
+	}
+	defer tx.Rollback()
+
+	existing, err := s.fingerprints(ctx, tx)
+	if err != nil {
+		return err
+	}
+	upsert, err := tx.PrepareContext(ctx, s.upsertQuery())
+	if err != nil {
+		return fmt.Errorf("error preparing upsert: %w", err)
+	}
+	defer upsert.Close()
+
+	var inserted, updated, unchanged int
+	now := time.Now().UTC()
+	for _, r := range s.batch {
+		fingerprint, found := existing[r.key]
+		switch {
+		case !found:
+			inserted++
+		case fingerprint != r.fingerprint:
+			updated++
+		default:
+			unchanged++
+			continue
+		}
+		_, err := upsert.ExecContext(ctx, r.key, r.record.Email, r.record.FirstName, r.record.LastName, r.record.Gender, r.record.IPAddress, r.domain, r.fingerprint, now, now)
+		if err != nil {
+			return fmt.Errorf("error upserting %s: %w", r.key, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing batch: %w", err)
+	}
+
+	s.result.Inserted += inserted
+	s.result.Updated += updated
+	s.result.Unchanged += unchanged
+	s.batch = s.batch[:0]
+	clear(s.pending)
+	return nil
+}
+
+// fingerprints returns the stored fingerprints of the batch's emails
+func (s *SQLSink) fingerprints(ctx context.Context, tx *sql.Tx) (map[string]string, error) {
+	placeholders := make([]string, len(s.batch))
+	args := make([]any, len(s.batch))
+	for i, r := range s.batch {
+		placeholders[i] = "?"
+		args[i] = r.key
+	}
+	query := fmt.Sprintf("SELECT email, fingerprint FROM %s WHERE email IN (%s)", s.config.Table, strings.Join(placeholders, ", "))
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading existing customers: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]string, len(s.batch))
+	for rows.Next() {
+		var email, fingerprint string
+		if err := rows.Scan(&email, &fingerprint); err != nil {
+			return nil, fmt.Errorf("error reading existing customers: %w", err)
+		}
+		existing[email] = fingerprint
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading existing customers: %w", err)
+	}
+	return existing, nil
+}
+
+// upsertQuery inserts a customer or, when the email exists, replaces every
+// field but created_at
+func (s *SQLSink) upsertQuery() string {
+	columns := []string{"email", "email_address", "first_name", "last_name", "gender", "ip_address", "domain", "fingerprint", "created_at", "updated_at"}
+	placeholders := make([]string, len(columns))
+	var updates []string
+	for i, column := range columns {
+		placeholders[i] = "?"
+		if column != "email" && column != "created_at" {
+			updates = append(updates, column+" = excluded."+column)
+		}
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (email) DO UPDATE SET %s",
+		s.config.Table, strings.Join(columns, ", "), strings.Join(placeholders, ", "), strings.Join(updates, ", "))
+}
+
+// Result returns what the sink has written so far
+func (s *SQLSink) Result() LoadResult {
+	return s.result
+}
+
+// LoadCustomers streams CSV rows from input into sink, counting domains on
+// the way, and writes the last batch. Rows are validated as in every other
+// mode; a database error stops reading. The streaming record-count policy is
+// checked once every batch is written, as rows cannot be loaded twice.
+func LoadCustomers(ctx context.Context, input io.Reader, sink *SQLSink) (LoadResult, error) {
+	run := NewRun(RunConfig{})
+	defer run.LogSkipSummary()
+	return run.LoadCustomers(ctx, input, sink)
+}
+
+// LoadCustomers is the package-level LoadCustomers under the run's settings,
+// with emails normalised by the run's provider rules
+func (r *Run) LoadCustomers(ctx context.Context, input io.Reader, sink *SQLSink) (LoadResult, error) {
+	span := r.config.Tracer.startSpan("customerimporter.LoadCustomers")
+	defer span.End()
+	// Cancelling reading is how a database error stops streamCSVDomains
+	reading, stop := context.WithCancel(ctx)
+	defer stop()
+
+	domainCounts := make(map[string]int)
+	var sinkErr error
+	processed, skipped, err := r.streamCSVDomains(contextReader{ctx: reading, r: input}, func(rowNumber int, domain string, record Record) {
+		if sinkErr != nil {
+			return
+		}
+		if sinkErr = sink.add(ctx, r.providers.normaliseEmail(record.Email), domain, record); sinkErr != nil {
+			stop()
+			return
+		}
+		domainCounts[domain]++
+	})
+	if sinkErr != nil {
+		err = sinkErr
+	}
+	if err == nil {
+		err = sink.Flush(ctx)
+	}
+	span.SetAttr("rows", processed)
+	span.SetAttr("skipped", skipped)
+	if err != nil {
+		span.SetError(err)
+		return LoadResult{}, fmt.Errorf("error loading customers: %w", err)
+	}
+	if err := r.checkReaderCounts(processed, skipped); err != nil {
+		span.SetError(err)
+		return LoadResult{}, err
+	}
+
+	result := sink.Result()
+	result.DomainCounts, result.Rows, result.Skipped = domainCounts, processed, skipped
+	logger.Info("customers loaded", "inserted", result.Inserted, "updated", result.Updated, "unchanged", result.Unchanged, "skipped", skipped)
+	return result, nil
+}
@@ -0,0 +1,167 @@
+package customerimporter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	// Registers the "sqlite" driver the tests open databases with
+	_ "modernc.org/sqlite"
+)
+
+// openTestDatabase returns an SQLite database in a temporary file
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(SQLiteDriver, filepath.Join(t.TempDir(), "customers.db"))
+	if err != nil {
+		t.Fatalf("unable to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newTestSink(t *testing.T, db *sql.DB, batchSize int) *SQLSink {
+	t.Helper()
+	config := DefaultSQLSinkConfig()
+	config.BatchSize = batchSize
+	sink, err := NewSQLSink(context.Background(), db, config)
+	if err != nil {
+		t.Fatalf("NewSQLSink() returned an error: %v", err)
+	}
+	return sink
+}
+
+func TestLoadCustomers(t *testing.T) {
+	db := openTestDatabase(t)
+	first, err := LoadCustomers(context.Background(), strings.NewReader(incrementalDayOne), newTestSink(t, db, 2))
+	if err != nil {
+		t.Fatalf("LoadCustomers() returned an error: %v", err)
+	}
+	if first.Inserted != 3 || first.Updated != 0 || first.Unchanged != 0 || first.Rows != 3 || first.Skipped != 1 {
+		t.Errorf("LoadCustomers() first load = %+v; want 3 inserted and 1 skipped", first)
+	}
+	var created time.Time
+	if err := db.QueryRow("SELECT created_at FROM customers WHERE email = ?", "jane@example.com").Scan(&created); err != nil {
+		t.Fatalf("unable to read jane@example.com: %v", err)
+	}
+
+	second, err := LoadCustomers(context.Background(), strings.NewReader(incrementalDayTwo), newTestSink(t, db, 2))
+	if err != nil {
+		t.Fatalf("LoadCustomers() returned an error: %v", err)
+	}
+	// John's email differs only in case, which is still a change to the stored row
+	if second.Inserted != 2 || second.Updated != 2 || second.Unchanged != 0 {
+		t.Errorf("LoadCustomers() second load = %+v; want 2 inserted and 2 updated", second)
+	}
+	expectedCounts := map[string]int{"example.com": 3, "third.org": 1}
+	if !reflect.DeepEqual(second.DomainCounts, expectedCounts) {
+		t.Errorf("LoadCustomers() DomainCounts = %v; want %v", second.DomainCounts, expectedCounts)
+	}
+
+	var ip string
+	var recreated time.Time
+	if err := db.QueryRow("SELECT ip_address, created_at FROM customers WHERE email = ?", "jane@example.com").Scan(&ip, &recreated); err != nil {
+		t.Fatalf("unable to read jane@example.com: %v", err)
+	}
+	if ip != "9.9.9.9" || !recreated.Equal(created) {
+		t.Errorf("jane@example.com = %s, created %v; want 9.9.9.9, created %v", ip, recreated, created)
+	}
+	var customers int
+	db.QueryRow("SELECT COUNT(*) FROM customers").Scan(&customers)
+	if customers != 5 {
+		t.Errorf("customers table has %d rows; want 5", customers)
+	}
+
+	third, err := LoadCustomers(context.Background(), strings.NewReader(incrementalDayTwo), newTestSink(t, db, 500))
+	if err != nil || third.Inserted != 0 || third.Updated != 0 || third.Unchanged != 4 {
+		t.Errorf("LoadCustomers() reload = %+v, %v; want 4 unchanged", third, err)
+	}
+}
+
+func TestLoadCustomers_DuplicateEmails(t *testing.T) {
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n" +
+		"John,Doe,John@Example.com,Male,1.1.1.1\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n"
+	result, err := LoadCustomers(context.Background(), strings.NewReader(data), newTestSink(t, openTestDatabase(t), 500))
+	if err != nil {
+		t.Fatalf("LoadCustomers() returned an error: %v", err)
+	}
+	if result.Inserted != 1 || result.Updated != 2 || result.Unchanged != 0 {
+		t.Errorf("LoadCustomers() = %+v; want 1 inserted and 2 updated", result)
+	}
+}
+
+func TestLoadCustomers_DatabaseError(t *testing.T) {
+	db := openTestDatabase(t)
+	sink := newTestSink(t, db, 1)
+	db.Close()
+	if _, err := LoadCustomers(context.Background(), strings.NewReader(incrementalDayOne), sink); err == nil {
+		t.Errorf("LoadCustomers() with a closed database did not return an error")
+	}
+}
+
+func TestNewSQLSink_Migrations(t *testing.T) {
+	db := openTestDatabase(t)
+	newTestSink(t, db, 500)
+	newTestSink(t, db, 500)
+
+	var versions, version int
+	if err := db.QueryRow("SELECT COUNT(*), MAX(version) FROM customers_schema").Scan(&versions, &version); err != nil {
+		t.Fatalf("unable to read schema versions: %v", err)
+	}
+	if versions != 1 || version != len(customerMigrations) {
+		t.Errorf("customers_schema = %d rows, version %d; want 1 row, version %d", versions, version, len(customerMigrations))
+	}
+
+	for _, config := range []SQLSinkConfig{
+		{Table: "customers; DROP TABLE customers", BatchSize: 500},
+		{Table: "customers", BatchSize: 0},
+		{Table: "customers", BatchSize: maxSQLBatchSize + 1},
+	} {
+		if _, err := NewSQLSink(context.Background(), db, config); err == nil {
+			t.Errorf("NewSQLSink() with %+v did not return an error", config)
+		}
+	}
+}
+
+func TestSQLSink_UpsertQuery(t *testing.T) {
+	expected := "VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (email) DO UPDATE SET email_address = excluded.email_address"
+	sink := &SQLSink{config: SQLSinkConfig{Table: "customers"}}
+	query := sink.upsertQuery()
+	if !strings.Contains(query, expected) || strings.Contains(query, "created_at = excluded") {
+		t.Errorf("upsertQuery() = %q; want it to contain %q and keep created_at", query, expected)
+	}
+}
+
+func TestLoadCustomers_LargestBatch(t *testing.T) {
+	var data strings.Builder
+	data.WriteString("first_name,last_name,email,gender,ip_address\n")
+	for i := 0; i < maxSQLBatchSize; i++ {
+		fmt.Fprintf(&data, "User,%d,user%d@example.com,Female,1.1.1.1\n", i, i)
+	}
+	db := openTestDatabase(t)
+	for _, want := range []LoadResult{{Inserted: maxSQLBatchSize}, {Unchanged: maxSQLBatchSize}} {
+		result, err := LoadCustomers(context.Background(), strings.NewReader(data.String()), newTestSink(t, db, maxSQLBatchSize))
+		if err != nil {
+			t.Fatalf("LoadCustomers() returned an error: %v", err)
+		}
+		if result.Inserted != want.Inserted || result.Unchanged != want.Unchanged {
+			t.Errorf("LoadCustomers() = %+v; want %+v", result, want)
+		}
+	}
+}
+
+func TestLoadCustomers_RecordCountPolicy(t *testing.T) {
+	run := NewRun(RunConfig{CountPolicy: &RecordCountPolicy{MinRecords: 10, Action: PolicyFail}})
+	_, err := run.LoadCustomers(context.Background(), strings.NewReader(incrementalDayOne), newTestSink(t, openTestDatabase(t), 500))
+	if !errors.Is(err, ErrTooFewRecords) {
+		t.Errorf("LoadCustomers() error = %v; want ErrTooFewRecords", err)
+	}
+}
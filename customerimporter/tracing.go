@@ -0,0 +1,380 @@
+package customerimporter
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Spans buffered by a Tracer before they are exported
+const spanBatchSize = 512
+
+// SpanData is a finished span as handed to exporters
+type SpanData struct {
+	Name         string
+	TraceID      string // 32 hex digits
+	SpanID       string // 16 hex digits
+	ParentSpanID string // Empty for a root span
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	Error        string // Set when the stage failed
+}
+
+// SpanExporter sends finished spans to a backend. ExportSpans may be called
+// from several goroutines at once.
+type SpanExporter interface {
+	ExportSpans(spans []SpanData) error
+}
+
+// Tracer batches finished spans and hands them to an exporter
+type Tracer struct {
+	exporter  SpanExporter
+	mu        sync.Mutex
+	pending   []SpanData
+	err       error          // First export error, reported by Flush
+	exporting sync.WaitGroup // Batches handed to the exporter and not yet sent
+}
+
+// NewTracer returns a tracer that exports through exporter
+func NewTracer(exporter SpanExporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// record buffers span, exporting the buffer once it holds a full batch. The
+// export runs outside the lock, so a slow exporter only delays the span that
+// filled the batch, not every other goroutine ending one.
+func (t *Tracer) record(span SpanData) {
+	t.mu.Lock()
+	t.pending = append(t.pending, span)
+	if len(t.pending) < spanBatchSize {
+		t.mu.Unlock()
+		return
+	}
+	batch := t.takeLocked()
+	t.mu.Unlock()
+	t.export(batch)
+}
+
+// takeLocked removes the buffered spans for export
+func (t *Tracer) takeLocked() []SpanData {
+	batch := t.pending
+	t.pending = nil
+	if len(batch) > 0 {
+		t.exporting.Add(1)
+	}
+	return batch
+}
+
+// export sends a batch taken by takeLocked, keeping the first error
+func (t *Tracer) export(batch []SpanData) {
+	if len(batch) == 0 {
+		return
+	}
+	defer t.exporting.Done()
+	if err := t.exporter.ExportSpans(batch); err != nil {
+		t.mu.Lock()
+		if t.err == nil {
+			t.err = err
+		}
+		t.mu.Unlock()
+	}
+}
+
+// Flush exports any buffered spans, waits for batches already being exported
+// and returns the first export error, if any
+func (t *Tracer) Flush() error {
+	t.mu.Lock()
+	batch := t.takeLocked()
+	t.mu.Unlock()
+	t.export(batch)
+	t.exporting.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.err
+	t.err = nil
+	return err
+}
+
+// Span times one pipeline stage. A nil *Span is valid and does nothing, so
+// instrumented code needs no checks when tracing is off.
+type Span struct {
+	tracer   *Tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	start    time.Time
+	attrs    map[string]interface{}
+	err      error
+}
+
+// startSpan begins a root span, or returns nil when t is nil
+func (t *Tracer) startSpan(name string) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{tracer: t, name: name, start: time.Now()}
+	rand.Read(s.traceID[:])
+	rand.Read(s.spanID[:])
+	return s
+}
+
+// Child begins a span nested under s
+func (s *Span) Child(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	child := &Span{tracer: s.tracer, traceID: s.traceID, parentID: s.spanID, name: name, start: time.Now()}
+	rand.Read(child.spanID[:])
+	return child
+}
+
+// SetAttr records a string, bool, integer or float attribute
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+}
+
+// SetError marks the stage as failed
+func (s *Span) SetError(err error) {
+	if s == nil {
+		return
+	}
+	s.err = err
+}
+
+// End finishes the span and queues it for export
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	data := SpanData{
+		Name:       s.name,
+		TraceID:    hex.EncodeToString(s.traceID[:]),
+		SpanID:     hex.EncodeToString(s.spanID[:]),
+		Start:      s.start,
+		End:        time.Now(),
+		Attributes: s.attrs,
+	}
+	if s.parentID != [8]byte{} {
+		data.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	if s.err != nil {
+		data.Error = s.err.Error()
+	}
+	s.tracer.record(data)
+}
+
+// stageTimer accumulates the time spent in a stage that is interleaved with
+// others row by row, such as validation inside chunk processing. It does
+// nothing when its span is nil.
+type stageTimer struct {
+	enabled bool
+	total   time.Duration
+	start   time.Time
+}
+
+func newStageTimer(span *Span) stageTimer {
+	return stageTimer{enabled: span != nil}
+}
+
+func (t *stageTimer) Start() {
+	if t.enabled {
+		t.start = time.Now()
+	}
+}
+
+func (t *stageTimer) Stop() {
+	if t.enabled {
+		t.total += time.Since(t.start)
+	}
+}
+
+// Record stores the accumulated time on span as "<stage>.seconds"
+func (t *stageTimer) Record(span *Span, stage string) {
+	span.SetAttr(stage+".seconds", t.total.Seconds())
+}
+
+// OTLP/JSON encoding of ExportTraceServiceRequest
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"` // 0 unset, 2 error
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"` // int64 is a string in OTLP/JSON
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// Internal span kind in OTLP
+const otlpSpanKindInternal = 1
+
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		var v otlpValue
+		switch value := attrs[key].(type) {
+		case bool:
+			v.BoolValue = &value
+		case int:
+			s := strconv.Itoa(value)
+			v.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(value, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &value
+		case string:
+			v.StringValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		result = append(result, otlpKeyValue{Key: key, Value: v})
+	}
+	return result
+}
+
+// encodeOTLP builds the OTLP/JSON request body for spans
+func encodeOTLP(spans []SpanData) ([]byte, error) {
+	service := "customerimporter"
+	encoded := make([]otlpSpan, len(spans))
+	for i, span := range spans {
+		encoded[i] = otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+		}
+		if span.Error != "" {
+			encoded[i].Status = otlpStatus{Code: 2, Message: span.Error}
+		}
+	}
+	return json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			{Key: "service.name", Value: otlpValue{StringValue: &service}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "customerimporter"}, Spans: encoded}},
+	}}})
+}
+
+// FileExporter appends each batch as one line of OTLP/JSON, the format read
+// by the OpenTelemetry Collector's file receiver
+type FileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileExporter creates or truncates the trace file
+func NewFileExporter(fileName string) (*FileExporter, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace file: %w", err)
+	}
+	return &FileExporter{file: file}, nil
+}
+
+func (e *FileExporter) ExportSpans(spans []SpanData) error {
+	data, err := encodeOTLP(spans)
+	if err != nil {
+		return fmt.Errorf("error encoding spans: %w", err)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing trace file: %w", err)
+	}
+	return nil
+}
+
+// Close closes the trace file
+func (e *FileExporter) Close() error {
+	return e.file.Close()
+}
+
+// HTTPExporter posts OTLP/JSON to a collector's traces endpoint, such as
+// http://localhost:4318/v1/traces
+type HTTPExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewHTTPExporter returns an exporter posting to endpoint
+func NewHTTPExporter(endpoint string) *HTTPExporter {
+	return &HTTPExporter{endpoint: endpoint, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (e *HTTPExporter) ExportSpans(spans []SpanData) error {
+	data, err := encodeOTLP(spans)
+	if err != nil {
+		return fmt.Errorf("error encoding spans: %w", err)
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error sending spans: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("error sending spans: collector returned %s", resp.Status)
+	}
+	return nil
+}
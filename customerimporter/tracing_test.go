@@ -0,0 +1,253 @@
+package customerimporter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryExporter keeps exported spans for inspection
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *memoryExporter) ExportSpans(spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func spanNames(spans []SpanData) []string {
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+const traceTestData = "first_name,last_name,email,gender,ip_address\n" +
+	"John,Doe,john@example.com,Male,1.1.1.1\n" +
+	"Jane,Doe,jane@example.com,Female,2.2.2.2\n" +
+	"Bad,Row,not-an-email,Male,3.3.3.3\n"
+
+func TestTracing_Process(t *testing.T) {
+	exporter := &memoryExporter{}
+	tr := NewTracer(exporter)
+	run := NewRun(RunConfig{Tracer: tr, CountPolicy: &RecordCountPolicy{Action: PolicyFail}})
+
+	input := writeStrictTestFile(t, traceTestData)
+	output := filepath.Join(t.TempDir(), "output.txt")
+	if _, err := run.Process(input.Name(), output); err != nil {
+		t.Fatalf("Process() returned an error: %v", err)
+	}
+	if err := tr.Flush(); err != nil {
+		t.Fatalf("Flush() returned an error: %v", err)
+	}
+
+	expected := []string{"count_domains", "customerimporter.Process", "read_csv", "sort_domains", "write_output"}
+	if names := spanNames(exporter.spans); strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Process() spans = %v; want %v", names, expected)
+	}
+	var root SpanData
+	for _, span := range exporter.spans {
+		if span.ParentSpanID == "" {
+			root = span
+		}
+	}
+	for _, span := range exporter.spans {
+		if span.TraceID != root.TraceID || (span.Name != root.Name && span.ParentSpanID != root.SpanID) {
+			t.Errorf("span %s is not a child of %s in the same trace", span.Name, root.Name)
+		}
+		if span.End.Before(span.Start) {
+			t.Errorf("span %s ends before it starts", span.Name)
+		}
+		if span.Name == "read_csv" && (span.Attributes["rows"] != 2 || span.Attributes["skipped"] != 1 || span.Attributes["validate.seconds"] == nil) {
+			t.Errorf("read_csv attributes = %v; want 2 rows, 1 skipped and validation time", span.Attributes)
+		}
+	}
+}
+
+func TestTracing_StreamingChunks(t *testing.T) {
+	exporter := &memoryExporter{}
+	tr := NewTracer(exporter)
+
+	if _, err := NewRun(RunConfig{Tracer: tr}).ProcessWithConcurrentStreaming(writeStrictTestFile(t, traceTestData)); err != nil {
+		t.Fatalf("ProcessWithConcurrentStreaming() returned an error: %v", err)
+	}
+	tr.Flush()
+
+	expected := []string{"aggregate", "chunk", "customerimporter.ProcessWithConcurrentStreaming", "read_csv"}
+	if names := spanNames(exporter.spans); strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("ProcessWithConcurrentStreaming() spans = %v; want %v", names, expected)
+	}
+	for _, span := range exporter.spans {
+		if span.Name != "chunk" {
+			continue
+		}
+		if span.Attributes["rows"] != 3 || span.Attributes["valid"] != 2 {
+			t.Errorf("chunk attributes = %v; want 3 rows, 2 valid", span.Attributes)
+		}
+		if _, ok := span.Attributes["extract_domain.seconds"].(float64); !ok {
+			t.Errorf("chunk attributes = %v; want extract_domain.seconds", span.Attributes)
+		}
+	}
+}
+
+func TestTracing_Disabled(t *testing.T) {
+	var span *Span
+	child := span.Child("stage")
+	child.SetAttr("rows", 1)
+	child.SetError(errors.New("failed"))
+	child.End()
+	var tr *Tracer
+	if tr.startSpan("root") != nil {
+		t.Errorf("startSpan() returned a span from a nil tracer")
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	traceFile := filepath.Join(t.TempDir(), "trace.jsonl")
+	exporter, err := NewFileExporter(traceFile)
+	if err != nil {
+		t.Fatalf("NewFileExporter() returned an error: %v", err)
+	}
+	tr := NewTracer(exporter)
+
+	root := tr.startSpan("root")
+	child := root.Child("stage")
+	child.SetAttr("rows", 42)
+	child.SetAttr("ratio", 0.5)
+	child.SetAttr("name", "x")
+	child.SetError(errors.New("bad input"))
+	child.End()
+	root.End()
+	if err := tr.Flush(); err != nil {
+		t.Fatalf("Flush() returned an error: %v", err)
+	}
+	exporter.Close()
+
+	file, err := os.Open(traceFile)
+	if err != nil {
+		t.Fatalf("Failed to open trace file: %v", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		t.Fatalf("trace file is empty")
+	}
+	var request otlpRequest
+	if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+		t.Fatalf("trace file line is not OTLP/JSON: %v", err)
+	}
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("trace file has %d spans; want 2", len(spans))
+	}
+	stage := spans[0]
+	if stage.Name != "stage" || stage.ParentSpanID != spans[1].SpanID || len(stage.TraceID) != 32 || len(stage.SpanID) != 16 {
+		t.Errorf("stage span = %+v; want a child of root with hex IDs", stage)
+	}
+	if stage.Status.Code != 2 || stage.Status.Message != "bad input" {
+		t.Errorf("stage status = %+v; want an error", stage.Status)
+	}
+	attrs := map[string]otlpValue{}
+	for _, kv := range stage.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	if v := attrs["rows"].IntValue; v == nil || *v != "42" {
+		t.Errorf("rows attribute = %+v; want intValue \"42\"", attrs["rows"])
+	}
+	if v := attrs["ratio"].DoubleValue; v == nil || *v != 0.5 {
+		t.Errorf("ratio attribute = %+v; want doubleValue 0.5", attrs["ratio"])
+	}
+}
+
+func TestHTTPExporter(t *testing.T) {
+	var received otlpRequest
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+	}))
+	defer server.Close()
+
+	tr := NewTracer(NewHTTPExporter(server.URL + "/v1/traces"))
+	tr.startSpan("root").End()
+	if err := tr.Flush(); err != nil {
+		t.Fatalf("Flush() returned an error: %v", err)
+	}
+	if contentType != "application/json" || len(received.ResourceSpans) != 1 || received.ResourceSpans[0].ScopeSpans[0].Spans[0].Name != "root" {
+		t.Errorf("collector received %+v with Content-Type %q; want the root span as JSON", received, contentType)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	tr = NewTracer(NewHTTPExporter(failing.URL))
+	tr.startSpan("root").End()
+	if err := tr.Flush(); err == nil {
+		t.Errorf("Flush() did not return an error for a failing collector")
+	}
+}
+
+// blockingExporter holds its first export until released
+type blockingExporter struct {
+	memoryExporter
+	started, release chan struct{}
+	once             sync.Once
+}
+
+func (e *blockingExporter) ExportSpans(spans []SpanData) error {
+	e.once.Do(func() {
+		close(e.started)
+		<-e.release
+	})
+	return e.memoryExporter.ExportSpans(spans)
+}
+
+func TestTracer_ExportOutsideLock(t *testing.T) {
+	exporter := &blockingExporter{started: make(chan struct{}), release: make(chan struct{})}
+	tr := NewTracer(exporter)
+
+	// Filling a batch exports it; the export blocks until released
+	go func() {
+		for i := 0; i < spanBatchSize; i++ {
+			tr.record(SpanData{Name: "batch"})
+		}
+	}()
+	<-exporter.started
+
+	recorded := make(chan struct{})
+	go func() {
+		tr.record(SpanData{Name: "other"})
+		close(recorded)
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("record() blocked while another batch was being exported")
+	}
+
+	close(exporter.release)
+	if err := tr.Flush(); err != nil {
+		t.Fatalf("Flush() returned an error: %v", err)
+	}
+	if len(exporter.spans) != spanBatchSize+1 {
+		t.Errorf("exported %d spans; want %d", len(exporter.spans), spanBatchSize+1)
+	}
+}
@@ -0,0 +1,155 @@
+package customerimporter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Layout of snapshot times in trend reports
+const trendTimeLayout = "2006-01-02 15:04"
+
+// TrendOptions selects what a trend report covers
+type TrendOptions struct {
+	From    string   // Snapshot ID compared from; empty is the one before To
+	To      string   // Snapshot ID compared to; empty is the latest
+	Domains []string // Domains whose growth is shown; empty shows the Top largest at To
+	Top     int      // Domains listed in the growth and movers tables
+	History int      // Snapshots, ending at To, shown in the growth table
+}
+
+// DefaultTrendOptions returns the settings used by the trends command
+func DefaultTrendOptions() TrendOptions {
+	return TrendOptions{Top: 10, History: 6}
+}
+
+// SnapshotComparison is what changed between two snapshots
+type SnapshotComparison struct {
+	From, To    Snapshot
+	Movers      []DomainDelta // Largest change first
+	Appeared    []string      // Domains only in To
+	Disappeared []string      // Domains only in From
+}
+
+// CompareSnapshots lists the domain count changes from one snapshot to another
+func CompareSnapshots(from, to Snapshot) SnapshotComparison {
+	comparison := SnapshotComparison{From: from, To: to, Movers: domainDeltas(from.DomainCounts, to.DomainCounts)}
+	for _, delta := range comparison.Movers {
+		switch {
+		case delta.Previous == 0:
+			comparison.Appeared = append(comparison.Appeared, delta.Domain)
+		case delta.Current == 0:
+			comparison.Disappeared = append(comparison.Disappeared, delta.Domain)
+		}
+	}
+	sort.Strings(comparison.Appeared)
+	sort.Strings(comparison.Disappeared)
+	return comparison
+}
+
+// selectSnapshots returns the indexes in snapshots, oldest first, of the
+// From and To snapshots of opts
+func selectSnapshots(snapshots []Snapshot, opts TrendOptions) (int, int, error) {
+	if len(snapshots) < 2 {
+		return 0, 0, fmt.Errorf("trends need at least two snapshots; %d stored", len(snapshots))
+	}
+	find := func(id string, fallback int) (int, error) {
+		if id == "" {
+			return fallback, nil
+		}
+		for i, snapshot := range snapshots {
+			if snapshot.ID == id {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+	}
+	to, err := find(opts.To, len(snapshots)-1)
+	if err != nil {
+		return 0, 0, err
+	}
+	from, err := find(opts.From, max(to-1, 0))
+	if err != nil {
+		return 0, 0, err
+	}
+	if from >= to {
+		return 0, 0, fmt.Errorf("snapshot %s is not older than %s", snapshots[from].ID, snapshots[to].ID)
+	}
+	return from, to, nil
+}
+
+// WriteTrends writes a plain-text trend report over snapshots, oldest first:
+// the growth of each domain over recent snapshots, the biggest movers between
+// two snapshots and the domains that appeared or disappeared between them
+func WriteTrends(w io.Writer, snapshots []Snapshot, opts TrendOptions) error {
+	from, to, err := selectSnapshots(snapshots, opts)
+	if err != nil {
+		return err
+	}
+	comparison := CompareSnapshots(snapshots[from], snapshots[to])
+	history := snapshots[max(to+1-opts.History, 0) : to+1]
+	domains := opts.Domains
+	if len(domains) == 0 {
+		for _, ranked := range topN(rankDomainCounts(snapshots[to].DomainCounts), opts.Top) {
+			domains = append(domains, ranked.Domain)
+		}
+	}
+
+	fmt.Fprintf(w, "%d snapshots from %s to %s\n\n", len(snapshots), snapshots[0].Taken.Format(trendTimeLayout), snapshots[len(snapshots)-1].Taken.Format(trendTimeLayout))
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "Growth over %d snapshots\n", len(history))
+	fmt.Fprint(table, "DOMAIN")
+	for _, snapshot := range history {
+		fmt.Fprintf(table, "\t%s", snapshot.Taken.Format(trendTimeLayout))
+	}
+	fmt.Fprint(table, "\tGROWTH\n")
+	for _, domain := range domains {
+		fmt.Fprint(table, domain)
+		for _, snapshot := range history {
+			fmt.Fprintf(table, "\t%d", snapshot.DomainCounts[domain])
+		}
+		fmt.Fprintf(table, "\t%s\n", growth(history[0].DomainCounts[domain], history[len(history)-1].DomainCounts[domain]))
+	}
+
+	fmt.Fprintf(table, "\nBiggest movers from %s to %s\n", comparison.From.ID, comparison.To.ID)
+	fmt.Fprint(table, "DOMAIN\tFROM\tTO\tCHANGE\tGROWTH\n")
+	for _, delta := range topN(comparison.Movers, opts.Top) {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%+d\t%s\n", delta.Domain, delta.Previous, delta.Current, delta.Delta, growth(delta.Previous, delta.Current))
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nNew domains (%d): %s\n", len(comparison.Appeared), domainList(comparison.Appeared))
+	_, err = fmt.Fprintf(w, "Disappeared domains (%d): %s\n", len(comparison.Disappeared), domainList(comparison.Disappeared))
+	return err
+}
+
+func domainList(domains []string) string {
+	if len(domains) == 0 {
+		return "none"
+	}
+	return strings.Join(domains, ", ")
+}
+
+// growth formats the relative change from one count to another
+func growth(from, to int) string {
+	if from == 0 {
+		if to == 0 {
+			return "-"
+		}
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", float64(to-from)/float64(from)*100)
+}
+
+// topN returns the first n items, or all of them when n is not positive
+func topN[T any](items []T, n int) []T {
+	if n > 0 && len(items) > n {
+		return items[:n]
+	}
+	return items
+}
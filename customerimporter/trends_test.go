@@ -0,0 +1,119 @@
+package customerimporter
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func trendTestSnapshots() []Snapshot {
+	start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	counts := []map[string]int{
+		{"example.com": 100, "another.com": 50, "old.net": 5},
+		{"example.com": 120, "another.com": 40, "old.net": 2},
+		{"example.com": 150, "another.com": 45, "new.org": 30},
+	}
+	snapshots := make([]Snapshot, len(counts))
+	for i, domainCounts := range counts {
+		taken := start.Add(time.Duration(i) * 24 * time.Hour)
+		snapshots[i] = Snapshot{ID: taken.Format(snapshotIDLayout), Taken: taken, DomainCounts: domainCounts}
+	}
+	return snapshots
+}
+
+func TestCompareSnapshots(t *testing.T) {
+	snapshots := trendTestSnapshots()
+	comparison := CompareSnapshots(snapshots[1], snapshots[2])
+
+	expectedMovers := []DomainDelta{
+		{Domain: "example.com", Previous: 120, Current: 150, Delta: 30},
+		{Domain: "new.org", Previous: 0, Current: 30, Delta: 30},
+		{Domain: "another.com", Previous: 40, Current: 45, Delta: 5},
+		{Domain: "old.net", Previous: 2, Current: 0, Delta: -2},
+	}
+	if !reflect.DeepEqual(comparison.Movers, expectedMovers) {
+		t.Errorf("CompareSnapshots() Movers = %v; want %v", comparison.Movers, expectedMovers)
+	}
+	if !reflect.DeepEqual(comparison.Appeared, []string{"new.org"}) || !reflect.DeepEqual(comparison.Disappeared, []string{"old.net"}) {
+		t.Errorf("CompareSnapshots() = appeared %v, disappeared %v; want [new.org], [old.net]", comparison.Appeared, comparison.Disappeared)
+	}
+}
+
+func TestGrowth(t *testing.T) {
+	tests := []struct {
+		from, to int
+		expected string
+	}{
+		{100, 150, "+50.0%"},
+		{40, 30, "-25.0%"},
+		{0, 30, "new"},
+		{0, 0, "-"},
+		{5, 0, "-100.0%"},
+	}
+
+	for _, test := range tests {
+		if result := growth(test.from, test.to); result != test.expected {
+			t.Errorf("growth(%d, %d) = %q; want %q", test.from, test.to, result, test.expected)
+		}
+	}
+}
+
+func TestWriteTrends(t *testing.T) {
+	snapshots := trendTestSnapshots()
+	var out bytes.Buffer
+	if err := WriteTrends(&out, snapshots, DefaultTrendOptions()); err != nil {
+		t.Fatalf("WriteTrends() returned an error: %v", err)
+	}
+	report := out.String()
+	for _, expected := range []string{
+		"3 snapshots from 2026-10-01 09:00 to 2026-10-03 09:00",
+		"Growth over 3 snapshots",
+		"example.com  100               120               150               +50.0%",
+		"Biggest movers from 20261002T090000.000000Z to 20261003T090000.000000Z",
+		"new.org      0     30   +30     new",
+		"New domains (1): new.org",
+		"Disappeared domains (1): old.net",
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("WriteTrends() report is missing %q:\n%s", expected, report)
+		}
+	}
+
+	out.Reset()
+	opts := TrendOptions{From: snapshots[0].ID, Domains: []string{"another.com"}, Top: 1, History: 2}
+	if err := WriteTrends(&out, snapshots, opts); err != nil {
+		t.Fatalf("WriteTrends() returned an error: %v", err)
+	}
+	report = out.String()
+	if !strings.Contains(report, "Growth over 2 snapshots") || !strings.Contains(report, "another.com  40") || strings.Contains(report, "example.com  120") {
+		t.Errorf("WriteTrends() with %+v = \n%s; want the growth of another.com over 2 snapshots", opts, report)
+	}
+	if !strings.Contains(report, "Disappeared domains (1): old.net") {
+		t.Errorf("WriteTrends() with %+v did not compare from the first snapshot:\n%s", opts, report)
+	}
+}
+
+func TestWriteTrends_Errors(t *testing.T) {
+	snapshots := trendTestSnapshots()
+	tests := []struct {
+		snapshots []Snapshot
+		opts      TrendOptions
+	}{
+		{snapshots[:1], DefaultTrendOptions()},
+		{snapshots, TrendOptions{To: "20200101T000000.000000Z", Top: 10, History: 6}},
+		{snapshots, TrendOptions{From: snapshots[2].ID, To: snapshots[1].ID, Top: 10, History: 6}},
+	}
+
+	for _, test := range tests {
+		if err := WriteTrends(&bytes.Buffer{}, test.snapshots, test.opts); err == nil {
+			t.Errorf("WriteTrends() with %d snapshots and %+v did not return an error", len(test.snapshots), test.opts)
+		}
+	}
+
+	if err := WriteTrends(&bytes.Buffer{}, snapshots, TrendOptions{From: "missing", Top: 10, History: 6}); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("WriteTrends() with an unknown snapshot = %v; want %v", err, ErrSnapshotNotFound)
+	}
+}
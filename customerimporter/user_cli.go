@@ -1,17 +1,73 @@
 package customerimporter
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 )
 
 func CLI() {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serve(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "trends" {
+		trends(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		diff(os.Args[2:])
+		return
+	}
+
+	// Parse command-line flags
+	opts, err := parseOptions(os.Args[1:])
+	if err != nil {
+		fatal("invalid command-line options", err)
+	}
+	var progress ProgressFunc
+	var progressInterval time.Duration
+	logOutput := io.Writer(os.Stderr)
+	if opts.Progress {
+		if isTerminal(os.Stderr) {
+			// Log lines go through the bar, which clears itself around them
+			progress, logOutput = TerminalProgress(os.Stderr)
+			progressInterval = 200 * time.Millisecond
+		} else {
+			progress, progressInterval = LogProgress(), 10*time.Second
+		}
+	}
+	l, err := NewLogger(logOutput, opts.LogLevel, opts.LogFormat)
+	if err != nil {
+		fatal("invalid logging options", err)
+	}
+	SetLogger(l)
+	if opts.MetricsAddr != "" {
+		server, err := ServeMetrics(opts.MetricsAddr)
+		if err != nil {
+			fatal("unable to serve metrics", err)
+		}
+		defer server.Close()
+	}
+	tracer, flushTracer := setupTracing(opts)
+	defer flushTracer()
+	onFatal(flushTracer)
+	config := RunConfig{Strict: opts.Strict, CountPolicy: &opts.CountPolicy, Progress: progress, ProgressInterval: progressInterval, Tracer: tracer}
+	setupWebhook(opts.Webhook)
+	setupSnapshots(opts.SnapshotDir)
+	config.Providers, config.Validator = loadRules(opts.Providers, opts.Rules)
+
 	// Get the input file path
 	inputFile := getInputFilePath()
+	runInput = inputFile
 
 	// Get the output file path
 	outputFile := getOutputFilePath()
@@ -22,38 +78,501 @@ func CLI() {
 	// Open the input file
 	file, err := os.Open(inputFile)
 	if err != nil {
-		log.Fatalf("Error: Unable to open input file '%s': %v", inputFile, err)
+		fatal("unable to open input file", err, "file", inputFile)
 	}
 	defer file.Close()
 
 	// Process the file based on the chosen mode
 	var domainCounts map[string]int
+	var rowCounts map[string]int // Rows per domain for the snapshot, when domainCounts holds other counts
+	var state *ImportState
+	// Reached only when the run succeeds; fatal reports failures
+	defer func() { notifyRun(newRunSummary(runStarted, domainCounts, nil)) }()
+	if isXLSXFile(inputFile) {
+		mode = "xlsx"
+	}
+	if isFixedWidthFile(inputFile) {
+		mode = "fixed-width"
+	}
+	if opts.Strict && (mode == "2" || mode == "3") {
+		logger.Info("strict mode reads rows in order; using single-threaded mode")
+		mode = "1"
+	}
+	if opts.MaxMemory > 0 && mode != "xlsx" && mode != "fixed-width" {
+		mode = "external"
+	}
+	if opts.Approximate && mode != "xlsx" && mode != "fixed-width" {
+		mode = "approximate"
+	}
+	if (opts.Distinct || opts.Duplicates != "") && mode != "xlsx" && mode != "fixed-width" {
+		mode = "distinct"
+	}
+	if opts.DedupReport != "" && (mode == "xlsx" || mode == "fixed-width") {
+		fatal("--fuzzy-dedup reads CSV input only", nil, "mode", mode)
+	}
+	if opts.StateFile != "" {
+		if mode == "xlsx" || mode == "fixed-width" {
+			logger.Warn("incremental imports read CSV input only; ignoring --state-file", "mode", mode)
+		} else {
+			mode = "incremental"
+		}
+	}
+	if opts.Database != "" {
+		if mode == "xlsx" || mode == "fixed-width" {
+			logger.Warn("customers are loaded from CSV input only; ignoring --db", "mode", mode)
+		} else {
+			mode = "database"
+		}
+	}
+	if opts.Checkpoint.File != "" {
+		if mode == "1" || mode == "2" {
+			config.Checkpoint = opts.Checkpoint
+		} else {
+			logger.Warn("checkpoints are only written in single-threaded and concurrent-streaming modes; ignoring --checkpoint-file", "mode", mode)
+		}
+	}
+	cliRun = NewRun(config)
+	defer cliRun.LogSkipSummary()
+	if config.Validator != nil && opts.RejectFile != "" {
+		defer func() { writeRejectReportOrExit(cliRun.Rejects(), opts.RejectFile) }()
+	}
 	switch mode {
+	case "database":
+		logger.Info("loading customers into the database", "database", opts.Database, "table", opts.Sink.Table)
+		db, err := sql.Open(SQLiteDriver, opts.Database)
+		if err != nil {
+			fatal("unable to open database", err)
+		}
+		defer db.Close()
+		onFatal(func() { db.Close() })
+		sink, err := NewSQLSink(context.Background(), db, opts.Sink)
+		if err != nil {
+			fatal("unable to prepare customer table", err)
+		}
+		result, err := cliRun.LoadCustomers(context.Background(), file, sink)
+		if err != nil {
+			fatal("loading customers failed", err)
+		}
+		domainCounts = result.DomainCounts
+	case "incremental":
+		logger.Info("running in incremental mode", "state", opts.StateFile)
+		previous, err := LoadImportState(opts.StateFile)
+		if err != nil {
+			fatal("unable to load import state", err)
+		}
+		result, err := cliRun.ProcessIncremental(file, previous)
+		if err != nil {
+			fatal("incremental processing failed", err)
+		}
+		domainCounts, state = result.DomainCounts, &result.State
+		changes := result.Changes
+		logger.Info("changes since the last run", "added", changes.Added, "removed", changes.Removed, "changed", changes.Changed, "unchanged", changes.Unchanged, "domains_changed", len(changes.DomainDeltas))
+		if opts.ChangesFile != "" {
+			if err := writeChangeReport(changes, opts.ChangesFile); err != nil {
+				fatal("unable to write change report", err)
+			}
+			logger.Info("change report written", "file", opts.ChangesFile)
+		}
+	case "distinct":
+		logger.Info("running in distinct-customer mode")
+		result, err := cliRun.ProcessDistinct(file)
+		if err != nil {
+			fatal("distinct-customer processing failed", err)
+		}
+		domainCounts = result.RowCounts
+		if opts.Distinct {
+			domainCounts, rowCounts = result.UniqueCounts, result.RowCounts
+		}
+		if opts.Duplicates != "" {
+			if err := writeDuplicatesReport(result.Duplicates, opts.Duplicates); err != nil {
+				fatal("unable to write duplicates report", err)
+			}
+			logger.Info("duplicates report written", "duplicated_emails", len(result.Duplicates), "file", opts.Duplicates)
+		}
+	case "approximate":
+		logger.Info("running in approximate mode")
+		result, err := cliRun.ProcessApproximate(file, opts.Sketch)
+		if err != nil {
+			fatal("approximate processing failed", err)
+		}
+		fmt.Print(result.Summary())
+		// The webhook gets the estimates, as no exact counts are kept
+		summary := newRunSummary(runStarted, nil, nil)
+		summary.Domains = int(result.DistinctDomains)
+		for _, domain := range result.TopDomains {
+			summary.TopDomains = append(summary.TopDomains, DomainCount{Domain: domain.Domain, Count: int(domain.Count)})
+		}
+		summary.TopDomains = topDomains(summary.TopDomains)
+		if outputFile == "console" {
+			fmt.Println(approximateResultsHeader)
+			for _, line := range result.Lines() {
+				fmt.Println(line)
+			}
+		} else {
+			if err := writeOutput(result.Lines(), outputFile); err != nil {
+				fatal("unable to write to output file", err, "file", outputFile)
+			}
+			logger.Info("processing completed successfully", "output", outputFile)
+		}
+		notifyRun(summary)
+		// The snapshot holds the top domains' estimates over every row read
+		estimates := make(map[string]int, len(result.TopDomains))
+		for _, domain := range result.TopDomains {
+			estimates[domain.Domain] = int(domain.Count)
+		}
+		recordSnapshot(Snapshot{Input: inputFile, Mode: mode, Rows: result.Rows, DomainCounts: estimates})
+		return
+	case "external":
+		logger.Info("running in memory-bounded mode", "budget_bytes", opts.MaxMemory)
+		output, err := openOutput(outputFile)
+		if err != nil {
+			fatal("unable to write to output file", err, "file", outputFile)
+		}
+		defer output.Close()
+		onFatal(func() { output.Close() })
+		// Counts are only kept for a snapshot, which holds every domain anyway
+		var written func(domainCount)
+		var snapshotCounts map[string]int
+		if snapshotStore != nil {
+			snapshotCounts = make(map[string]int)
+			written = func(dc domainCount) { snapshotCounts[dc.Domain] = dc.Count }
+		}
+		domains, err := cliRun.processWithMemoryLimit(file, output, opts.MaxMemory, written)
+		if err != nil {
+			fatal("memory-bounded processing failed", err)
+		}
+		logger.Info("processing completed successfully", "output", outputFile)
+		summary := newRunSummary(runStarted, nil, nil)
+		summary.Domains = domains
+		notifyRun(summary)
+		recordSnapshot(Snapshot{Input: inputFile, Mode: mode, DomainCounts: snapshotCounts})
+		return
+	case "fixed-width":
+		layout, err := LoadFixedWidthLayout(getLayoutFilePath())
+		if err != nil {
+			fatal("invalid layout file", err)
+		}
+		logger.Info("reading fixed-width input")
+		src, err := NewFixedWidthSource(file, layout)
+		if err != nil {
+			fatal("unable to use layout", err)
+		}
+		domainCounts, err = cliRun.ProcessSource(src)
+		if err != nil {
+			fatal("fixed-width processing failed", err)
+		}
+	case "xlsx":
+		logger.Info("reading XLSX workbook (first sheet)")
+		src, err := OpenXLSX(inputFile, "")
+		if err != nil {
+			fatal("unable to read workbook", err, "file", inputFile)
+		}
+		defer src.Close()
+		domainCounts, err = cliRun.ProcessSource(src)
+		if err != nil {
+			fatal("XLSX processing failed", err)
+		}
 	case "2":
-		log.Println("Running in concurrent-streaming mode...")
-		domainCounts, err = ProcessWithConcurrentStreaming(file)
+		logger.Info("running in concurrent-streaming mode")
+		domainCounts, err = cliRun.ProcessWithConcurrentStreaming(file)
 		if err != nil {
-			log.Fatalf("Error in concurrent-streaming processing: %v", err)
+			fatal("concurrent-streaming processing failed", err)
+		}
+	case "3":
+		logger.Info("running in parallel byte-range mode")
+		domainCounts, err = cliRun.ProcessWithParallelRanges(file, 0)
+		if err != nil {
+			fatal("parallel byte-range processing failed", err)
 		}
 	case "1":
-		log.Println("Running in single-threaded mode...")
-		domainCounts, err = Process(inputFile, outputFile)
+		logger.Info("running in single-threaded mode")
+		domainCounts, err = cliRun.Process(inputFile, outputFile)
 		if err != nil {
-			log.Fatalf("Error in single-threaded processing: %v", err)
+			fatal("single-threaded processing failed", err)
 		}
 	default:
 		// This should never happen due to prior validation
-		log.Fatalf("Error: Invalid processing mode '%s'", mode)
+		fatal("invalid processing mode", nil, "mode", mode)
 	}
 
 	// Handle output
 	handleOutput(domainCounts, outputFile)
+
+	if opts.OpenMetrics != "" {
+		if err := writeOpenMetricsFile(domainCounts, opts.OpenMetrics); err != nil {
+			fatal("unable to write OpenMetrics file", err)
+		}
+		logger.Info("OpenMetrics file written", "file", opts.OpenMetrics)
+	}
+
+	// Saved last, so a run that fails is compared with the same state again
+	if state != nil {
+		if err := SaveImportState(opts.StateFile, *state); err != nil {
+			fatal("unable to save import state", err)
+		}
+		logger.Info("import state saved", "customers", len(state.Customers), "file", opts.StateFile)
+	}
+
+	if rowCounts == nil {
+		rowCounts = domainCounts
+	}
+	snapshotMode := mode
+	if name, ok := modeNames[mode]; ok {
+		snapshotMode = name
+	}
+	recordSnapshot(Snapshot{Input: inputFile, Mode: snapshotMode, DomainCounts: rowCounts})
+
+	if opts.DedupReport != "" {
+		runFuzzyDedup(inputFile, config, opts)
+	}
+}
+
+// serve runs the import HTTP API until interrupted
+func serve(args []string) {
+	opts, err := parseServeOptions(args)
+	if err != nil {
+		fatal("invalid serve options", err)
+	}
+	l, err := NewLogger(os.Stderr, opts.LogLevel, opts.LogFormat)
+	if err != nil {
+		fatal("invalid logging options", err)
+	}
+	SetLogger(l)
+	opts.Queue.Import.Providers, opts.Queue.Import.Validator = loadRules(opts.Providers, opts.Rules)
+	setupWebhook(opts.Webhook)
+	setupSnapshots(opts.Snapshots)
+
+	store, err := NewFileJobStore(opts.JobDir)
+	if err != nil {
+		fatal("unable to open job store", err)
+	}
+	queue, err := NewJobQueue(store, opts.Queue)
+	if err != nil {
+		fatal("unable to start job queue", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = NewImportServer(opts.Server, queue).ListenAndServe(ctx, opts.Addr)
+	queue.Close()
+	if webhook != nil {
+		webhook.Close()
+	}
+	if err != nil {
+		fatal("import server failed", err)
+	}
+	logger.Info("import server stopped")
+}
+
+// trends prints domain trends from the snapshot store
+func trends(args []string) {
+	opts, err := parseTrendsOptions(args)
+	if err != nil {
+		fatal("invalid trends options", err)
+	}
+	store, err := NewSnapshotStore(opts.SnapshotDir)
+	if err != nil {
+		fatal("unable to open snapshot store", err)
+	}
+	snapshots, err := store.List()
+	if err != nil {
+		fatal("unable to read snapshots", err)
+	}
+	if err := WriteTrends(os.Stdout, snapshots, opts.Trends); err != nil {
+		fatal("unable to report trends", err)
+	}
+}
+
+// diff compares two result files and exits with diffExceededStatus when they
+// differ beyond the threshold
+func diff(args []string) {
+	opts, err := parseDiffOptions(args)
+	if err != nil {
+		fatal("invalid diff options", err)
+	}
+	oldCounts, err := ReadDomainCountsFile(opts.Old)
+	if err != nil {
+		fatal("unable to read result file", err, "file", opts.Old)
+	}
+	newCounts, err := ReadDomainCountsFile(opts.New)
+	if err != nil {
+		fatal("unable to read result file", err, "file", opts.New)
+	}
+	result := DiffDomainCounts(oldCounts, newCounts, opts.Threshold)
+	if err := WriteDiff(os.Stdout, result, opts.Old, opts.New, opts.Threshold); err != nil {
+		fatal("unable to write diff", err)
+	}
+	if result.Exceeded > 0 {
+		os.Exit(diffExceededStatus)
+	}
+}
+
+// setupSnapshots installs the snapshot store in dir, if any
+func setupSnapshots(dir string) {
+	if dir == "" {
+		return
+	}
+	store, err := NewSnapshotStore(dir)
+	if err != nil {
+		fatal("unable to open snapshot store", err)
+	}
+	SetSnapshotStore(store)
+	logger.Info("recording run snapshots", "dir", dir)
+}
+
+// Names of the interactive processing modes, as recorded in snapshots
+var modeNames = map[string]string{"1": "single-threaded", "2": "concurrent-streaming", "3": "parallel-ranges"}
+
+// loadRules loads the provider rules and validation rules files named, if
+// any, returning nil for each file not named
+func loadRules(providersFile, rulesFile string) (ProviderRules, *Validator) {
+	var providers ProviderRules
+	if providersFile != "" {
+		rules, err := LoadProviderRules(providersFile)
+		if err != nil {
+			fatal("unable to load provider rules", err)
+		}
+		providers = rules
+	}
+	if rulesFile == "" {
+		return providers, nil
+	}
+	rules, err := LoadValidationRules(rulesFile)
+	if err != nil {
+		fatal("unable to load validation rules", err)
+	}
+	v, err := rules.Compile()
+	if err != nil {
+		fatal("invalid validation rules", err)
+	}
+	return providers, v
+}
+
+// writeRejectReportOrExit writes the per-rule reject counts at the end of a run
+func writeRejectReportOrExit(report RejectReport, outputFile string) {
+	if err := writeRejectReport(report, outputFile); err != nil {
+		fatal("unable to write reject report", err)
+	}
+	logger.Info("reject report written", "rejected", report.Rejected, "file", outputFile)
+}
+
+// setupTracing creates a tracer for --trace-file or --trace-endpoint, or nil
+// when neither is set, and a function that flushes it at the end of the run
+func setupTracing(opts Options) (*Tracer, func()) {
+	var exporter SpanExporter
+	closeExporter := func() error { return nil }
+	switch {
+	case opts.TraceFile != "":
+		fileExporter, err := NewFileExporter(opts.TraceFile)
+		if err != nil {
+			fatal("unable to create trace file", err)
+		}
+		exporter, closeExporter = fileExporter, fileExporter.Close
+	case opts.TraceURL != "":
+		exporter = NewHTTPExporter(opts.TraceURL)
+	default:
+		return nil, func() {}
+	}
+	t := NewTracer(exporter)
+	return t, func() {
+		if err := t.Flush(); err != nil {
+			logger.Warn("unable to export trace spans", "error", err)
+		}
+		if err := closeExporter(); err != nil {
+			logger.Warn("unable to close trace file", "error", err)
+		}
+	}
+}
+
+// The CLI's run and the details reported to the webhook
+var (
+	cliRun      *Run // Set once the run's settings are known
+	runStarted  = time.Now()
+	runInput    string
+	runNotified bool
+)
+
+// setupWebhook installs a webhook when --webhook-url is set
+func setupWebhook(config WebhookConfig) {
+	if config.URL != "" {
+		SetWebhook(NewWebhook(config))
+	}
+}
+
+// notifyRun completes summary with the CLI run's row counts and sends it to
+// the webhook, once per run
+func notifyRun(summary RunSummary) {
+	if webhook == nil || runNotified {
+		return
+	}
+	runNotified = true
+	summary.Input = runInput
+	if cliRun != nil {
+		summary.Rejects = cliRun.skips.snapshot()
+		for _, count := range summary.Rejects {
+			summary.Rejected += count
+		}
+		summary.Rows = max(int(cliRun.rows.Load())-summary.Rejected, 0)
+	}
+	webhook.Send(summary)
+}
+
+// fatal logs an error with the skip tally so far, notifies the webhook of the
+// failure and exits
+func fatal(msg string, err error, args ...any) {
+	failure := errors.New(msg)
+	if err != nil {
+		failure = fmt.Errorf("%s: %w", msg, err)
+	}
+	notifyRun(newRunSummary(runStarted, nil, failure))
+	if cliRun != nil {
+		cliRun.LogSkipSummary()
+	}
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	logger.Error(msg, args...)
+	for i := len(fatalCleanups) - 1; i >= 0; i-- {
+		fatalCleanups[i]()
+	}
+	os.Exit(1)
+}
+
+// fatalCleanups flush and close what the CLI has open, as os.Exit in fatal
+// skips deferred calls
+var fatalCleanups []func()
+
+// onFatal registers cleanup to run, latest first, if the CLI exits via fatal
+func onFatal(cleanup func()) {
+	fatalCleanups = append(fatalCleanups, cleanup)
+}
+
+// runFuzzyDedup re-reads the input under config and writes the
+// probable-duplicate clusters
+func runFuzzyDedup(inputFile string, config RunConfig, opts Options) {
+	file, err := os.Open(inputFile)
+	if err != nil {
+		fatal("unable to open input file", err, "file", inputFile)
+	}
+	defer file.Close()
+
+	// The import has already logged, counted and validated these rows
+	run := NewRun(config)
+	run.quiet = true
+	members, err := run.readClusterMembers(file)
+	if err != nil {
+		fatal("unable to read customers for deduplication", err)
+	}
+	clusters := run.FindDuplicateCustomers(members, opts.DedupLimit)
+	if err := writeClustersReport(clusters, opts.DedupReport); err != nil {
+		fatal("unable to write dedup report", err)
+	}
+	logger.Info("dedup report written", "clusters", len(clusters), "file", opts.DedupReport)
 }
 
 // getInputFilePath prompts the user for the input file path and validates it
 func getInputFilePath() string {
 	for {
-		fmt.Print("Enter the path to the input CSV file: ")
+		fmt.Print("Enter the path to the input file (CSV, XLSX or fixed-width .dat/.txt): ")
 		var inputFile string
 		_, err := fmt.Scanln(&inputFile)
 		if err != nil || strings.TrimSpace(inputFile) == "" {
@@ -68,6 +587,38 @@ func getInputFilePath() string {
 	}
 }
 
+// isXLSXFile reports whether the input should be read as an Excel workbook
+func isXLSXFile(inputFile string) bool {
+	return strings.EqualFold(filepath.Ext(inputFile), ".xlsx")
+}
+
+// isFixedWidthFile reports whether the input is a fixed-width text extract
+func isFixedWidthFile(inputFile string) bool {
+	switch strings.ToLower(filepath.Ext(inputFile)) {
+	case ".dat", ".txt", ".fw":
+		return true
+	}
+	return false
+}
+
+// getLayoutFilePath prompts the user for the fixed-width layout definition file
+func getLayoutFilePath() string {
+	for {
+		fmt.Print("Enter the path to the fixed-width layout file (JSON): ")
+		var layoutFile string
+		_, err := fmt.Scanln(&layoutFile)
+		if err != nil || strings.TrimSpace(layoutFile) == "" {
+			fmt.Println("Error: Invalid input. Please provide a valid file path.")
+			continue
+		}
+		if _, err := os.Stat(layoutFile); os.IsNotExist(err) {
+			fmt.Printf("Error: File '%s' does not exist. Please provide a valid file path.\n", layoutFile)
+			continue
+		}
+		return layoutFile
+	}
+}
+
 // getOutputFilePath prompts the user for the output file path and validates it
 func getOutputFilePath() string {
 	for {
@@ -115,11 +666,12 @@ func getProcessingMode() string {
 		fmt.Println("Choose processing mode:")
 		fmt.Println("1: Single-threaded")
 		fmt.Println("2: Concurrent-streaming")
-		fmt.Print("Enter mode (1 or 2): ")
+		fmt.Println("3: Parallel byte-range (large seekable files)")
+		fmt.Print("Enter mode (1, 2 or 3): ")
 		var mode string
 		_, err := fmt.Scanln(&mode)
-		if err != nil || (mode != "1" && mode != "2") {
-			fmt.Println("Error: Invalid mode. Please enter '1' or '2'.")
+		if err != nil || (mode != "1" && mode != "2" && mode != "3") {
+			fmt.Println("Error: Invalid mode. Please enter '1', '2' or '3'.")
 			continue
 		}
 		return mode
@@ -136,10 +688,24 @@ func handleOutput(domainCounts map[string]int, outputFile string) {
 		}
 	} else {
 		// Write results to the output file
-		err := writeOutput(domainCounts, outputFile)
+		err := writeOutput(sortDomains(domainCounts), outputFile)
 		if err != nil {
-			log.Fatalf("Error: Unable to write to output file '%s': %v", outputFile, err)
+			fatal("unable to write to output file", err, "file", outputFile)
 		}
-		log.Printf("Processing completed successfully. Output written to '%s'", outputFile)
+		logger.Info("processing completed successfully", "output", outputFile)
 	}
 }
+
+// openOutput opens the output file, or stdout when the output is the console
+func openOutput(outputFile string) (io.WriteCloser, error) {
+	if outputFile == "console" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(outputFile)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,262 @@
+package customerimporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// ColumnRule lists the constraints for one column. Empty optional values pass
+// every check except Required.
+type ColumnRule struct {
+	Required        bool     `json:"required,omitempty"`
+	Regex           string   `json:"regex,omitempty"`
+	Enum            []string `json:"enum,omitempty"`
+	CaseInsensitive bool     `json:"case_insensitive,omitempty"` // Applies to Enum
+	MaxLength       int      `json:"max_length,omitempty"`
+	IP              string   `json:"ip,omitempty"` // "v4", "v6" or "any"
+	AllowedDomains  []string `json:"allowed_domains,omitempty"`
+	BlockedDomains  []string `json:"blocked_domains,omitempty"`
+}
+
+// ValidationRules is the declarative rules file, keyed by column name
+// (first_name, last_name, email, gender, ip_address or a header alias)
+type ValidationRules struct {
+	Columns map[string]ColumnRule `json:"columns"`
+}
+
+// LoadValidationRules reads a JSON rules file
+func LoadValidationRules(fileName string) (ValidationRules, error) {
+	var rules ValidationRules
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return rules, fmt.Errorf("error reading rules file: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return rules, fmt.Errorf("error parsing rules file: %w", err)
+	}
+	return rules, nil
+}
+
+// The checks every mode applies before the validation rules, by skip reason,
+// named as rules so the reject report shows them alongside the rules file's
+var builtinRules = map[string]string{
+	reasonInvalidEmail:  "email.format", // emailRegex
+	reasonInvalidDomain: "email.domain", // domainRegex
+}
+
+// check is one compiled constraint
+type check struct {
+	name  string // "<column>.<constraint>", as shown in the reject report
+	field func(Record) string
+	pass  func(string) bool
+}
+
+// Validator applies compiled rules to records and counts rejections per rule.
+// It is safe for concurrent use.
+type Validator struct {
+	checks   []check
+	failures []int64
+	rejected int64
+}
+
+// Record field accessors by canonical field name
+var recordFields = map[string]func(Record) string{
+	"FirstName": func(r Record) string { return r.FirstName },
+	"LastName":  func(r Record) string { return r.LastName },
+	"Email":     func(r Record) string { return r.Email },
+	"Gender":    func(r Record) string { return r.Gender },
+	"IPAddress": func(r Record) string { return r.IPAddress },
+}
+
+// Compile turns the rules into a Validator, reporting any invalid rule
+func (r ValidationRules) Compile() (*Validator, error) {
+	columns := make([]string, 0, len(r.Columns))
+	for column := range r.Columns {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns) // Deterministic check order
+
+	v := &Validator{}
+	for _, column := range columns {
+		rule := r.Columns[column]
+		field, ok := recordFields[headerAliases[normaliseHeader(column)]]
+		if !ok {
+			return nil, fmt.Errorf("rules file: unknown column %q", column)
+		}
+		checks, err := rule.compile(column, field)
+		if err != nil {
+			return nil, err
+		}
+		v.checks = append(v.checks, checks...)
+	}
+	v.failures = make([]int64, len(v.checks))
+	return v, nil
+}
+
+func (rule ColumnRule) compile(column string, field func(Record) string) ([]check, error) {
+	var checks []check
+	add := func(name string, pass func(string) bool) {
+		checks = append(checks, check{name: column + "." + name, field: field, pass: pass})
+	}
+	optional := func(pass func(string) bool) func(string) bool {
+		return func(value string) bool { return value == "" || pass(value) }
+	}
+
+	if rule.Required {
+		add("required", func(value string) bool { return strings.TrimSpace(value) != "" })
+	}
+	if rule.Regex != "" {
+		re, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("rules file: column %q: invalid regex: %w", column, err)
+		}
+		add("regex", optional(re.MatchString))
+	}
+	if len(rule.Enum) > 0 {
+		allowed := make(map[string]bool, len(rule.Enum))
+		for _, value := range rule.Enum {
+			if rule.CaseInsensitive {
+				value = strings.ToLower(value)
+			}
+			allowed[value] = true
+		}
+		add("enum", optional(func(value string) bool {
+			if rule.CaseInsensitive {
+				value = strings.ToLower(value)
+			}
+			return allowed[value]
+		}))
+	}
+	if rule.MaxLength > 0 {
+		add("max_length", func(value string) bool { return utf8.RuneCountInString(value) <= rule.MaxLength })
+	}
+	switch rule.IP {
+	case "":
+	case "v4", "v6", "any":
+		version := rule.IP
+		add("ip", optional(func(value string) bool {
+			ip := net.ParseIP(value)
+			switch {
+			case ip == nil:
+				return false
+			case version == "v4":
+				return ip.To4() != nil
+			case version == "v6":
+				return ip.To4() == nil
+			}
+			return true
+		}))
+	default:
+		return nil, fmt.Errorf("rules file: column %q: ip must be v4, v6 or any", column)
+	}
+	if len(rule.AllowedDomains) > 0 {
+		allowed := rule.AllowedDomains
+		add("allowed_domains", optional(func(value string) bool { return matchesDomain(value, allowed) }))
+	}
+	if len(rule.BlockedDomains) > 0 {
+		blocked := rule.BlockedDomains
+		add("blocked_domains", optional(func(value string) bool { return !matchesDomain(value, blocked) }))
+	}
+	return checks, nil
+}
+
+// matchesDomain reports whether the domain of an email (or a bare domain) is
+// one of domains or a subdomain of one
+func matchesDomain(value string, domains []string) bool {
+	domain := strings.ToLower(value[strings.LastIndex(value, "@")+1:])
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns the name of the first rule the record breaks, or "" and
+// true when it passes every rule
+func (v *Validator) Validate(record Record) (string, bool) {
+	for i, c := range v.checks {
+		if !c.pass(c.field(record)) {
+			atomic.AddInt64(&v.failures[i], 1)
+			atomic.AddInt64(&v.rejected, 1)
+			return c.name, false
+		}
+	}
+	return "", true
+}
+
+// ruleValue returns the column named by a check such as "email.regex" and the
+// record's value for it
+func ruleValue(rule string, record Record) (string, string) {
+	column := rule
+	if dot := strings.LastIndex(rule, "."); dot != -1 {
+		column = rule[:dot]
+	}
+	if field, ok := recordFields[headerAliases[normaliseHeader(column)]]; ok {
+		return column, field(record)
+	}
+	return column, ""
+}
+
+// RejectReport summarises the records rejected by the validation rules
+type RejectReport struct {
+	Rejected int64            `json:"rejected"`
+	Rules    map[string]int64 `json:"rules"` // Rejections attributed to each rule
+}
+
+// Report returns the rejection counts so far
+func (v *Validator) Report() RejectReport {
+	report := RejectReport{Rejected: atomic.LoadInt64(&v.rejected), Rules: make(map[string]int64)}
+	for i, c := range v.checks {
+		report.Rules[c.name] = atomic.LoadInt64(&v.failures[i])
+	}
+	return report
+}
+
+// writeRejectReport writes the report as indented JSON
+func writeRejectReport(report RejectReport, outputFileName string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding reject report: %w", err)
+	}
+	if err := os.WriteFile(outputFileName, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing reject report: %w", err)
+	}
+	return nil
+}
+
+// forRun returns a Validator applying v's rules with its own rejection counts,
+// or nil when v is nil
+func (v *Validator) forRun() *Validator {
+	if v == nil {
+		return nil
+	}
+	return &Validator{checks: v.checks, failures: make([]int64, len(v.checks))}
+}
+
+// checkRecord applies the run's validation rules, if any
+func (r *Run) checkRecord(record Record) (string, bool) {
+	if r.validator == nil {
+		return "", true
+	}
+	return r.validator.Validate(record)
+}
+
+// recordFromFields builds a Record from positional CSV fields, tolerating short rows
+func recordFromFields(fields []string) Record {
+	padded := make([]string, FieldCount)
+	copy(padded, fields)
+	record, _ := createRecord(padded)
+	return record
+}
@@ -0,0 +1,145 @@
+package customerimporter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRulesJSON = `{
+	"columns": {
+		"email": {"required": true, "max_length": 30, "blocked_domains": ["mailinator.com"]},
+		"gender": {"enum": ["male", "female"], "case_insensitive": true},
+		"ip_address": {"ip": "v4"},
+		"last_name": {"regex": "^[A-Za-z' -]+$"}
+	}
+}`
+
+func testValidator(t *testing.T) *Validator {
+	t.Helper()
+	rulesFile := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(rulesFile, []byte(testRulesJSON), 0644)
+	rules, err := LoadValidationRules(rulesFile)
+	if err != nil {
+		t.Fatalf("LoadValidationRules() returned an error: %v", err)
+	}
+	v, err := rules.Compile()
+	if err != nil {
+		t.Fatalf("Compile() returned an error: %v", err)
+	}
+	return v
+}
+
+func TestValidator_Validate(t *testing.T) {
+	v := testValidator(t)
+	valid := Record{FirstName: "John", LastName: "O'Neil", Email: "john@example.com", Gender: "Male", IPAddress: "1.2.3.4"}
+
+	tests := []struct {
+		name     string
+		modify   func(r *Record)
+		expected string
+	}{
+		{"valid", func(r *Record) {}, ""},
+		{"missing email", func(r *Record) { r.Email = " " }, "email.required"},
+		{"long email", func(r *Record) { r.Email = "a.very.long.address@example.com" }, "email.max_length"},
+		{"blocked domain", func(r *Record) { r.Email = "x@mailinator.com" }, "email.blocked_domains"},
+		{"blocked subdomain", func(r *Record) { r.Email = "x@eu.mailinator.com" }, "email.blocked_domains"},
+		{"bad gender", func(r *Record) { r.Gender = "Unknown" }, "gender.enum"},
+		{"empty optional gender", func(r *Record) { r.Gender = "" }, ""},
+		{"ipv6 address", func(r *Record) { r.IPAddress = "::1" }, "ip_address.ip"},
+		{"bad ip", func(r *Record) { r.IPAddress = "999.1.1.1" }, "ip_address.ip"},
+		{"bad last name", func(r *Record) { r.LastName = "D0e" }, "last_name.regex"},
+	}
+
+	for _, test := range tests {
+		record := valid
+		test.modify(&record)
+		rule, ok := v.Validate(record)
+		if rule != test.expected || ok != (test.expected == "") {
+			t.Errorf("%s: Validate() = %q, %v; want %q", test.name, rule, ok, test.expected)
+		}
+	}
+
+	report := v.Report()
+	if report.Rejected != 8 || report.Rules["ip_address.ip"] != 2 || report.Rules["email.blocked_domains"] != 2 {
+		t.Errorf("Report() = %+v; want 8 rejections with 2 for ip_address.ip and email.blocked_domains", report)
+	}
+}
+
+func TestValidationRules_CompileErrors(t *testing.T) {
+	tests := []ValidationRules{
+		{Columns: map[string]ColumnRule{"phone": {Required: true}}},
+		{Columns: map[string]ColumnRule{"email": {Regex: "("}}},
+		{Columns: map[string]ColumnRule{"ip_address": {IP: "v5"}}},
+	}
+
+	for _, rules := range tests {
+		if _, err := rules.Compile(); err == nil {
+			t.Errorf("Compile(%+v) did not return an error", rules)
+		}
+	}
+}
+
+func TestLoadValidationRules_UnknownField(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(rulesFile, []byte(`{"columns": {"email": {"requird": true}}}`), 0644)
+	if _, err := LoadValidationRules(rulesFile); err == nil {
+		t.Errorf("LoadValidationRules() did not return an error for a misspelt constraint")
+	}
+}
+
+func TestValidator_AppliedByEveryMode(t *testing.T) {
+	run := NewRun(RunConfig{Validator: testValidator(t)})
+
+	data := "first_name,last_name,email,gender,ip_address\n" +
+		"John,Doe,john@example.com,Male,1.1.1.1\n" +
+		"Spam,Bot,bot@mailinator.com,Male,2.2.2.2\n" +
+		"Jane,Doe,jane@example.com,Other,3.3.3.3\n"
+	expected := map[string]int{"example.com": 1}
+
+	distinct, err := run.ProcessDistinct(strings.NewReader(data))
+	if err != nil || !reflect.DeepEqual(distinct.RowCounts, expected) {
+		t.Errorf("ProcessDistinct() = %v, %v; want %v", distinct.RowCounts, err, expected)
+	}
+
+	file, err := os.CreateTemp(t.TempDir(), "rules_test.csv")
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	file.WriteString(data)
+	file.Seek(0, 0)
+	streamed, err := run.ProcessWithConcurrentStreaming(file)
+	if err != nil || !reflect.DeepEqual(streamed, expected) {
+		t.Errorf("ProcessWithConcurrentStreaming() = %v, %v; want %v", streamed, err, expected)
+	}
+
+	src := &sliceSource{records: []Record{{Email: "john@example.com"}, {Email: "bot@mailinator.com"}}}
+	sourced, err := run.ProcessSource(src)
+	if err != nil || !reflect.DeepEqual(sourced, expected) {
+		t.Errorf("ProcessSource() = %v, %v; want %v", sourced, err, expected)
+	}
+
+	if report := run.Rejects(); report.Rules["email.blocked_domains"] != 3 || report.Rules["gender.enum"] != 2 {
+		t.Errorf("Report() = %+v; want 3 email.blocked_domains and 2 gender.enum rejections", report)
+	}
+}
+
+func TestWriteRejectReport(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "rejects.json")
+	report := RejectReport{Rejected: 3, Rules: map[string]int64{"email.required": 1, "gender.enum": 2}}
+	if err := writeRejectReport(report, outputFile); err != nil {
+		t.Fatalf("writeRejectReport() returned an error: %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var decoded RejectReport
+	if err := json.Unmarshal(data, &decoded); err != nil || !reflect.DeepEqual(decoded, report) {
+		t.Errorf("writeRejectReport() wrote %s; want %+v", data, report)
+	}
+}
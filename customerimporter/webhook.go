@@ -0,0 +1,216 @@
+package customerimporter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Webhook events
+const (
+	EventImportSucceeded = "import.succeeded"
+	EventImportFailed    = "import.failed"
+)
+
+// Domains listed in a run summary
+const summaryTopDomains = 10
+
+// Headers sent with each delivery
+const (
+	headerEvent     = "X-Customerimporter-Event"
+	headerDelivery  = "X-Customerimporter-Delivery"
+	headerSignature = "X-Customerimporter-Signature" // "sha256=" and the hex HMAC-SHA256 of the body
+)
+
+// RunSummary is the payload POSTed to webhooks when an import finishes
+type RunSummary struct {
+	Event      string         `json:"event"`
+	JobID      string         `json:"job_id,omitempty"` // Set for imports run by the serve command
+	Input      string         `json:"input,omitempty"`
+	Started    time.Time      `json:"started"`
+	Finished   time.Time      `json:"finished"`
+	Rows       int            `json:"rows"`              // Valid rows counted
+	Rejected   int            `json:"rejected"`          // Rows skipped as invalid
+	Rejects    map[string]int `json:"rejects,omitempty"` // Skipped rows by reason, when known
+	Domains    int            `json:"domains"`
+	TopDomains []DomainCount  `json:"top_domains,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// newRunSummary summarises a run ending with domainCounts or err
+func newRunSummary(started time.Time, domainCounts map[string]int, err error) RunSummary {
+	summary := RunSummary{Event: EventImportSucceeded, Started: started.UTC(), Finished: time.Now().UTC()}
+	if err != nil {
+		summary.Event, summary.Error = EventImportFailed, err.Error()
+	}
+	summary.Domains = len(domainCounts)
+	summary.TopDomains = topDomains(rankDomainCounts(domainCounts))
+	return summary
+}
+
+func topDomains(ranked []DomainCount) []DomainCount {
+	if len(ranked) > summaryTopDomains {
+		return ranked[:summaryTopDomains]
+	}
+	return ranked
+}
+
+// WebhookConfig configures webhook delivery
+type WebhookConfig struct {
+	URL            string
+	Secret         string        // HMAC-SHA256 signing key; empty sends unsigned requests
+	MaxAttempts    int           // Deliveries tried before giving up
+	InitialBackoff time.Duration // Wait before the first retry, doubled for each further one
+	MaxBackoff     time.Duration
+	DeadLetterFile string // JSON lines of summaries that could not be delivered; empty discards them
+}
+
+// DefaultWebhookConfig returns the retry settings used by the CLI
+func DefaultWebhookConfig() WebhookConfig {
+	return WebhookConfig{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 30 * time.Second}
+}
+
+// Webhook delivers run summaries to a URL
+type Webhook struct {
+	config   WebhookConfig
+	client   *http.Client
+	mu       sync.Mutex // Serialises dead-letter writes
+	inFlight sync.WaitGroup
+}
+
+// NewWebhook returns a webhook delivering with config
+func NewWebhook(config WebhookConfig) *Webhook {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 1
+	}
+	return &Webhook{config: config, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Active webhook; nil disables notifications
+var webhook *Webhook
+
+// SetWebhook installs the webhook notified when imports finish; nil disables it
+func SetWebhook(w *Webhook) {
+	webhook = w
+}
+
+// Send delivers summary, retrying network errors, 429 and 5xx responses with
+// exponential backoff. A summary that cannot be delivered is appended to the
+// dead-letter file and the last delivery error is returned.
+func (w *Webhook) Send(summary RunSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("error encoding run summary: %w", err)
+	}
+	delivery := newImportID()
+	backoff := w.config.InitialBackoff
+	attempt := 1
+	for ; ; attempt++ {
+		var retry bool
+		retry, err = w.post(summary.Event, delivery, body)
+		if err == nil {
+			logger.Info("webhook delivered", "event", summary.Event, "delivery", delivery, "attempts", attempt)
+			return nil
+		}
+		if !retry || attempt >= w.config.MaxAttempts {
+			break
+		}
+		logger.Warn("webhook delivery failed; retrying", "delivery", delivery, "attempt", attempt, "backoff", backoff, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if w.config.MaxBackoff > 0 && backoff > w.config.MaxBackoff {
+			backoff = w.config.MaxBackoff
+		}
+	}
+	logger.Error("webhook delivery abandoned", "delivery", delivery, "attempts", attempt, "error", err)
+	if dlErr := w.deadLetter(body, attempt, err); dlErr != nil {
+		logger.Error("unable to write webhook dead letter", "error", dlErr)
+	}
+	return fmt.Errorf("error delivering webhook after %d attempts: %w", attempt, err)
+}
+
+// Notify delivers summary in the background; Close waits for it
+func (w *Webhook) Notify(summary RunSummary) {
+	w.inFlight.Add(1)
+	go func() {
+		defer w.inFlight.Done()
+		w.Send(summary)
+	}()
+}
+
+// Close waits for background deliveries to finish
+func (w *Webhook) Close() {
+	w.inFlight.Wait()
+}
+
+// post makes one delivery attempt and reports whether a failure is worth retrying
+func (w *Webhook) post(event, delivery string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerEvent, event)
+	req.Header.Set(headerDelivery, delivery)
+	if w.config.Secret != "" {
+		req.Header.Set(headerSignature, SignWebhook(w.config.Secret, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("receiver returned %s", resp.Status)
+}
+
+// SignWebhook returns the signature header value for body: "sha256=" and the
+// hex HMAC-SHA256 of body keyed with secret. Receivers should recompute it
+// and compare with hmac.Equal.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deadLetter is one undelivered summary in the dead-letter file
+type deadLetter struct {
+	Time     time.Time       `json:"time"`
+	URL      string          `json:"url"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+func (w *Webhook) deadLetter(body []byte, attempts int, cause error) error {
+	if w.config.DeadLetterFile == "" {
+		return nil
+	}
+	line, err := json.Marshal(deadLetter{Time: time.Now().UTC(), URL: w.config.URL, Attempts: attempts, Error: cause.Error(), Payload: body})
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	file, err := os.OpenFile(w.config.DeadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening dead-letter file: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing dead-letter file: %w", err)
+	}
+	return file.Close()
+}
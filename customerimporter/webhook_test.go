@@ -0,0 +1,189 @@
+package customerimporter
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records deliveries, answering with the next status in
+// statuses and 200 once they run out
+type webhookReceiver struct {
+	t        *testing.T
+	secret   string
+	mu       sync.Mutex
+	statuses []int
+	received []RunSummary
+	attempts int
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.attempts++
+	if rcv.secret != "" && !hmac.Equal([]byte(r.Header.Get(headerSignature)), []byte(SignWebhook(rcv.secret, body))) {
+		rcv.t.Errorf("delivery signature %q does not match the body", r.Header.Get(headerSignature))
+	}
+	if len(rcv.statuses) > 0 {
+		status := rcv.statuses[0]
+		rcv.statuses = rcv.statuses[1:]
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	}
+	var summary RunSummary
+	if err := json.Unmarshal(body, &summary); err != nil {
+		rcv.t.Errorf("delivery body is not a run summary: %v", err)
+	}
+	if r.Header.Get(headerEvent) != summary.Event || r.Header.Get(headerDelivery) == "" {
+		rcv.t.Errorf("delivery headers = %v; want event %s and a delivery ID", r.Header, summary.Event)
+	}
+	rcv.received = append(rcv.received, summary)
+}
+
+func newWebhookReceiver(t *testing.T, secret string, statuses ...int) (*webhookReceiver, string) {
+	rcv := &webhookReceiver{t: t, secret: secret, statuses: statuses}
+	server := httptest.NewServer(rcv)
+	t.Cleanup(server.Close)
+	return rcv, server.URL
+}
+
+func testWebhookConfig(url string) WebhookConfig {
+	return WebhookConfig{URL: url, Secret: "s3cret", MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+}
+
+func TestWebhook_Send(t *testing.T) {
+	rcv, url := newWebhookReceiver(t, "s3cret")
+	summary := newRunSummary(time.Now(), map[string]int{"example.com": 2, "test.org": 1}, nil)
+	summary.Rows, summary.Rejected = 3, 1
+
+	if err := NewWebhook(testWebhookConfig(url)).Send(summary); err != nil {
+		t.Fatalf("Send() returned an error: %v", err)
+	}
+	if len(rcv.received) != 1 {
+		t.Fatalf("receiver got %d deliveries; want 1", len(rcv.received))
+	}
+	got := rcv.received[0]
+	if got.Event != EventImportSucceeded || got.Rows != 3 || got.Rejected != 1 || got.Domains != 2 || got.TopDomains[0] != (DomainCount{"example.com", 2}) {
+		t.Errorf("receiver got %+v; want %+v", got, summary)
+	}
+}
+
+func TestWebhook_Retries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+		err      bool
+	}{
+		{"recovers", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, 3, false},
+		{"gives up", []int{500, 502, 503, 504}, 3, true},
+		{"client error", []int{http.StatusBadRequest}, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rcv, url := newWebhookReceiver(t, "s3cret", test.statuses...)
+			config := testWebhookConfig(url)
+			config.DeadLetterFile = filepath.Join(t.TempDir(), "dead.jsonl")
+
+			err := NewWebhook(config).Send(newRunSummary(time.Now(), nil, errors.New("boom")))
+			if (err != nil) != test.err || rcv.attempts != test.attempts {
+				t.Errorf("Send() = %v after %d attempts; want error %v after %d", err, rcv.attempts, test.err, test.attempts)
+			}
+			_, statErr := os.Stat(config.DeadLetterFile)
+			if test.err == os.IsNotExist(statErr) {
+				t.Errorf("dead-letter file exists = %v; want %v", statErr == nil, test.err)
+			}
+		})
+	}
+}
+
+func TestWebhook_DeadLetter(t *testing.T) {
+	config := testWebhookConfig("http://127.0.0.1:1/unreachable")
+	config.MaxAttempts = 2
+	config.DeadLetterFile = filepath.Join(t.TempDir(), "dead.jsonl")
+	w := NewWebhook(config)
+	for i := 0; i < 2; i++ {
+		if err := w.Send(RunSummary{Event: EventImportFailed, Error: fmt.Sprint("run ", i)}); err == nil {
+			t.Fatalf("Send() to an unreachable URL did not return an error")
+		}
+	}
+
+	file, err := os.Open(config.DeadLetterFile)
+	if err != nil {
+		t.Fatalf("Failed to open dead-letter file: %v", err)
+	}
+	defer file.Close()
+	var letters []deadLetter
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var letter deadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatalf("dead-letter line is not JSON: %v", err)
+		}
+		letters = append(letters, letter)
+	}
+	if len(letters) != 2 {
+		t.Fatalf("dead-letter file has %d entries; want 2", len(letters))
+	}
+	var payload RunSummary
+	json.Unmarshal(letters[1].Payload, &payload)
+	if letters[1].Attempts != 2 || letters[1].URL != config.URL || letters[1].Error == "" || payload.Error != "run 1" {
+		t.Errorf("dead letter = %+v with payload %+v; want 2 attempts and the run 1 summary", letters[1], payload)
+	}
+}
+
+func TestNewRunSummary(t *testing.T) {
+	counts := make(map[string]int)
+	for i := 0; i < 15; i++ {
+		counts[fmt.Sprintf("domain%02d.com", i)] = i + 1
+	}
+	summary := newRunSummary(time.Now().Add(-time.Second), counts, nil)
+	if summary.Domains != 15 || len(summary.TopDomains) != summaryTopDomains || summary.TopDomains[0].Domain != "domain14.com" {
+		t.Errorf("newRunSummary() = %+v; want 15 domains, the top %d listed from domain14.com", summary, summaryTopDomains)
+	}
+	if !summary.Finished.After(summary.Started) || summary.Event != EventImportSucceeded {
+		t.Errorf("newRunSummary() = %+v; want a succeeded run finishing after it started", summary)
+	}
+
+	failed := newRunSummary(time.Now(), nil, errors.New("no email column"))
+	if failed.Event != EventImportFailed || failed.Error != "no email column" || failed.Domains != 0 {
+		t.Errorf("newRunSummary() = %+v; want a failed run", failed)
+	}
+}
+
+func TestWebhook_JobQueue(t *testing.T) {
+	rcv, url := newWebhookReceiver(t, "s3cret")
+	w := NewWebhook(testWebhookConfig(url))
+	SetWebhook(w)
+	t.Cleanup(func() { SetWebhook(nil) })
+
+	q := newTestJobQueue(t, t.TempDir(), DefaultJobQueueConfig())
+	job, err := q.Submit(strings.NewReader(jobTestCSV))
+	if err != nil {
+		t.Fatalf("Submit() returned an error: %v", err)
+	}
+	waitForJob(t, q, job.ID)
+	w.Close()
+
+	if len(rcv.received) != 1 {
+		t.Fatalf("receiver got %d deliveries; want 1", len(rcv.received))
+	}
+	got := rcv.received[0]
+	if got.Event != EventImportSucceeded || got.JobID != job.ID || got.Rows != 3 || got.Rejected != 1 || got.Domains != 2 {
+		t.Errorf("receiver got %+v; want job %s with 3 rows, 1 rejected and 2 domains", got, job.ID)
+	}
+}
@@ -0,0 +1,385 @@
+package customerimporter
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// XLSXSource reads customer records from a single worksheet of an .xlsx
+// workbook. The first row of the sheet is treated as the header.
+type XLSXSource struct {
+	archive       *zip.ReadCloser
+	sheet         io.ReadCloser
+	input         *sourceInput // Reads the uncompressed sheet
+	decoder       *xml.Decoder
+	sharedStrings []string
+	cols          columnMap
+	rowNumber     int
+}
+
+// Minimal views of the workbook parts needed to locate a sheet
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// OpenXLSX opens a workbook and returns a Source for the requested sheet.
+// sheet may be a sheet name or a 1-based index; empty selects the first sheet.
+func OpenXLSX(fileName string, sheet string) (*XLSXSource, error) {
+	archive, err := zip.OpenReader(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening workbook: %w", err)
+	}
+	src := &XLSXSource{archive: archive}
+	if err := src.open(sheet); err != nil {
+		archive.Close()
+		return nil, err
+	}
+	return src, nil
+}
+
+func (s *XLSXSource) open(sheet string) error {
+	var workbook xlsxWorkbook
+	if err := decodeZipXML(&s.archive.Reader, "xl/workbook.xml", &workbook); err != nil {
+		return err
+	}
+	var rels xlsxRelationships
+	if err := decodeZipXML(&s.archive.Reader, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return err
+	}
+	if len(workbook.Sheets) == 0 {
+		return fmt.Errorf("workbook contains no sheets")
+	}
+
+	// Resolve the sheet by name first, then by 1-based index
+	selected := -1
+	if sheet == "" {
+		selected = 0
+	}
+	for i, ws := range workbook.Sheets {
+		if selected == -1 && ws.Name == sheet {
+			selected = i
+		}
+	}
+	if selected == -1 {
+		if n, err := strconv.Atoi(sheet); err == nil && n >= 1 && n <= len(workbook.Sheets) {
+			selected = n - 1
+		}
+	}
+	if selected == -1 {
+		return fmt.Errorf("sheet %q not found in workbook", sheet)
+	}
+
+	target := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[selected].RID {
+			target = rel.Target
+		}
+	}
+	if target == "" {
+		return fmt.Errorf("no relationship found for sheet %q", workbook.Sheets[selected].Name)
+	}
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+
+	if err := s.loadSharedStrings(); err != nil {
+		return err
+	}
+
+	part, err := findZipFile(&s.archive.Reader, target)
+	if err != nil {
+		return err
+	}
+	sheetFile, err := part.Open()
+	if err != nil {
+		return err
+	}
+	s.sheet = sheetFile
+	s.input = &sourceInput{r: sheetFile, size: int64(part.UncompressedSize64)}
+	s.decoder = xml.NewDecoder(s.input)
+
+	header, err := s.nextRow()
+	if err == io.EOF {
+		return fmt.Errorf("sheet: %w", ErrEmptyFile)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading header row: %w", err)
+	}
+	s.cols, err = mapHeader(header)
+	return err
+}
+
+// loadSharedStrings reads the workbook string table; it is optional
+func (s *XLSXSource) loadSharedStrings() error {
+	file, err := openZipFile(&s.archive.Reader, "xl/sharedStrings.xml")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	decoder := xml.NewDecoder(file)
+	var current strings.Builder
+	inItem, inText, inPhonetic := false, false, false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading shared strings: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				inItem = true
+				current.Reset()
+			case "rPh":
+				inPhonetic = true
+			case "t":
+				inText = inItem && !inPhonetic
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				inItem = false
+				s.sharedStrings = append(s.sharedStrings, current.String())
+			case "rPh":
+				inPhonetic = false
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				current.Write(t)
+			}
+		}
+	}
+}
+
+// Next returns the next record from the sheet, or a *RowError for a row
+// without an email value
+func (s *XLSXSource) Next() (Record, error) {
+	for {
+		row, err := s.nextRow()
+		if err != nil {
+			return Record{}, err
+		}
+		if isBlankRow(row) {
+			continue
+		}
+		for i := range row {
+			row[i] = strings.TrimSpace(row[i])
+		}
+		record, err := recordFromRow(s.cols, row)
+		if err != nil {
+			return Record{}, &RowError{Line: s.rowNumber, Reason: err.Error(), Err: err}
+		}
+		return record, nil
+	}
+}
+
+// Line returns the sheet row number of the last row read
+func (s *XLSXSource) Line() int {
+	return s.rowNumber
+}
+
+func (s *XLSXSource) progressInput() *sourceInput {
+	return s.input
+}
+
+// Close releases the underlying workbook
+func (s *XLSXSource) Close() error {
+	if s.sheet != nil {
+		s.sheet.Close()
+	}
+	return s.archive.Close()
+}
+
+// nextRow decodes the next <row> element into cell values by column position
+func (s *XLSXSource) nextRow() ([]string, error) {
+	for {
+		token, err := s.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		if r := xmlAttr(start, "r"); r != "" {
+			s.rowNumber, _ = strconv.Atoi(r)
+		} else {
+			s.rowNumber++
+		}
+		return s.readCells()
+	}
+}
+
+func (s *XLSXSource) readCells() ([]string, error) {
+	var row []string
+	next := 0
+	for {
+		token, err := s.decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error reading row %d: %w", s.rowNumber, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				continue
+			}
+			column := next
+			if ref := xmlAttr(t, "r"); ref != "" {
+				c, err := columnIndex(ref)
+				if err != nil {
+					return nil, fmt.Errorf("error reading row %d: %w", s.rowNumber, err)
+				}
+				if c >= 0 {
+					column = c
+				}
+			}
+			if column >= maxXLSXColumns {
+				return nil, fmt.Errorf("error reading row %d: more than %d columns", s.rowNumber, maxXLSXColumns)
+			}
+			value, err := s.readCell(t)
+			if err != nil {
+				return nil, err
+			}
+			for len(row) <= column {
+				row = append(row, "")
+			}
+			row[column] = value
+			next = column + 1
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				return row, nil
+			}
+		}
+	}
+}
+
+// readCell decodes a <c> element, resolving shared and inline strings
+func (s *XLSXSource) readCell(start xml.StartElement) (string, error) {
+	var cell struct {
+		Value  string `xml:"v"`
+		Inline struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"is"`
+	}
+	if err := s.decoder.DecodeElement(&cell, &start); err != nil {
+		return "", fmt.Errorf("error reading cell in row %d: %w", s.rowNumber, err)
+	}
+
+	switch xmlAttr(start, "t") {
+	case "s":
+		index, err := strconv.Atoi(strings.TrimSpace(cell.Value))
+		if err != nil || index < 0 || index >= len(s.sharedStrings) {
+			return "", fmt.Errorf("invalid shared string index %q in row %d", cell.Value, s.rowNumber)
+		}
+		return s.sharedStrings[index], nil
+	case "inlineStr":
+		text := cell.Inline.Text
+		for _, run := range cell.Inline.Runs {
+			text += run.Text
+		}
+		return text, nil
+	case "b":
+		if cell.Value == "1" {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	default:
+		return cell.Value, nil
+	}
+}
+
+// maxXLSXColumns is the number of columns in a worksheet, A to XFD
+const maxXLSXColumns = 16384
+
+// columnIndex converts a cell reference such as "AB12" to a 0-based column.
+// It returns -1 when ref has no column letters and an error when the column
+// lies past XFD.
+func columnIndex(ref string) (int, error) {
+	column := 0
+	for _, r := range ref {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+		if column > maxXLSXColumns {
+			return 0, fmt.Errorf("cell reference %q is past column XFD", ref)
+		}
+	}
+	return column - 1, nil
+}
+
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func xmlAttr(start xml.StartElement, name string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func findZipFile(archive *zip.Reader, name string) (*zip.File, error) {
+	for _, file := range archive.File {
+		if file.Name == name {
+			return file, nil
+		}
+	}
+	return nil, fmt.Errorf("workbook part %q not found", name)
+}
+
+func openZipFile(archive *zip.Reader, name string) (io.ReadCloser, error) {
+	file, err := findZipFile(archive, name)
+	if err != nil {
+		return nil, err
+	}
+	return file.Open()
+}
+
+func decodeZipXML(archive *zip.Reader, name string, v interface{}) error {
+	file, err := openZipFile(archive, name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := xml.NewDecoder(file).Decode(v); err != nil {
+		return fmt.Errorf("error parsing %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package customerimporter
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestWorkbook builds a minimal .xlsx file with the given sheets, each
+// described as raw <sheetData> rows, and a shared string table
+func writeTestWorkbook(t *testing.T, sheets []string, sheetRows []string, shared []string) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "customers.xlsx")
+	file, err := os.Create(fileName)
+	if err != nil {
+		t.Fatalf("Failed to create workbook: %v", err)
+	}
+	defer file.Close()
+
+	var workbook, rels strings.Builder
+	workbook.WriteString(`<?xml version="1.0" encoding="UTF-8"?><workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(`<?xml version="1.0" encoding="UTF-8"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	parts := map[string]string{}
+	for i, name := range sheets {
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, name, i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+		parts[fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)] = `<?xml version="1.0" encoding="UTF-8"?><worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + sheetRows[i] + `</sheetData></worksheet>`
+	}
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+	parts["xl/workbook.xml"] = workbook.String()
+	parts["xl/_rels/workbook.xml.rels"] = rels.String()
+
+	var sst strings.Builder
+	sst.WriteString(`<?xml version="1.0" encoding="UTF-8"?><sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	for _, s := range shared {
+		fmt.Fprintf(&sst, `<si><t>%s</t></si>`, s)
+	}
+	sst.WriteString(`</sst>`)
+	parts["xl/sharedStrings.xml"] = sst.String()
+
+	archive := zip.NewWriter(file)
+	for name, content := range parts {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Failed to finalise workbook: %v", err)
+	}
+	return fileName
+}
+
+func testWorkbook(t *testing.T) string {
+	shared := []string{"email", "first_name", "last_name", "john.doe@example.com", "John", "Doe"}
+	summary := `<row r="1"><c r="A1" t="inlineStr"><is><t>Total</t></is></c></row>`
+	customers := `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c></row>` +
+		`<row r="2"><c r="A2" t="s"><v>3</v></c><c r="B2" t="s"><v>4</v></c><c r="C2" t="s"><v>5</v></c></row>` +
+		`<row r="3"><c r="A3" t="inlineStr"><is><t>jane@another.com</t></is></c><c r="C3" t="str"><v>Smith</v></c></row>` +
+		`<row r="5"><c r="B5" t="inlineStr"><is><t>NoEmail</t></is></c></row>` +
+		`<row r="6"><c r="A6" t="inlineStr"><is><r><t>bob@</t></r><r><t>example.com</t></r></is></c></row>`
+	return writeTestWorkbook(t, []string{"Summary", "Customers"}, []string{summary, customers}, shared)
+}
+
+func TestOpenXLSX_SheetSelection(t *testing.T) {
+	fileName := testWorkbook(t)
+
+	tests := []struct {
+		sheet   string
+		wantErr bool
+	}{
+		{"Customers", false},
+		{"2", false},
+		{"", true},        // First sheet has no email column
+		{"Missing", true}, // Unknown sheet name
+		{"3", true},       // Index out of range
+	}
+
+	for _, test := range tests {
+		src, err := OpenXLSX(fileName, test.sheet)
+		if test.wantErr {
+			if err == nil {
+				src.Close()
+				t.Errorf("OpenXLSX(%q) did not return an error", test.sheet)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("OpenXLSX(%q) returned an error: %v", test.sheet, err)
+			continue
+		}
+		src.Close()
+	}
+}
+
+func TestXLSXSource_Next(t *testing.T) {
+	src, err := OpenXLSX(testWorkbook(t), "Customers")
+	if err != nil {
+		t.Fatalf("OpenXLSX() returned an error: %v", err)
+	}
+	defer src.Close()
+
+	var records []Record
+	var badRows []int
+	for {
+		record, err := src.Next()
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			badRows = append(badRows, rowErr.Line)
+			continue
+		}
+		if err != nil {
+			break
+		}
+		records = append(records, record)
+	}
+
+	// The row without an email is reported by its sheet row number and skipped
+	if !reflect.DeepEqual(badRows, []int{5}) {
+		t.Errorf("XLSXSource.Next() reported bad rows %v; want [5]", badRows)
+	}
+	expected := []Record{
+		{FirstName: "John", LastName: "Doe", Email: "john.doe@example.com"},
+		{LastName: "Smith", Email: "jane@another.com"},
+		{Email: "bob@example.com"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("XLSXSource.Next() = %v; want %v", records, expected)
+	}
+}
+
+func TestProcessSource_XLSX(t *testing.T) {
+	src, err := OpenXLSX(testWorkbook(t), "Customers")
+	if err != nil {
+		t.Fatalf("OpenXLSX() returned an error: %v", err)
+	}
+	defer src.Close()
+
+	result, err := ProcessSource(src)
+	if err != nil {
+		t.Errorf("ProcessSource() returned an error: %v", err)
+	}
+
+	expected := map[string]int{
+		"example.com": 2,
+		"another.com": 1,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("ProcessSource() = %v; want %v", result, expected)
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected int
+	}{
+		{"A1", 0},
+		{"C12", 2},
+		{"Z3", 25},
+		{"AA1", 26},
+		{"AB100", 27},
+		{"XFD1", 16383},
+		{"12", -1},
+	}
+
+	for _, test := range tests {
+		result, err := columnIndex(test.ref)
+		if err != nil || result != test.expected {
+			t.Errorf("columnIndex(%q) = %d, %v; want %d", test.ref, result, err, test.expected)
+		}
+	}
+
+	for _, ref := range []string{"XFE1", "ZZZZZZZZZZZZZZ1"} {
+		if _, err := columnIndex(ref); err == nil {
+			t.Errorf("columnIndex(%q) returned no error for a column past XFD", ref)
+		}
+	}
+}
+
+func TestXLSXSource_HostileColumnRef(t *testing.T) {
+	rows := `<row r="1"><c r="A1" t="inlineStr"><is><t>email</t></is></c></row>` +
+		`<row r="2"><c r="ZZZZZZZZZZZZZZ2" t="inlineStr"><is><t>john@example.com</t></is></c></row>`
+	src, err := OpenXLSX(writeTestWorkbook(t, []string{"Customers"}, []string{rows}, nil), "")
+	if err != nil {
+		t.Fatalf("OpenXLSX() returned an error: %v", err)
+	}
+	defer src.Close()
+
+	if _, err := src.Next(); err == nil || errors.Is(err, io.EOF) {
+		t.Errorf("XLSXSource.Next() = %v; want an error for a column past XFD", err)
+	}
+}
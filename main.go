@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"teamwork-go-tests.com/TeamworkGoTests/customerimporter"
+	// Registers the "sqlite" database/sql driver used by --db
+	_ "modernc.org/sqlite"
 )
 
 func main() {